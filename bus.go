@@ -0,0 +1,112 @@
+package timedmap
+
+import (
+	"sync"
+)
+
+// Invalidation describes a set of keys which shall
+// be removed from all sections with the given
+// identifier subscribed to a Bus.
+type Invalidation struct {
+	Section int
+	Keys    []interface{}
+}
+
+// Bus distributes invalidations to multiple subscribed
+// TimedMaps or Sections to keep them coherent.
+//
+// Handlers can be registered to forward published
+// invalidations to external systems, e.g. a pub/sub
+// bridge. Invalidations received from such systems
+// can be passed to Deliver, which does not forward
+// them to the handlers again.
+type Bus struct {
+	mtx      sync.RWMutex
+	nextID   int
+	subs     map[int]Section
+	handlers map[int]func(inv Invalidation)
+}
+
+// NewBus creates and returns a new instance of Bus.
+func NewBus() *Bus {
+	return &Bus{
+		subs:     make(map[int]Section),
+		handlers: make(map[int]func(inv Invalidation)),
+	}
+}
+
+// Subscribe registers s to receive invalidations for
+// its section identifier. The returned function
+// removes the subscription.
+func (b *Bus) Subscribe(s Section) (unsubscribe func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = s
+
+	return func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// AddHandler registers fn which is called on each
+// invalidation passed to Publish. The returned
+// function removes the handler.
+func (b *Bus) AddHandler(fn func(inv Invalidation)) (remove func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = fn
+
+	return func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Invalidate publishes an invalidation of the
+// given keys in the given section.
+func (b *Bus) Invalidate(sec int, keys ...interface{}) {
+	b.Publish(Invalidation{
+		Section: sec,
+		Keys:    keys,
+	})
+}
+
+// Publish removes the keys of inv from all subscribers
+// with a matching section identifier and passes inv to
+// all registered handlers.
+func (b *Bus) Publish(inv Invalidation) {
+	b.Deliver(inv)
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for _, fn := range b.handlers {
+		fn(inv)
+	}
+}
+
+// Deliver removes the keys of inv from all subscribers
+// with a matching section identifier without passing
+// it to the registered handlers.
+func (b *Bus) Deliver(inv Invalidation) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for _, s := range b.subs {
+		if s.Ident() != inv.Section {
+			continue
+		}
+		for _, key := range inv.Keys {
+			s.Remove(key)
+		}
+	}
+}
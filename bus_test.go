@@ -0,0 +1,48 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+
+	tm1 := New(0)
+	tm2 := New(0)
+	s2 := tm2.Section(1)
+
+	unsub1 := b.Subscribe(tm1)
+	b.Subscribe(s2)
+
+	for i := 0; i < 3; i++ {
+		tm1.Set(i, i, time.Hour)
+		tm2.Set(i, i, time.Hour)
+		s2.Set(i, i, time.Hour)
+	}
+
+	var published []Invalidation
+	remove := b.AddHandler(func(inv Invalidation) {
+		published = append(published, inv)
+	})
+
+	b.Invalidate(0, 0, 1)
+	assert.False(t, tm1.Contains(0))
+	assert.False(t, tm1.Contains(1))
+	assert.True(t, tm2.Contains(0))
+	assert.True(t, s2.Contains(0))
+	assert.Equal(t, []Invalidation{{Section: 0, Keys: []interface{}{0, 1}}}, published)
+
+	b.Deliver(Invalidation{Section: 1, Keys: []interface{}{2}})
+	assert.False(t, s2.Contains(2))
+	assert.True(t, tm2.Contains(2))
+	assert.Len(t, published, 1)
+
+	unsub1()
+	remove()
+	b.Invalidate(0, 2)
+	assert.True(t, tm1.Contains(2))
+	assert.Len(t, published, 1)
+}
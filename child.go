@@ -0,0 +1,79 @@
+package timedmap
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+)
+
+const (
+	// childSectionBase is the first section identifier
+	// allocated for child maps created using Child.
+	childSectionBase = math.MinInt32
+	// maxChildren is the number of section identifiers
+	// reserved for child maps, which range from
+	// math.MinInt32 to -2.
+	maxChildren = math.MaxInt32
+)
+
+// Child returns a derived map backed by a new section of
+// the map, which shares its storage and cleanup loop. As
+// soon as ctx is done, all key-value pairs of the child
+// are removed without executing their callbacks and all
+// operations on the child return ErrSectionDeleted or
+// have no effect.
+//
+// The negative section identifiers starting at
+// math.MinInt32 are reserved for child maps and must not
+// be used otherwise. The identifiers of children whose
+// ctx is done are reused. The goroutine watching ctx is
+// stopped when the map is closed.
+func (tm *TimedMap) Child(ctx context.Context) Section {
+	s := newSection(tm, tm.allocChild())
+	s.done = ctx.Done()
+
+	if s.done != nil {
+		atomic.AddInt32(tm.goroutines, 1)
+		go func() {
+			defer atomic.AddInt32(tm.goroutines, -1)
+
+			select {
+			case <-s.done:
+			case <-tm.done:
+				return
+			}
+
+			tm.sectionMtx.Lock()
+			defer tm.sectionMtx.Unlock()
+
+			tm.mtx.Lock()
+			defer tm.mtx.Unlock()
+
+			tm.removeSection(s.sec)
+			tm.childFree = append(tm.childFree, s.sec)
+		}()
+	}
+
+	return s
+}
+
+// allocChild returns an unused section identifier
+// for a child map. It panics if all identifiers
+// reserved for child maps are in use.
+func (tm *TimedMap) allocChild() int {
+	tm.sectionMtx.Lock()
+	defer tm.sectionMtx.Unlock()
+
+	if n := len(tm.childFree); n > 0 {
+		sec := tm.childFree[n-1]
+		tm.childFree = tm.childFree[:n-1]
+		return sec
+	}
+
+	if tm.childNext == maxChildren {
+		panic("timedmap: too many child maps")
+	}
+	sec := childSectionBase + tm.childNext
+	tm.childNext++
+	return sec
+}
@@ -0,0 +1,80 @@
+package timedmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChild(t *testing.T) {
+	tm := New(0)
+	tm.Set(1, "root", time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := tm.Child(ctx)
+	other := tm.Child(context.Background())
+	assert.NotEqual(t, c.Ident(), other.Ident())
+
+	c.Set(1, "child", time.Hour)
+	other.Set(1, "other", time.Hour)
+	assert.EqualValues(t, "child", c.GetValue(1))
+	assert.EqualValues(t, "root", tm.GetValue(1))
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		tm.mtx.RLock()
+		defer tm.mtx.RUnlock()
+		return len(tm.container) == 2
+	}, time.Second, time.Millisecond)
+
+	c.Set(2, "child", time.Hour)
+	assert.Nil(t, c.GetValue(2))
+	assert.ErrorIs(t, c.Refresh(1, time.Hour), ErrSectionDeleted)
+	assert.EqualValues(t, "other", other.GetValue(1))
+	assert.EqualValues(t, "root", tm.GetValue(1))
+}
+
+func TestChildClose(t *testing.T) {
+	tm := New(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tm.Child(ctx)
+	c.Set(1, "child", time.Hour)
+	assert.Equal(t, 1, tm.Resources().Goroutines)
+
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Goroutines == 0
+	}, time.Second, time.Millisecond)
+
+	tm.Child(ctx)
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Goroutines == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestChildReuseIdent(t *testing.T) {
+	tm := New(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := tm.Child(ctx)
+	assert.Less(t, c.Ident(), 0)
+	cancel()
+	assert.Eventually(t, func() bool {
+		tm.sectionMtx.RLock()
+		defer tm.sectionMtx.RUnlock()
+		return len(tm.childFree) == 1
+	}, time.Second, time.Millisecond)
+
+	n := tm.Child(context.Background())
+	assert.Equal(t, c.Ident(), n.Ident())
+
+	c.Set(1, "old", time.Hour)
+	n.Set(2, "new", time.Hour)
+	assert.Nil(t, n.GetValue(1))
+	assert.EqualValues(t, "new", n.GetValue(2))
+	assert.Nil(t, c.GetValue(2))
+}
@@ -0,0 +1,80 @@
+package timedmap
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type (
+	contextKey       struct{}
+	callerContextKey struct{}
+)
+
+// NewContext returns a copy of ctx which carries the
+// given TimedMap or Section s. It can be retrieved
+// downstream using FromContext.
+//
+// When ctx is cancelled, s is torn down. If s is a
+// TimedMap, it is closed. Otherwise, the section is
+// flushed. The goroutine watching ctx is stopped when
+// the map is closed before.
+func NewContext(ctx context.Context, s Section) context.Context {
+	done := ctx.Done()
+	if done == nil {
+		return context.WithValue(ctx, contextKey{}, s)
+	}
+
+	tm, isMap := s.(*TimedMap)
+	if sec, ok := s.(*section); ok {
+		tm = sec.tm
+	}
+
+	var closed <-chan struct{}
+	if tm != nil {
+		closed = tm.done
+		atomic.AddInt32(tm.goroutines, 1)
+	}
+
+	go func() {
+		if tm != nil {
+			defer atomic.AddInt32(tm.goroutines, -1)
+		}
+
+		select {
+		case <-done:
+		case <-closed:
+			return
+		}
+
+		if isMap {
+			tm.Close()
+		} else {
+			s.Flush()
+		}
+	}()
+
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the TimedMap or Section
+// attached to ctx using NewContext. If there is
+// none attached, nil is returned.
+func FromContext(ctx context.Context) Section {
+	s, _ := ctx.Value(contextKey{}).(Section)
+	return s
+}
+
+// WithCaller returns a copy of ctx which carries the
+// given caller identifier, which is recorded with the
+// key-value pairs set using SetContext.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// CallerFromContext returns the caller identifier
+// attached to ctx using WithCaller. If there is none
+// attached, an empty string is returned.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerContextKey{}).(string)
+	return caller
+}
@@ -0,0 +1,84 @@
+package timedmap
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	t.Run("timedmap", func(t *testing.T) {
+		tm := New(dCleanupTick)
+		tm.Set(1, 1, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx = NewContext(ctx, tm)
+		assert.Equal(t, tm, FromContext(ctx))
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		assert.EqualValues(t, 0, tm.Size())
+		assert.True(t, atomic.LoadUint32(tm.closed) != 0)
+		assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+	})
+
+	t.Run("canceled right away", func(t *testing.T) {
+		tm := New(dCleanupTick)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		NewContext(ctx, tm)
+		cancel()
+
+		assert.Eventually(t, func() bool {
+			return atomic.LoadUint32(tm.closed) != 0
+		}, time.Second, time.Millisecond)
+		assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+		assert.Eventually(t, func() bool {
+			return tm.Resources().Goroutines == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("closed before", func(t *testing.T) {
+		tm := New(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		NewContext(ctx, tm)
+		NewContext(ctx, tm.Section(1))
+		assert.Equal(t, 2, tm.Resources().Goroutines)
+
+		tm.Close()
+		assert.Eventually(t, func() bool {
+			return tm.Resources().Goroutines == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("section", func(t *testing.T) {
+		tm := New(dCleanupTick)
+		tm.Set(1, 1, time.Hour)
+		s := tm.Section(1)
+		s.Set(1, 1, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx = NewContext(ctx, s)
+		assert.Equal(t, s, FromContext(ctx))
+
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		assert.EqualValues(t, 0, s.Size())
+		assert.EqualValues(t, 1, tm.Size())
+	})
+}
+
+func TestCallerFromContext(t *testing.T) {
+	assert.Empty(t, CallerFromContext(context.Background()))
+
+	ctx := WithCaller(context.Background(), "sessions")
+	assert.Equal(t, "sessions", CallerFromContext(ctx))
+}
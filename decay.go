@@ -0,0 +1,61 @@
+package timedmap
+
+import (
+	"math"
+	"time"
+)
+
+// DecayFunc returns the decayed value of the passed
+// value after the given elapsed time. When alive is
+// false, the key-value pair holding the value expires.
+type DecayFunc func(value interface{}, elapsed time.Duration) (decayed interface{}, alive bool)
+
+// ExponentialDecay returns a DecayFunc which halves
+// numeric values every halfLife. The decayed value is
+// returned as float64. As soon as the decayed value
+// drops below floor, it is reported as not alive.
+//
+// Values which are not numeric are returned as is.
+func ExponentialDecay(halfLife time.Duration, floor float64) DecayFunc {
+	return func(value interface{}, elapsed time.Duration) (interface{}, bool) {
+		f, ok := toFloat64(value)
+		if !ok {
+			return value, true
+		}
+		decayed := f * math.Pow(0.5, float64(elapsed)/float64(halfLife))
+		return decayed, decayed >= floor
+	}
+}
+
+// toFloat64 converts the given numeric value
+// to float64. If v is not numeric, false is
+// returned.
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,54 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialDecay(t *testing.T) {
+	fn := ExponentialDecay(time.Second, 1)
+
+	v, alive := fn(8, 0)
+	assert.True(t, alive)
+	assert.EqualValues(t, 8, v)
+
+	v, alive = fn(8, 2*time.Second)
+	assert.True(t, alive)
+	assert.InDelta(t, 2, v, 0.0001)
+
+	_, alive = fn(8, 4*time.Second)
+	assert.False(t, alive)
+
+	v, alive = fn("foo", time.Hour)
+	assert.True(t, alive)
+	assert.EqualValues(t, "foo", v)
+}
+
+func TestSetDecay(t *testing.T) {
+	tm := New(0)
+
+	assert.ErrorIs(t, tm.SetDecay("keyNotExists", ExponentialDecay(time.Second, 0)), ErrKeyNotFound)
+
+	tm.Set(1, 100, time.Hour)
+	assert.Nil(t, tm.SetDecay(1, func(value interface{}, elapsed time.Duration) (interface{}, bool) {
+		return value.(int) - 1, true
+	}))
+	assert.EqualValues(t, 99, tm.GetValue(1))
+	assert.EqualValues(t, 99, tm.Snapshot()[1])
+
+	assert.Nil(t, tm.SetDecay(1, func(value interface{}, elapsed time.Duration) (interface{}, bool) {
+		return value, false
+	}))
+	assert.False(t, tm.Contains(1))
+
+	s := tm.Section(1)
+	s.Set(1, 50, time.Hour)
+	assert.Nil(t, s.SetDecay(1, ExponentialDecay(time.Hour, 0)))
+	assert.InDelta(t, 50, s.GetValue(1), 0.01)
+
+	// Setting a new value removes the decay
+	s.Set(1, 10, time.Hour)
+	assert.EqualValues(t, 10, s.GetValue(1))
+}
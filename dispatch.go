@@ -0,0 +1,109 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy defines how expirations are handled
+// when the callback queue of a map created using
+// WithAsyncCallbacks is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the operation expiring the
+	// key-value pair until the queue has room for its
+	// callbacks. This is the default policy.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the callbacks of the
+	// oldest queued expiration to make room for the new
+	// one. Dropped expirations are counted in
+	// Stats.DroppedCallbacks.
+	OverflowDropOldest
+)
+
+// expiration holds the callbacks of an expired
+// key-value pair waiting to be dispatched.
+type expiration struct {
+	val   interface{}
+	cbs   []callback
+	entry Entry
+}
+
+// dispatch runs the callbacks and the expire
+// handler of the map for the expiration e.
+func (tm *TimedMap) dispatch(e expiration) {
+	for _, cb := range e.cbs {
+		tm.runCallback(cb, e.val)
+	}
+	if tm.onExpire != nil {
+		tm.onExpire(e.entry)
+	}
+}
+
+// enqueue passes e to the callback queue according
+// to the OverflowPolicy of the map. e is dropped when
+// the map has been closed.
+//
+// The caller may hold the write lock of the map.
+func (tm *TimedMap) enqueue(e expiration) {
+	if tm.overflowPolicy == OverflowBlock {
+		select {
+		case tm.expirations <- e:
+		case <-tm.done:
+		}
+		return
+	}
+
+	for {
+		select {
+		case tm.expirations <- e:
+			return
+		default:
+		}
+		select {
+		case <-tm.expirations:
+			atomic.AddUint64(tm.droppedCallbacks, 1)
+		default:
+		}
+	}
+}
+
+// dispatchLoop runs the callbacks of all queued
+// expirations until the map is closed. Expirations
+// queued before the map has been closed are still
+// dispatched. The goroutine running the loop is
+// counted by the caller.
+func (tm *TimedMap) dispatchLoop() {
+	defer atomic.AddInt32(tm.goroutines, -1)
+
+	for {
+		select {
+		case e := <-tm.expirations:
+			tm.dispatch(e)
+		case <-tm.done:
+			for {
+				select {
+				case e := <-tm.expirations:
+					tm.dispatch(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// expirationOf returns the expiration of the element
+// v stored by key in section sec.
+func expirationOf(key interface{}, sec int, v *element, now time.Time) expiration {
+	cbs := make([]callback, 0, len(v.cbs)+len(v.addedCbs))
+	cbs = append(cbs, v.cbs...)
+	cbs = append(cbs, v.addedCbs...)
+	return expiration{
+		val:   v.value,
+		cbs:   cbs,
+		entry: v.entry(key, sec, now),
+	}
+}
@@ -0,0 +1,81 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncCallbacks(t *testing.T) {
+	tm := NewWithOptions(0, WithAsyncCallbacks(10, OverflowBlock))
+	defer tm.Close()
+
+	done := make(chan interface{}, 1)
+	tm.Set(1, "a", 0, func(v interface{}) {
+		// Accessing the map from the callback does not
+		// deadlock, as it is not run under the lock.
+		tm.Set(2, v, time.Hour)
+		done <- v
+	})
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+
+	select {
+	case v := <-done:
+		assert.Equal(t, "a", v)
+	case <-time.After(time.Second):
+		t.Fatal("callback not dispatched")
+	}
+	assert.EqualValues(t, "a", tm.GetValue(2))
+}
+
+func TestAsyncCallbacksDropOldest(t *testing.T) {
+	var calls []interface{}
+	block := make(chan struct{})
+	started := make(chan struct{})
+	tm := NewWithOptions(0, WithAsyncCallbacks(2, OverflowDropOldest))
+
+	tm.Set(0, 0, 0, func(interface{}) {
+		close(started)
+		<-block
+	})
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	<-started
+
+	for i := 1; i <= 4; i++ {
+		tm.Set(i, i, 0, func(v interface{}) {
+			calls = append(calls, v)
+		})
+		time.Sleep(time.Millisecond)
+		tm.cleanUp()
+	}
+	assert.EqualValues(t, 2, tm.Stats().DroppedCallbacks)
+
+	close(block)
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Goroutines == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []interface{}{3, 4}, calls)
+}
+
+func TestAsyncCallbacksClose(t *testing.T) {
+	var calls int32
+	tm := NewWithOptions(0, WithAsyncCallbacks(1, OverflowBlock))
+	assert.Equal(t, 1, tm.Resources().Goroutines)
+
+	tm.Set(1, 1, 0, func(interface{}) {
+		atomic.AddInt32(&calls, 1)
+	})
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Goroutines == 0
+	}, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
@@ -9,7 +9,73 @@ var (
 	// requested which is not present in the map.
 	ErrKeyNotFound = errors.New("key not found")
 
+	// ErrKeyExists is returned when a key was passed
+	// which must not be present in the map.
+	ErrKeyExists = errors.New("key already exists")
+
 	// ErrValueNoMap is returned when a value passed
 	// expected was of another type.
 	ErrValueNoMap = errors.New("value is not of type map")
+
+	// ErrValueNotNumeric is returned when a numeric
+	// operation was requested on a value which is
+	// not of a numeric type.
+	ErrValueNotNumeric = errors.New("value is not numeric")
+
+	// ErrValueNoWindow is returned when a window
+	// operation was requested on a value which is
+	// not a sliding window created using Observe.
+	ErrValueNoWindow = errors.New("value is not a window")
+
+	// ErrClosed is returned when an operation was
+	// performed on a map which has been closed.
+	ErrClosed = errors.New("map has been closed")
+
+	// ErrSectionDeleted is returned when an operation
+	// was performed on a Section instance whose section
+	// has been deleted using DeleteSection.
+	ErrSectionDeleted = errors.New("section has been deleted")
+
+	// ErrTooManyCallbacks is returned when adding
+	// callbacks to a key-value pair would exceed the
+	// maximum number of callbacks of the map.
+	ErrTooManyCallbacks = errors.New("too many callbacks")
+
+	// ErrInvalidSnapshot is returned when a snapshot
+	// could not be decoded or is malformed.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	// ErrSnapshotVersion is returned when a snapshot
+	// has been written in a newer format version than
+	// supported.
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+
+	// ErrQuotaExceeded is returned when a key-value
+	// pair could not be added to a section as it has
+	// reached the quota of the map.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrRejected is returned when a key-value pair
+	// has not been stored as it has been rejected by
+	// the admission hook of the map.
+	ErrRejected = errors.New("rejected by admission hook")
+
+	// ErrValueType is returned when a value has not
+	// been stored as it is not of the value type of
+	// its section set using TypedSection.
+	ErrValueType = errors.New("value is not of the section value type")
+
+	// ErrPromiseExpired is returned to the waiters of
+	// a Promise which has not been resolved in time.
+	ErrPromiseExpired = errors.New("promise expired")
+
+	// ErrPromiseSettled is returned when resolving or
+	// rejecting a Promise which has already been
+	// settled or has expired.
+	ErrPromiseSettled = errors.New("promise already settled")
+
+	// ErrInvalidTTLOverrides is returned when TTL
+	// overrides could not be decoded or contain a
+	// malformed key pattern.
+	ErrInvalidTTLOverrides = errors.New("invalid ttl overrides")
 )
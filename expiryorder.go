@@ -0,0 +1,91 @@
+package timedmap
+
+import (
+	"sort"
+	"time"
+)
+
+// overdueItem is an element which is due to be expired
+// together with its expiration time.
+type overdueItem struct {
+	k       keyWrap
+	v       *element
+	expires time.Time
+}
+
+// overdue returns all elements which have expired at now
+// and whose grace period has passed, ordered by section
+// and expiration time. If filter is not nil, only the
+// elements for which filter returns true are returned.
+//
+// The caller must hold the lock of the map.
+func (tm *TimedMap) overdue(now time.Time, filter func(k keyWrap, v *element) bool) []overdueItem {
+	var items []overdueItem
+	for k, v := range tm.container {
+		if !v.expired(now) || tm.inGrace(v, now) {
+			continue
+		}
+		if filter != nil && !filter(k, v) {
+			continue
+		}
+		items = append(items, overdueItem{k, v, overdueExpires(v, now)})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.k.sec != b.k.sec {
+			return a.k.sec < b.k.sec
+		}
+		if !a.expires.Equal(b.expires) {
+			return a.expires.Before(b.expires)
+		}
+		return lessKey(a.k.key, b.k.key)
+	})
+
+	return items
+}
+
+// expireOverdue expires at most max overdue elements in
+// the order of their expiration times within each section
+// and returns the number of expired elements. remaining is
+// true, if there are still overdue elements left in the
+// map. A value of max of 0 or less expires all of them.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) expireOverdue(now time.Time, max int) (expired int, remaining bool) {
+	items := tm.overdue(now, nil)
+	if max > 0 && len(items) > max {
+		items, remaining = items[:max], true
+	}
+	for _, it := range items {
+		tm.expireOne(it.k.key, it.k.sec, it.v)
+	}
+	return len(items), remaining
+}
+
+// expirePreceding expires all overdue elements of the
+// section sec which expire before the element v, in the
+// order of their expiration times.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) expirePreceding(sec int, v *element) {
+	now := time.Now()
+	until := overdueExpires(v, now)
+
+	items := tm.overdue(now, func(k keyWrap, e *element) bool {
+		return k.sec == sec && e != v && !overdueExpires(e, now).After(until)
+	})
+	for _, it := range items {
+		tm.expireOne(it.k.key, it.k.sec, it.v)
+	}
+}
+
+// overdueExpires returns the expiration time of the
+// overdue element v, which is now at the latest for
+// elements expired by their DecayFunc.
+func overdueExpires(v *element, now time.Time) time.Time {
+	if expires := v.effectiveExpires(); expires.Before(now) {
+		return expires
+	}
+	return now
+}
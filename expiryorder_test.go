@@ -0,0 +1,45 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedExpiry(t *testing.T) {
+	var expired []interface{}
+	tm := NewWithOptions(0,
+		WithOrderedExpiry(),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }))
+	s1 := tm.Section(1)
+
+	now := time.Now()
+	tm.SetExpireAt("a", 1, now.Add(-3*time.Second))
+	tm.SetExpireAt("b", 2, now.Add(-1*time.Second))
+	tm.SetExpireAt("c", 3, now.Add(-2*time.Second))
+	tm.SetExpireAt("d", 4, now.Add(time.Hour))
+	s1.SetExpireAt("e", 5, now.Add(-4*time.Second))
+
+	assert.Nil(t, tm.GetValue("b"))
+	assert.Equal(t, []interface{}{"a", "c", "b"}, expired)
+	assert.Equal(t, 2, tm.Size())
+
+	expired = nil
+	assert.Equal(t, 1, tm.cleanUp())
+	assert.Equal(t, []interface{}{"e"}, expired)
+
+	expired = nil
+	for i := 0; i < 50; i++ {
+		tm.SetExpireAt(i, i, now.Add(time.Duration(i-100)*time.Millisecond))
+	}
+	n, remaining := tm.CleanupN(20)
+	assert.Equal(t, 20, n)
+	assert.True(t, remaining)
+	assert.Equal(t, 30, tm.cleanUp())
+	assert.Len(t, expired, 50)
+	for i, key := range expired {
+		assert.Equal(t, i, key)
+	}
+	assert.Equal(t, 1, tm.Size())
+}
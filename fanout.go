@@ -0,0 +1,152 @@
+package timedmap
+
+import (
+	"sync"
+	"time"
+)
+
+// TickerFanout distributes the ticks of a single time
+// source to the cleanup loops of multiple maps. Each
+// map receives the ticks delayed by its own phase
+// offset, so that maps sharing a time source do not
+// all run their cleanup at the same instant.
+type TickerFanout struct {
+	mtx     sync.Mutex
+	targets map[*fanoutTarget]struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// fanoutTarget forwards the ticks received on in
+// to out after waiting for offset.
+type fanoutTarget struct {
+	tm     *TimedMap
+	offset time.Duration
+	in     chan time.Time
+	out    chan time.Time
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewTickerFanout creates and returns a new instance
+// of TickerFanout distributing the ticks of source.
+// The fanout stops when source is closed or Close
+// is called, which also stops the cleanup loops of
+// all attached maps.
+func NewTickerFanout(source <-chan time.Time) *TickerFanout {
+	f := &TickerFanout{
+		targets: make(map[*fanoutTarget]struct{}),
+		stop:    make(chan struct{}),
+	}
+	go f.run(source)
+	return f
+}
+
+// Attach starts the cleanup loop of tm driven by the
+// ticks of the fanout delayed by offset. Ticks arriving
+// while the previous tick of tm is still delayed or
+// being processed are dropped for tm.
+//
+// The returned function stops the cleanup loop of tm
+// and detaches it from the fanout. A cleanup loop which
+// has been restarted on tm in the meantime is kept
+// running.
+func (f *TickerFanout) Attach(tm *TimedMap, offset time.Duration) (detach func()) {
+	t := &fanoutTarget{
+		tm:     tm,
+		offset: offset,
+		in:     make(chan time.Time, 1),
+		out:    make(chan time.Time),
+		stop:   make(chan struct{}),
+	}
+
+	f.mtx.Lock()
+	f.targets[t] = struct{}{}
+	f.mtx.Unlock()
+
+	go t.run()
+	tm.StartCleanerExternal(t.out)
+
+	return func() {
+		f.mtx.Lock()
+		delete(f.targets, t)
+		f.mtx.Unlock()
+		t.close()
+	}
+}
+
+// Close stops the fanout and the cleanup loops
+// of all attached maps.
+func (f *TickerFanout) Close() {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for t := range f.targets {
+		t.close()
+		delete(f.targets, t)
+	}
+}
+
+// run passes all ticks of source to the
+// attached targets until the fanout stops.
+func (f *TickerFanout) run(source <-chan time.Time) {
+	for {
+		select {
+		case now, ok := <-source:
+			if !ok {
+				f.Close()
+				return
+			}
+			f.mtx.Lock()
+			for t := range f.targets {
+				select {
+				case t.in <- now:
+				default:
+				}
+			}
+			f.mtx.Unlock()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// run forwards the ticks of the target
+// delayed by its offset until it is closed.
+func (t *fanoutTarget) run() {
+	for {
+		select {
+		case now := <-t.in:
+			if t.offset > 0 {
+				timer := time.NewTimer(t.offset)
+				select {
+				case <-timer.C:
+				case <-t.stop:
+					timer.Stop()
+					return
+				}
+			}
+			select {
+			case t.out <- now:
+			case <-t.stop:
+				return
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// close stops the target and the cleanup loop
+// of its map, if still driven by the target.
+func (t *fanoutTarget) close() {
+	t.once.Do(func() {
+		close(t.stop)
+		t.tm.stopCleanerSource(t.out)
+	})
+}
@@ -0,0 +1,90 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTickerFanout(t *testing.T) {
+	source := make(chan time.Time)
+	f := NewTickerFanout(source)
+	defer f.Close()
+
+	tm1 := New(0)
+	tm2 := New(0)
+	f.Attach(tm1, 0)
+	detach := f.Attach(tm2, 50*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint32(tm1.cleanerRunning) != 0 &&
+			atomic.LoadUint32(tm2.cleanerRunning) != 0
+	}, time.Second, time.Millisecond)
+
+	tm1.Set(1, 1, 0)
+	tm2.Set(1, 1, 0)
+	time.Sleep(time.Millisecond)
+
+	source <- time.Now()
+	assert.Eventually(t, func() bool {
+		return tm1.getRaw(1, 0) == nil
+	}, time.Second, time.Millisecond)
+	assert.NotNil(t, tm2.getRaw(1, 0))
+
+	assert.Eventually(t, func() bool {
+		return tm2.getRaw(1, 0) == nil
+	}, time.Second, time.Millisecond)
+
+	detach()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint32(tm2.cleanerRunning) == 0
+	}, time.Second, time.Millisecond)
+
+	tm2.Set(1, 1, 0)
+	source <- time.Now()
+	time.Sleep(100 * time.Millisecond)
+	assert.NotNil(t, tm2.getRaw(1, 0))
+
+	f.Close()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint32(tm1.cleanerRunning) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestTickerFanoutSourceClosed(t *testing.T) {
+	source := make(chan time.Time)
+	f := NewTickerFanout(source)
+
+	tm := New(0)
+	f.Attach(tm, 0)
+	assert.True(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+
+	close(source)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint32(tm.cleanerRunning) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestTickerFanoutDetachRestarted(t *testing.T) {
+	source := make(chan time.Time)
+	f := NewTickerFanout(source)
+	defer f.Close()
+
+	tm := New(0)
+	defer tm.StopCleaner()
+	detach := f.Attach(tm, 0)
+
+	own := make(chan time.Time)
+	tm.StartCleanerExternal(own)
+	detach()
+	assert.True(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+
+	tm.Set(1, 1, 0)
+	time.Sleep(time.Millisecond)
+	own <- time.Now()
+	assert.Eventually(t, func() bool {
+		return tm.getRaw(1, 0) == nil
+	}, time.Second, time.Millisecond)
+}
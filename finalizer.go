@@ -0,0 +1,54 @@
+package timedmap
+
+// SetFinalizer sets the finalizer of a key-value pair,
+// which is executed exactly once with the value when it
+// permanently leaves the map, i.e. when the pair expires,
+// is removed, replaced by a different value, flushed or
+// when the map is closed. Unlike callbacks, which are only
+// executed on expiration, finalizers are intended to
+// release resources held by the value, like file handles
+// or connections. A previously set finalizer of the pair
+// is replaced. If there is no value to the key passed,
+// this will return an error.
+//
+// Values taken out of the map by Pop are handed over to
+// the caller and are not finalized. Clones and merged
+// copies of the pair do not inherit its finalizer.
+//
+// Like callbacks, the finalizer is executed while the
+// write lock of the map is held, so it must not access
+// the map. See WithRemovalPacing for how finalizers of
+// mass removals can be spread over time.
+func (tm *TimedMap) SetFinalizer(key interface{}, fn func(value interface{})) error {
+	return tm.setFinalizer(tm.key(key), 0, fn)
+}
+
+// setFinalizer sets the finalizer of the element of
+// the given key in the given section.
+func (tm *TimedMap) setFinalizer(key interface{}, sec int, fn func(value interface{})) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.finalizer = fn
+	return nil
+}
+
+// finalize executes the finalizer of the element with
+// its current value, if set, and removes it, so that it
+// is executed only once.
+//
+// The caller must hold the write lock of the map.
+func (v *element) finalize() {
+	if fn := v.finalizer; fn != nil {
+		v.finalizer = nil
+		fn(v.value)
+	}
+}
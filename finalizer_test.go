@@ -0,0 +1,81 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetFinalizer(t *testing.T) {
+	tm := New(0)
+
+	finalized := map[interface{}]int{}
+	finalizer := func(value interface{}) {
+		finalized[value]++
+	}
+
+	assert.ErrorIs(t, tm.SetFinalizer(1, finalizer), ErrKeyNotFound)
+
+	tm.Set(1, "expired", time.Hour)
+	tm.Set(2, "removed", time.Hour)
+	tm.Set(3, "replaced", time.Hour)
+	tm.Set(4, "popped", time.Hour)
+	tm.Set(5, "closed", time.Hour)
+	tm.Section(1).Set(6, "flushed", time.Hour)
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, tm.SetFinalizer(i, finalizer))
+	}
+	assert.Nil(t, tm.Section(1).SetFinalizer(6, finalizer))
+
+	assert.Nil(t, tm.SetExpires(1, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, map[interface{}]int{"expired": 1}, finalized)
+
+	tm.Remove(2)
+	tm.Set(3, "new", time.Hour)
+	tm.Set(3, "newer", time.Hour)
+	val, ok := tm.Pop(4)
+	assert.True(t, ok)
+	assert.Equal(t, "popped", val)
+	assert.Equal(t, map[interface{}]int{
+		"expired":  1,
+		"removed":  1,
+		"replaced": 1,
+	}, finalized)
+
+	tm.Section(1).Flush()
+	assert.Equal(t, 1, finalized["flushed"])
+	assert.NotContains(t, finalized, "closed")
+
+	tm.Close()
+	assert.Equal(t, map[interface{}]int{
+		"expired":  1,
+		"removed":  1,
+		"replaced": 1,
+		"flushed":  1,
+		"closed":   1,
+	}, finalized)
+}
+
+func TestSetFinalizerUnchanged(t *testing.T) {
+	tm := NewWithOptions(0, WithValueEqual(func(a, b interface{}) bool {
+		return a == b
+	}))
+
+	var finalized []interface{}
+	tm.Set(1, "a", time.Hour)
+	assert.Nil(t, tm.SetFinalizer(1, func(value interface{}) {
+		finalized = append(finalized, value)
+	}))
+
+	tm.Set(1, "a", time.Hour)
+	assert.Empty(t, finalized)
+
+	tm.Set(1, "b", time.Hour)
+	assert.Equal(t, []interface{}{"a"}, finalized)
+
+	tm.Remove(1)
+	assert.Equal(t, []interface{}{"a"}, finalized)
+}
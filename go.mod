@@ -2,4 +2,4 @@ module github.com/zekroTJA/timedmap
 
 go 1.13
 
-require github.com/stretchr/testify v1.7.0 // indirect
+require github.com/stretchr/testify v1.7.0
@@ -0,0 +1,51 @@
+package timedmap
+
+import "time"
+
+// GetValueStale returns the value of a key in the map like
+// TryGetValue. Additionally, values which have expired but
+// are still in their grace period set using WithGracePeriod
+// are returned with stale set to true. stale is also true
+// if the soft expiration time of the pair has passed.
+func (tm *TimedMap) GetValueStale(key interface{}) (val interface{}, stale, ok bool) {
+	return tm.getValueStale(tm.key(key), 0)
+}
+
+// getValueStale returns the value of the given key in
+// the given section, including expired values in their
+// grace period.
+func (tm *TimedMap) getValueStale(key interface{}, sec int) (val interface{}, stale, ok bool) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.get.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v, ok := tm.container[keyWrap{sec: sec, key: key}]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if v.expired(now) {
+		if !tm.inGrace(v, now) {
+			tm.expireElement(key, sec, v)
+			return nil, false, false
+		}
+		return v.value, true, true
+	}
+
+	tm.slide(key, sec, v, now)
+	return v.valueAt(now), v.stale(now), true
+}
+
+// inGrace returns true if the expired element v is
+// still in the grace period of the map at now.
+func (tm *TimedMap) inGrace(v *element, now time.Time) bool {
+	return tm.grace > 0 && now.Before(v.effectiveExpires().Add(tm.grace))
+}
@@ -0,0 +1,92 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetValueStale(t *testing.T) {
+	var expired []interface{}
+	tm := NewWithOptions(0,
+		WithGracePeriod(time.Hour),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }))
+
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, 0)
+	tm.Section(1).Set(3, 3, 0)
+	time.Sleep(time.Millisecond)
+
+	val, stale, ok := tm.GetValueStale(1)
+	assert.Equal(t, 1, val)
+	assert.False(t, stale)
+	assert.True(t, ok)
+
+	assert.Nil(t, tm.GetValue(2))
+	assert.False(t, tm.Contains(2))
+	tm.cleanUp()
+	assert.Equal(t, 3, tm.Size())
+	assert.Empty(t, expired)
+
+	val, stale, ok = tm.GetValueStale(2)
+	assert.Equal(t, 2, val)
+	assert.True(t, stale)
+	assert.True(t, ok)
+
+	val, stale, ok = tm.Section(1).GetValueStale(3)
+	assert.Equal(t, 3, val)
+	assert.True(t, stale)
+	assert.True(t, ok)
+
+	tm.Set(2, 4, time.Hour)
+	val, stale, ok = tm.GetValueStale(2)
+	assert.Equal(t, 4, val)
+	assert.False(t, stale)
+	assert.True(t, ok)
+
+	_, _, ok = tm.GetValueStale(4)
+	assert.False(t, ok)
+}
+
+func TestGracePeriodExpires(t *testing.T) {
+	var expired []interface{}
+	tm := NewWithOptions(0,
+		WithGracePeriod(20*time.Millisecond),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }))
+
+	tm.Set(1, 1, 0)
+	tm.Set(2, 2, 0)
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Empty(t, expired)
+
+	time.Sleep(30 * time.Millisecond)
+	_, _, ok := tm.GetValueStale(1)
+	assert.False(t, ok)
+	assert.Equal(t, []interface{}{1}, expired)
+
+	tm.cleanUp()
+	assert.Equal(t, []interface{}{1, 2}, expired)
+	assert.Equal(t, 0, tm.Size())
+}
+
+func TestGracePeriodEntryTimers(t *testing.T) {
+	expired := make(chan interface{}, 1)
+	tm := NewWithOptions(0,
+		WithEntryTimers(),
+		WithGracePeriod(20*time.Millisecond),
+		WithExpireHandler(func(e Entry) { expired <- e.Key }))
+	defer tm.Close()
+
+	start := time.Now()
+	tm.Set(1, 1, 10*time.Millisecond)
+
+	select {
+	case key := <-expired:
+		assert.Equal(t, 1, key)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(30*time.Millisecond))
+	case <-time.After(time.Second):
+		t.Fatal("pair has not been expired")
+	}
+}
@@ -0,0 +1,102 @@
+package timedmap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyMutex provides mutual exclusion per key. Locks
+// which are not released within the lock TTL expire
+// automatically, so that abandoned locks can not
+// block other callers forever.
+type KeyMutex struct {
+	tm  *TimedMap
+	ttl time.Duration
+}
+
+// keyLock is the value stored for
+// a held lock in the map.
+type keyLock struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// NewKeyMutex creates and returns a new instance of
+// KeyMutex. Locks expire after the given ttl when not
+// released. cleanupTickTime is passed to the underlying
+// TimedMap.
+func NewKeyMutex(ttl, cleanupTickTime time.Duration) *KeyMutex {
+	return &KeyMutex{
+		tm:  New(cleanupTickTime),
+		ttl: ttl,
+	}
+}
+
+// LockKey blocks until the lock for the given key has been
+// acquired and returns the function releasing it. If ctx is
+// done before, the error of the context is returned.
+// After the KeyMutex has been closed, ErrClosed is
+// returned. If the lock could not be stored, the error
+// of the underlying map is returned, and ErrKeyExists if
+// the key holds a value which is not a lock.
+//
+// The returned unlock function can be called multiple times
+// safely. Calling it after the lock has expired has no
+// effect on locks acquired by other callers afterwards.
+func (m *KeyMutex) LockKey(ctx context.Context, key interface{}) (unlock func(), err error) {
+	for {
+		l := &keyLock{done: make(chan struct{})}
+		actual, loaded, err := m.tm.getOrSet(m.tm.key(key), 0, l, m.ttl, func(interface{}) {
+			l.release()
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !loaded {
+			return func() {
+				m.tm.compareAndRemove(m.tm.key(key), 0, l)
+				l.release()
+			}, nil
+		}
+
+		held, ok := actual.(*keyLock)
+		if !ok {
+			return nil, ErrKeyExists
+		}
+
+		wait := m.ttl
+		if exp, err := m.tm.GetExpires(key); err == nil {
+			wait = time.Until(exp)
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-held.done:
+		case <-timer.C:
+			// The held lock has expired but has not been
+			// cleaned up yet. The next GetOrSet call will
+			// expire it.
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		timer.Stop()
+	}
+}
+
+// Close stops the cleanup loop of the
+// underlying map.
+func (m *KeyMutex) Close() {
+	m.tm.Close()
+}
+
+// release wakes up all callers
+// waiting for the lock.
+func (l *keyLock) release() {
+	l.once.Do(func() {
+		close(l.done)
+	})
+}
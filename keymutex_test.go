@@ -0,0 +1,93 @@
+package timedmap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyMutex(t *testing.T) {
+	m := NewKeyMutex(time.Hour, 0)
+	defer m.Close()
+
+	var counter int
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := m.LockKey(context.Background(), "a")
+			assert.Nil(t, err)
+			c := counter
+			time.Sleep(100 * time.Microsecond)
+			counter = c + 1
+			unlock()
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 50, counter)
+
+	unlockA, err := m.LockKey(context.Background(), "a")
+	assert.Nil(t, err)
+
+	// Other keys are not blocked
+	unlockB, err := m.LockKey(context.Background(), "b")
+	assert.Nil(t, err)
+	unlockB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = m.LockKey(ctx, "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlockA()
+	assert.NotPanics(t, unlockA)
+}
+
+func TestKeyMutexExpiry(t *testing.T) {
+	m := NewKeyMutex(20*time.Millisecond, 0)
+	defer m.Close()
+
+	unlock1, err := m.LockKey(context.Background(), "a")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	unlock2, err := m.LockKey(ctx, "a")
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(15*time.Millisecond))
+
+	// Releasing the expired lock does not
+	// release the lock of another caller.
+	unlock1()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = m.LockKey(ctx, "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlock2()
+}
+
+func TestKeyMutexNotStored(t *testing.T) {
+	m := NewKeyMutex(time.Hour, 0)
+	defer m.Close()
+
+	m.tm.Set(1, "value", time.Hour)
+	_, err := m.LockKey(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	m.tm.Reconfigure(WithAdmissionHook(func(key, value interface{}, ttl time.Duration) (bool, time.Duration) {
+		return false, ttl
+	}))
+	_, err = m.LockKey(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrRejected)
+
+	m.Close()
+	_, err = m.LockKey(context.Background(), 3)
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,48 @@
+package timedmap
+
+import "time"
+
+// SetMaxLifetime caps the total lifetime of a key-value
+// pair to d after it has been set without existing before,
+// overriding the cap set using WithMaxLifetime. Neither
+// overwriting the value nor refreshing or sliding the
+// expiration extends the lifetime beyond the cap. A d of
+// 0 or less removes the cap of the pair. If there is no
+// value to the key passed, this will return an error.
+//
+// A pair whose cap has already passed expires at once.
+func (tm *TimedMap) SetMaxLifetime(key interface{}, d time.Duration) error {
+	return tm.setMaxLifetime(tm.key(key), 0, d)
+}
+
+// setMaxLifetime caps the lifetime of the element of
+// the given key in the given section to d.
+func (tm *TimedMap) setMaxLifetime(key interface{}, sec int, d time.Duration) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+
+	v.deadline = time.Time{}
+	if d > 0 {
+		v.deadline = v.created.Add(d)
+		v.capExpires()
+		tm.schedule(keyWrap{sec: sec, key: key}, v)
+	}
+	return nil
+}
+
+// capExpires limits the expiration time of the element
+// to its deadline, if set.
+func (v *element) capExpires() {
+	if !v.deadline.IsZero() && v.expires.After(v.deadline) {
+		v.expires = v.deadline
+	}
+}
@@ -0,0 +1,54 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxLifetime(t *testing.T) {
+	tm := NewWithOptions(0, WithMaxLifetime(time.Minute))
+
+	tm.Set(1, 1, time.Hour)
+	exp, err := tm.GetExpires(1)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Minute, time.Until(exp), float64(time.Second))
+
+	tm.Set(2, 2, time.Second)
+	assert.Nil(t, tm.Refresh(2, time.Hour))
+	assert.Nil(t, tm.SetExpires(2, NoExpiration))
+	tm.Set(2, 3, time.Hour)
+	exp, _ = tm.GetExpires(2)
+	assert.InDelta(t, time.Minute, time.Until(exp), float64(time.Second))
+
+	tm.Set(3, 3, time.Second)
+	exp, _ = tm.GetExpires(3)
+	assert.InDelta(t, time.Second, time.Until(exp), float64(time.Second))
+
+	assert.Nil(t, tm.SetMaxLifetime(1, 0))
+	assert.Nil(t, tm.SetExpires(1, time.Hour))
+	exp, _ = tm.GetExpires(1)
+	assert.InDelta(t, time.Hour, time.Until(exp), float64(time.Second))
+}
+
+func TestSetMaxLifetime(t *testing.T) {
+	tm := New(0)
+
+	assert.ErrorIs(t, tm.SetMaxLifetime(1, time.Second), ErrKeyNotFound)
+
+	tm.SetSliding(1, 1, time.Hour)
+	assert.Nil(t, tm.SetMaxLifetime(1, 20*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 1, tm.GetValue(1))
+	}
+	assert.Eventually(t, func() bool {
+		return !tm.Contains(1)
+	}, time.Second, time.Millisecond)
+
+	tm.Section(1).Set(1, 1, time.Hour)
+	assert.Nil(t, tm.Section(1).SetMaxLifetime(1, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, ok := tm.Section(1).TryGetValue(1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,412 @@
+package timedmap
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLoadTimeout is the maximum duration a value
+	// is loaded by a LoadingCache before all waiters
+	// receive ErrPromiseExpired.
+	DefaultLoadTimeout = 1 * time.Minute
+	// DefaultLoadingCacheCleanup is the default interval
+	// of the cleanup loop of a LoadingCache. It can be
+	// changed by passing WithCleanupInterval.
+	DefaultLoadingCacheCleanup = 1 * time.Minute
+)
+
+// Loader loads the value of a key which is missing
+// in a LoadingCache.
+type Loader func(ctx context.Context, key interface{}) (interface{}, error)
+
+// Peer looks up the entry of a key which is missing in a
+// LoadingCache in another instance, e.g. over the network
+// in the cache of a peer process. ok is false if the peer
+// does not hold a value for the key.
+type Peer func(ctx context.Context, key interface{}) (e Entry, ok bool, err error)
+
+// MapPeer returns a Peer looking up entries in the given
+// map, e.g. to warm a new cache from the map of a cache
+// which is being replaced within the same process.
+func MapPeer(tm *TimedMap) Peer {
+	return func(ctx context.Context, key interface{}) (Entry, bool, error) {
+		e, err := tm.GetEntry(key)
+		if err == ErrKeyNotFound {
+			return Entry{}, false, nil
+		}
+		return e, err == nil, err
+	}
+}
+
+// CacheStats contains the statistics of a LoadingCache.
+type CacheStats struct {
+	// Hits is the number of values which have
+	// been served from the cache.
+	Hits uint64
+	// Misses is the number of values which have
+	// not been present in the cache, including
+	// values which were being loaded.
+	Misses uint64
+	// Loads is the number of values which have
+	// been loaded successfully.
+	Loads uint64
+	// LoadErrors is the number of loads which
+	// returned an error.
+	LoadErrors uint64
+	// PeerHits is the number of missing values which
+	// have been imported from the peer of the cache.
+	PeerHits uint64
+	// Evictions is the number of values which have
+	// been evicted to stay within the capacity.
+	Evictions uint64
+	// Refreshes is the number of values which have
+	// been reloaded ahead of their expiration.
+	Refreshes uint64
+	// Size is the number of values currently
+	// held by the cache.
+	Size int
+}
+
+// LoadingCache is a cache built on a TimedMap which
+// loads missing values using a Loader. Concurrent gets
+// of a missing key share a single load.
+//
+// The number of values can be bounded using SetCapacity,
+// which evicts the least recently used values. Values can
+// be reloaded in the background before they expire using
+// SetRefreshAhead.
+type LoadingCache struct {
+	hits       uint64
+	misses     uint64
+	loads      uint64
+	loadErrors uint64
+	peerHits   uint64
+	evictions  uint64
+	refreshes  uint64
+
+	peer   atomic.Value
+	tm     *TimedMap
+	loader Loader
+	ttl    time.Duration
+
+	// ctx is the context of all loads, which is
+	// canceled when the cache is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx          sync.Mutex
+	capacity     int
+	refreshAhead time.Duration
+	recency      *list.List
+	entries      map[interface{}]*list.Element
+	refreshing   map[interface{}]struct{}
+}
+
+// NewLoadingCache creates a new LoadingCache which loads
+// missing values using loader and keeps them for ttl. The
+// given options are applied to the underlying map.
+func NewLoadingCache(loader Loader, ttl time.Duration, opts ...Option) *LoadingCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LoadingCache{
+		tm:         NewWithOptions(DefaultLoadingCacheCleanup, opts...),
+		loader:     loader,
+		ttl:        ttl,
+		ctx:        ctx,
+		cancel:     cancel,
+		recency:    list.New(),
+		entries:    make(map[interface{}]*list.Element),
+		refreshing: make(map[interface{}]struct{}),
+	}
+}
+
+// Get returns the value of key. If it is not present in
+// the cache, it is loaded using the loader, or the load of
+// a concurrent Get is awaited. Errors of the loader are
+// returned and not cached.
+//
+// Loads are not bound to ctx, so that a canceled Get
+// does not fail the load shared with other callers; only
+// waiting for the load is aborted when ctx is done.
+//
+// If the map normalizes keys, the loader and the peer
+// receive the normalized key.
+func (c *LoadingCache) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	key = c.tm.key(key)
+
+	val, p, err := c.tm.getOrSetPending(key, 0, DefaultLoadTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		if pending, ok := val.(*Promise); ok {
+			atomic.AddUint64(&c.misses, 1)
+			return pending.Wait(ctx)
+		}
+		atomic.AddUint64(&c.hits, 1)
+		c.touch(key)
+		c.maybeRefresh(key)
+		return val, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.load(key, p)
+	}()
+
+	select {
+	case <-done:
+		return p.Wait(ctx)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load settles p with the value of key, which is looked
+// up using the peer of the cache or loaded using the
+// loader.
+func (c *LoadingCache) load(key interface{}, p *Promise) {
+	ctx, cancel := context.WithDeadline(c.ctx, p.deadline)
+	defer cancel()
+
+	if e, ok := c.lookupPeer(ctx, key); ok {
+		atomic.AddUint64(&c.peerHits, 1)
+		p.Resolve(e.Value, time.Until(e.Expires), c.forgetter(key))
+		c.add(key)
+		return
+	}
+
+	val, err := c.loader(ctx, key)
+	if err != nil {
+		atomic.AddUint64(&c.loadErrors, 1)
+		p.Reject(err)
+		return
+	}
+	atomic.AddUint64(&c.loads, 1)
+	p.Resolve(val, c.ttl, c.forgetter(key))
+	c.add(key)
+}
+
+// SetCapacity limits the number of values held by the
+// cache to n. When a value is added to a full cache, the
+// least recently used value is evicted. A capacity of 0
+// or less removes the limit.
+func (c *LoadingCache) SetCapacity(n int) {
+	c.mtx.Lock()
+	c.capacity = n
+	evicted := c.evictLocked()
+	c.mtx.Unlock()
+
+	c.evict(evicted)
+}
+
+// SetRefreshAhead makes the cache reload values in the
+// background when they are read less than threshold
+// before they expire. The current value is served until
+// the reload has finished. Failed reloads are counted as
+// load errors and keep the current value. A threshold of
+// 0 or less disables refreshing.
+func (c *LoadingCache) SetRefreshAhead(threshold time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.refreshAhead = threshold
+}
+
+// touch marks key as most recently used.
+func (c *LoadingCache) touch(key interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.recency.MoveToFront(el)
+	}
+}
+
+// add marks key as most recently used and evicts the
+// least recently used values exceeding the capacity.
+func (c *LoadingCache) add(key interface{}) {
+	c.mtx.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.recency.MoveToFront(el)
+	} else {
+		c.entries[key] = c.recency.PushFront(key)
+	}
+	evicted := c.evictLocked()
+	c.mtx.Unlock()
+
+	c.evict(evicted)
+}
+
+// evictLocked removes the least recently used keys
+// exceeding the capacity from the recency list and
+// returns them.
+//
+// The caller must hold the lock of the cache.
+func (c *LoadingCache) evictLocked() (evicted []interface{}) {
+	if c.capacity <= 0 {
+		return
+	}
+	for c.recency.Len() > c.capacity {
+		key := c.recency.Remove(c.recency.Back())
+		delete(c.entries, key)
+		evicted = append(evicted, key)
+	}
+	return
+}
+
+// evict removes the values of the given evicted keys
+// from the map.
+//
+// The lock of the cache must not be held, as the map
+// calls back into the cache while holding its lock.
+func (c *LoadingCache) evict(keys []interface{}) {
+	if len(keys) == 0 {
+		return
+	}
+	atomic.AddUint64(&c.evictions, uint64(len(keys)))
+	c.tm.removeMulti(storedKey, 0, keys)
+}
+
+// forgetter returns the expiration callback of the value
+// of key, which removes key from the recency list.
+func (c *LoadingCache) forgetter(key interface{}) callback {
+	return func(interface{}) {
+		c.forget(key)
+	}
+}
+
+// forget removes the given keys from the recency list.
+func (c *LoadingCache) forget(keys ...interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.recency.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// maybeRefresh reloads the value of key in the background
+// if it expires within the refresh-ahead threshold and is
+// not being reloaded already.
+func (c *LoadingCache) maybeRefresh(key interface{}) {
+	c.mtx.Lock()
+	threshold := c.refreshAhead
+	_, running := c.refreshing[key]
+	c.mtx.Unlock()
+
+	if threshold <= 0 || running {
+		return
+	}
+	if ttl, err := c.tm.ttl(key, 0); err != nil || ttl >= threshold {
+		return
+	}
+
+	c.mtx.Lock()
+	if _, running = c.refreshing[key]; !running {
+		c.refreshing[key] = struct{}{}
+	}
+	c.mtx.Unlock()
+
+	if !running {
+		go c.refresh(key)
+	}
+}
+
+// refresh reloads the value of key and replaces the
+// current value on success.
+func (c *LoadingCache) refresh(key interface{}) {
+	defer func() {
+		c.mtx.Lock()
+		delete(c.refreshing, key)
+		c.mtx.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(c.ctx, DefaultLoadTimeout)
+	defer cancel()
+
+	val, err := c.loader(ctx, key)
+	if err != nil {
+		atomic.AddUint64(&c.loadErrors, 1)
+		return
+	}
+	atomic.AddUint64(&c.refreshes, 1)
+	c.tm.set(key, 0, val, c.ttl, c.forgetter(key))
+	c.add(key)
+}
+
+// SetPeer sets the Peer which is consulted on a miss before
+// the loader. Values found by the peer are imported with
+// their remaining lifetime. If the peer returns an error or
+// does not hold the value, it is loaded using the loader.
+// Passing nil removes the peer, e.g. once the cache has
+// been warmed up.
+func (c *LoadingCache) SetPeer(peer Peer) {
+	c.peer.Store(peerHolder{peer})
+}
+
+// peerHolder wraps a Peer, so that nil can be stored
+// in an atomic.Value.
+type peerHolder struct {
+	peer Peer
+}
+
+// lookupPeer looks up the entry of key using the peer
+// of the cache, if set. ok is false if the peer does not
+// hold a non-expired value or returned an error.
+func (c *LoadingCache) lookupPeer(ctx context.Context, key interface{}) (e Entry, ok bool) {
+	h, _ := c.peer.Load().(peerHolder)
+	if h.peer == nil {
+		return
+	}
+	e, ok, err := h.peer(ctx, key)
+	return e, ok && err == nil && time.Now().Before(e.Expires)
+}
+
+// Invalidate removes the values of the given keys from
+// the cache, so that they are loaded again on the next
+// Get.
+func (c *LoadingCache) Invalidate(keys ...interface{}) {
+	stored := make([]interface{}, len(keys))
+	for i, key := range keys {
+		stored[i] = c.tm.key(key)
+	}
+	c.forget(stored...)
+	c.tm.removeMulti(storedKey, 0, stored)
+}
+
+// Stats returns the statistics of the cache.
+func (c *LoadingCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:       atomic.LoadUint64(&c.hits),
+		Misses:     atomic.LoadUint64(&c.misses),
+		Loads:      atomic.LoadUint64(&c.loads),
+		LoadErrors: atomic.LoadUint64(&c.loadErrors),
+		PeerHits:   atomic.LoadUint64(&c.peerHits),
+		Evictions:  atomic.LoadUint64(&c.evictions),
+		Refreshes:  atomic.LoadUint64(&c.refreshes),
+		Size:       c.tm.SizeLive(),
+	}
+}
+
+// Map returns the TimedMap backing the cache.
+func (c *LoadingCache) Map() *TimedMap {
+	return c.tm
+}
+
+// Close cancels all running loads and closes the
+// map backing the cache.
+func (c *LoadingCache) Close() {
+	c.cancel()
+	c.tm.Close()
+}
@@ -0,0 +1,255 @@
+package timedmap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadingCache(t *testing.T) {
+	var calls int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return key.(int) * 2, nil
+	}, time.Hour)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get(context.Background(), 1)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, v)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	v, err := c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, v)
+
+	s := c.Stats()
+	assert.EqualValues(t, 1, s.Loads)
+	assert.EqualValues(t, 11, s.Hits+s.Misses)
+	assert.GreaterOrEqual(t, s.Hits, uint64(1))
+	assert.Equal(t, 1, s.Size)
+
+	c.Invalidate(1)
+	_, err = c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	assert.Equal(t, c.Map().Size(), 1)
+}
+
+func TestLoadingCacheError(t *testing.T) {
+	errLoad := errors.New("load failed")
+	var calls int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errLoad
+	}, time.Hour)
+	defer c.Close()
+
+	_, err := c.Get(context.Background(), 1)
+	assert.ErrorIs(t, err, errLoad)
+	_, err = c.Get(context.Background(), 1)
+	assert.ErrorIs(t, err, errLoad)
+
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	assert.EqualValues(t, 2, c.Stats().LoadErrors)
+	assert.Zero(t, c.Stats().Size)
+
+	c.Close()
+	_, err = c.Get(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestLoadingCachePeer(t *testing.T) {
+	old := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		return "old", nil
+	}, time.Hour)
+	defer old.Close()
+	_, err := old.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	old.Map().Set(2, "expired", 0)
+
+	var loads int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return "loaded", nil
+	}, time.Minute)
+	defer c.Close()
+	c.SetPeer(MapPeer(old.Map()))
+
+	val, err := c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", val)
+	ttl, err := c.Map().TTL(1)
+	assert.Nil(t, err)
+	assert.Greater(t, ttl, 59*time.Minute)
+
+	for _, key := range []int{2, 3} {
+		val, err = c.Get(context.Background(), key)
+		assert.Nil(t, err)
+		assert.Equal(t, "loaded", val)
+	}
+
+	c.SetPeer(func(ctx context.Context, key interface{}) (Entry, bool, error) {
+		return Entry{}, false, errors.New("unavailable")
+	})
+	val, err = c.Get(context.Background(), 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", val)
+
+	c.SetPeer(nil)
+	c.Invalidate(1)
+	val, err = c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded", val)
+
+	assert.EqualValues(t, 4, atomic.LoadInt32(&loads))
+	assert.EqualValues(t, 1, c.Stats().PeerHits)
+}
+
+func TestLoadingCacheEviction(t *testing.T) {
+	var loads int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return key, nil
+	}, time.Hour)
+	defer c.Close()
+	c.SetCapacity(3)
+
+	for _, key := range []int{1, 2, 3, 1, 4} {
+		_, err := c.Get(context.Background(), key)
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, 4, atomic.LoadInt32(&loads))
+	assert.False(t, c.Map().Contains(2))
+	for _, key := range []int{1, 3, 4} {
+		assert.True(t, c.Map().Contains(key))
+	}
+
+	_, err := c.Get(context.Background(), 5)
+	assert.Nil(t, err)
+	assert.False(t, c.Map().Contains(3))
+
+	c.SetCapacity(1)
+	assert.Equal(t, 1, c.Stats().Size)
+	assert.True(t, c.Map().Contains(5))
+	assert.EqualValues(t, 4, c.Stats().Evictions)
+
+	c.Invalidate(5)
+	_, err = c.Get(context.Background(), 6)
+	assert.Nil(t, err)
+	assert.True(t, c.Map().Contains(6))
+	assert.EqualValues(t, 4, c.Stats().Evictions)
+}
+
+func TestLoadingCacheRefreshAhead(t *testing.T) {
+	var loads int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		return atomic.AddInt32(&loads, 1), nil
+	}, 100*time.Millisecond)
+	defer c.Close()
+	c.SetRefreshAhead(50 * time.Millisecond)
+
+	val, err := c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, val)
+
+	val, err = c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, val)
+	assert.Zero(t, c.Stats().Refreshes)
+
+	time.Sleep(60 * time.Millisecond)
+	val, err = c.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, val)
+
+	assert.Eventually(t, func() bool {
+		return c.Map().GetValue(1) == int32(2)
+	}, time.Second, 5*time.Millisecond)
+	assert.EqualValues(t, 1, c.Stats().Refreshes)
+
+	ttl, err := c.Map().TTL(1)
+	assert.Nil(t, err)
+	assert.Greater(t, ttl, 50*time.Millisecond)
+}
+
+func TestLoadingCacheCanceledGet(t *testing.T) {
+	release := make(chan struct{})
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		select {
+		case <-release:
+			return "loaded", ctx.Err()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, time.Hour)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, 1)
+		errs <- err
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, pending := c.Map().GetValue(1).(*Promise)
+		return pending
+	}, time.Second, time.Millisecond)
+
+	waiter := make(chan interface{})
+	go func() {
+		val, _ := c.Get(context.Background(), 1)
+		waiter <- val
+	}()
+
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	close(release)
+	assert.Equal(t, "loaded", <-waiter)
+	assert.Equal(t, "loaded", c.Map().GetValue(1))
+}
+
+func TestLoadingCacheNormalizedKeys(t *testing.T) {
+	var loads int32
+	c := NewLoadingCache(func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return key, nil
+	}, time.Hour, WithKeyNormalizer(func(key interface{}) interface{} {
+		return strings.ToLower(key.(string))
+	}))
+	defer c.Close()
+	c.SetCapacity(2)
+
+	for _, key := range []string{"A", "a", "B", "A", "C"} {
+		_, err := c.Get(context.Background(), key)
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&loads))
+	assert.True(t, c.Map().Contains("a"))
+	assert.False(t, c.Map().Contains("b"))
+	assert.True(t, c.Map().Contains("c"))
+	assert.EqualValues(t, 1, c.Stats().Evictions)
+
+	c.Invalidate("C")
+	assert.False(t, c.Map().Contains("c"))
+	c.mtx.Lock()
+	assert.Len(t, c.entries, 1)
+	c.mtx.Unlock()
+}
@@ -0,0 +1,144 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	// maintenanceMinSize is the minimum capacity or peak
+	// size of an index before it is compacted by a
+	// maintenance pass.
+	maintenanceMinSize = 64
+	// maintenanceShrinkFactor is the factor by which an
+	// index must be larger than its contents before it
+	// is compacted by a maintenance pass.
+	maintenanceShrinkFactor = 4
+)
+
+// MaintenanceStats contains the statistics of the
+// maintenance passes of a TimedMap.
+type MaintenanceStats struct {
+	// Runs is the number of maintenance passes run.
+	Runs uint64
+	// KeySlots is the number of unused slots released
+	// from the keys index of the map.
+	KeySlots uint64
+	// MapRebuilds is the number of times the underlying
+	// map storing the elements has been rebuilt.
+	MapRebuilds uint64
+	// Skipped is the number of compactions deferred as
+	// they would have exceeded the budget of a pass.
+	Skipped uint64
+	// ReclaimedBytes is an estimate of the memory
+	// released by all maintenance passes, based on the
+	// size of the index slots. The actual overhead of
+	// the underlying map is not accounted for.
+	ReclaimedBytes uint64
+}
+
+// Maintain runs a maintenance pass immediately, which
+// compacts the internal indexes of the map after a large
+// share of its key-value pairs has been removed and
+// prunes the expired backoff state of negative results.
+// At most budget index entries are copied by the pass;
+// a budget of 0 or less means no limit.
+//
+// A compaction exceeding the budget is deferred, and the
+// unused budget of the pass is carried over to the next
+// passes until it covers the compaction. This way, an
+// oversized map is compacted even when it holds more
+// pairs than the budget of a single pass.
+//
+// Without maintenance, the memory of the indexes stays
+// allocated at the peak size of the map.
+func (tm *TimedMap) Maintain(budget int) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.maintain(budget)
+}
+
+// maintain compacts the keys index and the container
+// of the map when they are oversized, copying at most
+// budget entries plus the budget carried over from
+// previous passes which deferred a compaction.
+//
+// The write lock of the map must be held.
+func (tm *TimedMap) maintain(budget int) {
+	s, _ := tm.maintenance.Load().(MaintenanceStats)
+	s.Runs++
+
+	tm.pruneNegatives(time.Now())
+
+	limited := budget > 0
+	if limited {
+		budget += tm.maintenanceCredit
+	}
+	tm.maintenanceCredit = 0
+
+	fits := func(n int) bool {
+		if !limited {
+			return true
+		}
+		if n > budget {
+			s.Skipped++
+			tm.maintenanceCredit = budget
+			return false
+		}
+		budget -= n
+		return true
+	}
+
+	n := len(tm.keys)
+	if c := cap(tm.keys); oversized(c, n) && fits(n) {
+		keys := make([]keyWrap, n, 2*n)
+		copy(keys, tm.keys)
+		tm.keys = keys
+		s.KeySlots += uint64(c - cap(keys))
+		s.ReclaimedBytes += uint64(c-cap(keys)) * uint64(unsafe.Sizeof(keyWrap{}))
+	}
+
+	n = len(tm.container)
+	if oversized(tm.peak, n) && fits(n) {
+		container := make(map[keyWrap]*element, n)
+		for k, v := range tm.container {
+			container[k] = v
+		}
+		s.MapRebuilds++
+		s.ReclaimedBytes += uint64(tm.peak-n) *
+			uint64(unsafe.Sizeof(keyWrap{})+unsafe.Sizeof(&element{}))
+		tm.container = container
+		tm.peak = n
+	}
+
+	tm.maintenance.Store(s)
+}
+
+// oversized returns true when an index of the given
+// size holding n entries shall be compacted.
+func oversized(size, n int) bool {
+	return size >= maintenanceMinSize && size > maintenanceShrinkFactor*n
+}
+
+// maintenanceLoop runs a maintenance pass with the
+// given budget on each tick of tc until the map is
+// closed. The goroutine running the loop is counted
+// by the caller.
+func (tm *TimedMap) maintenanceLoop(tc <-chan time.Time, budget int) {
+	defer atomic.AddInt32(tm.goroutines, -1)
+
+	for {
+		select {
+		case <-tc:
+			tm.Maintain(budget)
+		case <-tm.maintenanceStop:
+			return
+		}
+	}
+}
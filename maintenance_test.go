@@ -0,0 +1,114 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintain(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 1000; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	for i := 10; i < 1000; i++ {
+		tm.Remove(i)
+	}
+
+	tm.Maintain(100)
+	s := tm.Stats().Maintenance
+	assert.EqualValues(t, 1, s.Runs)
+	assert.EqualValues(t, 1, s.MapRebuilds)
+	assert.NotZero(t, s.KeySlots)
+	assert.NotZero(t, s.ReclaimedBytes)
+	assert.Zero(t, s.Skipped)
+	assert.LessOrEqual(t, cap(tm.keys), 20)
+	assert.Equal(t, 10, tm.peak)
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, i, tm.GetValue(i))
+		assert.Equal(t, tm.keys[tm.container[keyWrap{0, i}].idx].key, i)
+	}
+
+	tm.Maintain(0)
+	assert.Equal(t, s.MapRebuilds, tm.Stats().Maintenance.MapRebuilds)
+	assert.EqualValues(t, 2, tm.Stats().Maintenance.Runs)
+}
+
+func TestMaintainBudget(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 1000; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	for i := 100; i < 1000; i++ {
+		tm.Remove(i)
+	}
+
+	tm.Maintain(150)
+	s := tm.Stats().Maintenance
+	assert.NotZero(t, s.KeySlots)
+	assert.Zero(t, s.MapRebuilds)
+	assert.EqualValues(t, 1, s.Skipped)
+
+	tm.Maintain(150)
+	assert.EqualValues(t, 1, tm.Stats().Maintenance.MapRebuilds)
+}
+
+func TestWithMaintenance(t *testing.T) {
+	tm := NewWithOptions(0, WithMaintenance(time.Millisecond, 0))
+
+	for i := 0; i < 100; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Flush()
+
+	assert.Eventually(t, func() bool {
+		return tm.Stats().Maintenance.MapRebuilds == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, tm.Resources().Tickers)
+
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources() == Resources{}
+	}, time.Second, time.Millisecond)
+}
+
+func TestMaintainOverBudget(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 1000; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	for i := 200; i < 1000; i++ {
+		tm.Remove(i)
+	}
+
+	for i := 0; i < 3; i++ {
+		tm.Maintain(50)
+	}
+	s := tm.Stats().Maintenance
+	assert.Zero(t, s.KeySlots)
+	assert.Zero(t, s.MapRebuilds)
+	assert.EqualValues(t, 6, s.Skipped)
+
+	tm.Maintain(50)
+	s = tm.Stats().Maintenance
+	assert.NotZero(t, s.KeySlots)
+	assert.Zero(t, s.MapRebuilds)
+	assert.LessOrEqual(t, cap(tm.keys), 400)
+
+	for i := 0; i < 4; i++ {
+		tm.Maintain(50)
+	}
+	s = tm.Stats().Maintenance
+	assert.EqualValues(t, 1, s.MapRebuilds)
+	assert.Equal(t, 200, tm.peak)
+	assert.Zero(t, tm.maintenanceCredit)
+
+	for i := 0; i < 200; i++ {
+		assert.Equal(t, i, tm.GetValue(i))
+	}
+}
@@ -0,0 +1,113 @@
+package timedmap
+
+import "time"
+
+const (
+	// DefaultNegativeBackoffBase is the default duration
+	// a negative result is cached after the first miss.
+	DefaultNegativeBackoffBase = 1 * time.Second
+	// DefaultNegativeBackoffMax is the default maximum
+	// duration a negative result is cached for.
+	DefaultNegativeBackoffMax = 5 * time.Minute
+)
+
+// negative contains the backoff state of a key
+// for which negative results have been recorded.
+type negative struct {
+	misses int
+	until  time.Time
+}
+
+// SetNegative records a negative result, e.g. a missing
+// key in a backend, for the given key and returns the
+// duration it is cached for. Each consecutive negative
+// result for the key doubles the duration, starting at
+// the base up to the maximum duration configured using
+// WithNegativeBackoff.
+//
+// Setting a value for the key resets the backoff. When
+// no negative result has been recorded for the maximum
+// duration after the last one has expired, the backoff
+// is reset as well.
+func (tm *TimedMap) SetNegative(key interface{}) time.Duration {
+	return tm.setNegative(tm.key(key), 0)
+}
+
+// IsNegative returns true if a negative result recorded
+// for the given key using SetNegative is still cached.
+func (tm *TimedMap) IsNegative(key interface{}) bool {
+	return tm.isNegative(tm.key(key), 0)
+}
+
+// setNegative records a negative result for the
+// key in section sec and returns its duration.
+func (tm *TimedMap) setNegative(key interface{}, sec int) time.Duration {
+	if tm.checkClosed() != nil {
+		return 0
+	}
+
+	now := time.Now()
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if tm.negatives == nil {
+		tm.negatives = make(map[keyWrap]*negative)
+	}
+
+	n, ok := tm.negatives[k]
+	if !ok || tm.negativeStale(n, now) {
+		n = new(negative)
+		tm.negatives[k] = n
+	}
+
+	d := tm.negativeBase
+	for i := 0; i < n.misses && d < tm.negativeMax; i++ {
+		d *= 2
+	}
+	if d > tm.negativeMax {
+		d = tm.negativeMax
+	}
+
+	n.misses++
+	n.until = now.Add(d)
+	return d
+}
+
+// isNegative returns true if a negative result for
+// the key in section sec is cached.
+func (tm *TimedMap) isNegative(key interface{}, sec int) bool {
+	if tm.checkClosed() != nil {
+		return false
+	}
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	n, ok := tm.negatives[keyWrap{sec: sec, key: key}]
+	return ok && time.Now().Before(n.until)
+}
+
+// negativeStale returns true when the backoff of n
+// shall be reset as no negative result has been
+// recorded for the maximum duration after it expired.
+func (tm *TimedMap) negativeStale(n *negative, now time.Time) bool {
+	return now.After(n.until.Add(tm.negativeMax))
+}
+
+// pruneNegatives removes the backoff state of all
+// keys which would be reset by the next negative
+// result.
+//
+// The write lock of the map must be held.
+func (tm *TimedMap) pruneNegatives(now time.Time) {
+	for k, n := range tm.negatives {
+		if tm.negativeStale(n, now) {
+			delete(tm.negatives, k)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNegative(t *testing.T) {
+	tm := NewWithOptions(0, WithNegativeBackoff(time.Second, 5*time.Second))
+
+	assert.False(t, tm.IsNegative(1))
+	assert.Equal(t, time.Second, tm.SetNegative(1))
+	assert.True(t, tm.IsNegative(1))
+	assert.False(t, tm.Section(1).IsNegative(1))
+
+	assert.Equal(t, 2*time.Second, tm.SetNegative(1))
+	assert.Equal(t, 4*time.Second, tm.SetNegative(1))
+	assert.Equal(t, 5*time.Second, tm.SetNegative(1))
+	assert.Equal(t, 5*time.Second, tm.SetNegative(1))
+
+	tm.Set(1, 1, time.Hour)
+	assert.False(t, tm.IsNegative(1))
+	assert.Equal(t, time.Second, tm.SetNegative(1))
+
+	assert.Equal(t, time.Second, tm.Section(1).SetNegative(1))
+	assert.True(t, tm.Section(1).IsNegative(1))
+}
+
+func TestSetNegativeReset(t *testing.T) {
+	tm := NewWithOptions(0, WithNegativeBackoff(10*time.Millisecond, 20*time.Millisecond))
+
+	assert.Equal(t, 10*time.Millisecond, tm.SetNegative(1))
+	assert.Equal(t, 20*time.Millisecond, tm.SetNegative(1))
+	time.Sleep(25 * time.Millisecond)
+	assert.False(t, tm.IsNegative(1))
+	assert.Equal(t, 20*time.Millisecond, tm.SetNegative(1))
+
+	tm.SetNegative(2)
+	time.Sleep(50 * time.Millisecond)
+	tm.cleanUp()
+	assert.Empty(t, tm.negatives)
+	assert.Equal(t, 10*time.Millisecond, tm.SetNegative(1))
+
+	tm.Flush()
+	assert.False(t, tm.IsNegative(1))
+}
@@ -0,0 +1,30 @@
+package timedmap
+
+import (
+	"reflect"
+)
+
+// addNumeric adds delta to the numeric value v and
+// returns the result in the type of v. If v is not
+// numeric, false is returned.
+func addNumeric(v interface{}, delta int64) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, false
+	}
+
+	res := reflect.New(rv.Type()).Elem()
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		res.SetInt(rv.Int() + delta)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		res.SetUint(rv.Uint() + uint64(delta))
+	case reflect.Float32, reflect.Float64:
+		res.SetFloat(rv.Float() + float64(delta))
+	default:
+		return nil, false
+	}
+
+	return res.Interface(), true
+}
@@ -0,0 +1,80 @@
+package timedmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddNumeric(t *testing.T) {
+	type myInt int
+
+	cases := []struct {
+		v, res interface{}
+		delta  int64
+	}{
+		{1, 3, 2},
+		{int8(1), int8(0), -1},
+		{int64(5), int64(10), 5},
+		{uint(5), uint(4), -1},
+		{uint32(5), uint32(6), 1},
+		{1.5, 2.5, 1},
+		{float32(1.5), float32(0.5), -1},
+		{myInt(1), myInt(2), 1},
+	}
+
+	for _, c := range cases {
+		res, ok := addNumeric(c.v, c.delta)
+		assert.True(t, ok)
+		assert.Equal(t, c.res, res)
+	}
+
+	_, ok := addNumeric("foo", 1)
+	assert.False(t, ok)
+	_, ok = addNumeric(nil, 1)
+	assert.False(t, ok)
+}
+
+func TestIncrement(t *testing.T) {
+	tm := New(0)
+
+	_, err := tm.Increment(1, 1, KeepTTL)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	v, err := tm.Increment(1, 2, time.Hour)
+	assert.Nil(t, err)
+	assert.EqualValues(t, int64(2), v)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm.Increment(1, 1, KeepTTL)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, int64(102), tm.GetValue(1))
+
+	v, err = tm.Decrement(1, 100, time.Hour)
+	assert.Nil(t, err)
+	assert.EqualValues(t, int64(2), v)
+
+	tm.Set(2, 1.5, time.Hour)
+	v, err = tm.Increment(2, 1, KeepTTL)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2.5, v)
+
+	tm.Set(3, "foo", time.Hour)
+	_, err = tm.Increment(3, 1, KeepTTL)
+	assert.ErrorIs(t, err, ErrValueNotNumeric)
+
+	s := tm.Section(1)
+	s.Set(1, 10, time.Hour)
+	v, err = s.Decrement(1, 3, KeepTTL)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7, v)
+	assert.EqualValues(t, int64(2), tm.GetValue(1))
+}
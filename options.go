@@ -0,0 +1,512 @@
+package timedmap
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultMaxHoldDuration is the default maximum
+// duration a key-value pair can be held using Hold.
+const DefaultMaxHoldDuration = 1 * time.Minute
+
+// DefaultMaxCallbacks is the default maximum number
+// of callbacks a key-value pair can hold after
+// adding callbacks using AddCallback.
+const DefaultMaxCallbacks = 64
+
+// Option defines a function which applies
+// a configuration to a TimedMap instance.
+type Option func(tm *TimedMap)
+
+// AdmissionHook is consulted on each value set in a
+// map with the key as stored in the map, the value and
+// the expiration duration, which is KeepTTL when the
+// current expiration shall be kept. If allow is false,
+// the value is not set. Otherwise, the value is set
+// with the returned expiration duration newTTL.
+//
+// The hook is called while the write lock of the map
+// is held, so it must not access the map.
+type AdmissionHook func(key, value interface{}, ttl time.Duration) (allow bool, newTTL time.Duration)
+
+// RefreshPolicy defines how Refresh and SetExpires
+// handle key-value pairs which have already expired
+// but were not yet removed by the cleanup loop.
+type RefreshPolicy int
+
+const (
+	// RefreshRejectExpired expires and removes the
+	// key-value pair and returns ErrKeyNotFound.
+	// This is the default policy.
+	RefreshRejectExpired RefreshPolicy = iota
+
+	// RefreshResurrect applies the new expiration
+	// time to the key-value pair as long as it was
+	// not yet removed from the map.
+	RefreshResurrect
+)
+
+// ClosedPolicy defines how operations on a TimedMap
+// and its sections behave after the map has been
+// closed.
+type ClosedPolicy int
+
+const (
+	// ClosedError lets operations returning an error
+	// return ErrClosed. All other operations have no
+	// effect and return empty results. This is the
+	// default policy.
+	ClosedError ClosedPolicy = iota
+
+	// ClosedPanic lets all operations panic with
+	// ErrClosed.
+	ClosedPanic
+)
+
+// StaleSectionPolicy defines how Section instances
+// behave after their section has been deleted using
+// DeleteSection.
+type StaleSectionPolicy int
+
+const (
+	// StaleSectionError lets operations on the Section
+	// instance return ErrSectionDeleted. Operations not
+	// returning an error have no effect and return empty
+	// results. This is the default policy.
+	StaleSectionError StaleSectionPolicy = iota
+
+	// StaleSectionRebind binds the Section instance to
+	// the newly created section with the same identifier,
+	// so that operations are performed on it.
+	StaleSectionRebind
+)
+
+// WithRefreshPolicy sets the RefreshPolicy which is
+// applied on Refresh and SetExpires calls.
+func WithRefreshPolicy(p RefreshPolicy) Option {
+	return func(tm *TimedMap) {
+		tm.refreshPolicy = p
+	}
+}
+
+// WithMaxHoldDuration sets the maximum duration a
+// key-value pair can be held using Hold before it
+// can expire regardless of being released.
+func WithMaxHoldDuration(d time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.maxHold = d
+	}
+}
+
+// WithMaxCallbacks sets the maximum number of callbacks
+// a key-value pair can hold after adding callbacks using
+// AddCallback. Passing 0 removes the limit.
+func WithMaxCallbacks(n int) Option {
+	return func(tm *TimedMap) {
+		tm.maxCallbacks = n
+	}
+}
+
+// WithKeyNormalizer sets a function which is applied
+// on every key passed to the map and its sections
+// before accessing the container, e.g. to lower-case
+// string keys. Keys returned by the map, like in
+// Snapshot, are the normalized keys.
+func WithKeyNormalizer(fn func(key interface{}) interface{}) Option {
+	return func(tm *TimedMap) {
+		tm.normalizeKey = fn
+	}
+}
+
+// WithLatencyTracking enables recording the latencies
+// of set and get operations and cleanup cycles, which
+// can be retrieved using Stats.
+func WithLatencyTracking() Option {
+	return func(tm *TimedMap) {
+		tm.latencies = new(latencyTracker)
+	}
+}
+
+// WithClosedPolicy sets the ClosedPolicy which defines
+// the behavior of operations after Close.
+func WithClosedPolicy(p ClosedPolicy) Option {
+	return func(tm *TimedMap) {
+		tm.closedPolicy = p
+	}
+}
+
+// WithStaleSectionPolicy sets the StaleSectionPolicy
+// which defines the behavior of Section instances after
+// their section has been deleted.
+func WithStaleSectionPolicy(p StaleSectionPolicy) Option {
+	return func(tm *TimedMap) {
+		tm.staleSectionPolicy = p
+	}
+}
+
+// WithEntryTimers enables a dedicated timer for each
+// key-value pair which expires it exactly at its
+// expiration time. The cleanup loop is not started
+// in this mode, so that no periodic work is done.
+//
+// This is intended for maps holding only a small
+// number of key-value pairs.
+func WithEntryTimers() Option {
+	return func(tm *TimedMap) {
+		tm.entryTimers = true
+	}
+}
+
+// WithValueEqual sets the function used to determine
+// if a value set for an existing key equals its current
+// value. In this case, the current value is kept together
+// with its warnings, decay and soft expiration, only the
+// expiration time and callbacks are updated and the key
+// is not reported as replaced by SetReported.
+func WithValueEqual(equal func(a, b interface{}) bool) Option {
+	return func(tm *TimedMap) {
+		tm.valueEqual = equal
+	}
+}
+
+// WithAdmissionHook sets the AdmissionHook which is
+// consulted on each value set in the map to reject
+// values or to rewrite their expiration duration.
+func WithAdmissionHook(hook AdmissionHook) Option {
+	return func(tm *TimedMap) {
+		tm.admit = hook
+	}
+}
+
+// WithTTLRules sets the function which returns the
+// expiration duration for a key, as stored in the map,
+// when DefaultTTL is passed as expiration duration. When
+// the function returns DefaultTTL, the default TTL set
+// using WithDefaultTTL is used.
+//
+// The function is called while the write lock of the
+// map is held, so it must not access the map.
+func WithTTLRules(rules func(key interface{}) time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.ttlRules = rules
+	}
+}
+
+// WithExpireHandler sets a handler which is called with
+// the entry of each key-value pair of all sections expiring
+// in the map, after its callbacks have been executed.
+//
+// Each expiration is delivered exactly once, regardless of
+// it being caused by the cleanup loop, by a read of the
+// expired pair or by Expire. Removed or flushed pairs are
+// not passed to the handler.
+//
+// The handler is called while the write lock of the map
+// is held, so it must not access the map.
+func WithExpireHandler(fn func(e Entry)) Option {
+	return func(tm *TimedMap) {
+		tm.onExpire = fn
+	}
+}
+
+// WithMaintenance starts a background loop which runs a
+// maintenance pass with the given budget every interval,
+// compacting the internal indexes of the map after a
+// large share of its key-value pairs has been removed.
+// See Maintain for the meaning of budget.
+//
+// The loop is stopped when the map is closed.
+func WithMaintenance(interval time.Duration, budget int) Option {
+	return func(tm *TimedMap) {
+		tm.maintenanceInterval = interval
+		tm.maintenanceBudget = budget
+	}
+}
+
+// WithScrubber starts a background loop which runs a
+// scrub pass with the given budget every interval,
+// validating the internal indexes and counters of the
+// map against its key-value pairs and repairing any
+// drift found. See Scrub for the meaning of budget.
+//
+// Each repaired drift is passed to handler, if not nil.
+// The handler is called while the write lock of the map
+// is held, so it must not access the map.
+//
+// The loop is stopped when the map is closed.
+func WithScrubber(interval time.Duration, budget int, handler func(d Drift)) Option {
+	return func(tm *TimedMap) {
+		tm.scrubInterval = interval
+		tm.scrubBudget = budget
+		tm.scrubHandler = handler
+	}
+}
+
+// WithAsyncCallbacks makes the map execute the callbacks
+// and the expire handler of expired key-value pairs in a
+// background goroutine instead of the goroutine expiring
+// them, so that callbacks may access the map. At most
+// queueSize expirations are queued; when the queue is
+// full, policy decides how further expirations are
+// handled. Warning, soft expiration and finalizer
+// callbacks are still executed synchronously.
+//
+// With OverflowBlock, expirations block while the write
+// lock of the map is held until the queue has room, so
+// callbacks which access the map can stall it when the
+// queue is full.
+//
+// The goroutine is stopped when the map is closed after
+// dispatching all expirations queued until then.
+func WithAsyncCallbacks(queueSize int, policy OverflowPolicy) Option {
+	return func(tm *TimedMap) {
+		tm.asyncQueue = queueSize
+		tm.overflowPolicy = policy
+	}
+}
+
+// WithSizer sets the function which returns the cost,
+// e.g. the approximate size in bytes, of a key-value
+// pair. The cost is determined each time a value is set
+// and is reported by LargestEntries.
+//
+// The function is called while the write lock of the
+// map is held, so it must not access the map.
+func WithSizer(sizer func(key, value interface{}) int) Option {
+	return func(tm *TimedMap) {
+		tm.sizer = sizer
+	}
+}
+
+// WithNegativeBackoff sets the duration negative results
+// recorded using SetNegative are cached for after the first
+// miss of a key, and the maximum duration the backoff grows
+// to on consecutive misses.
+//
+// Defaults to DefaultNegativeBackoffBase and
+// DefaultNegativeBackoffMax.
+func WithNegativeBackoff(base, max time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.negativeBase = base
+		tm.negativeMax = max
+	}
+}
+
+// WithReplaceOnRename makes Rename replace an existing
+// key-value pair of the new key instead of returning
+// ErrKeyExists. The callbacks of the replaced pair are
+// not executed.
+func WithReplaceOnRename() Option {
+	return func(tm *TimedMap) {
+		tm.replaceOnRename = true
+	}
+}
+
+// WithStrictChecks enables the strict mode of the map,
+// which detects the misuse patterns listed by MisuseKind
+// at runtime and reports them using the standard logger.
+//
+// As Go maps use randomized hashing, keys with
+// pathological hash collisions can not occur and are
+// not detected.
+//
+// Strict mode adds overhead to callbacks and snapshots
+// and is intended for debugging and integration.
+func WithStrictChecks() Option {
+	return func(tm *TimedMap) {
+		if tm.strict == nil {
+			tm.strict = new(strictChecks)
+		}
+	}
+}
+
+// WithMisuseHandler enables the strict mode of the map
+// like WithStrictChecks and reports detected misuses to
+// the given handler instead of the standard logger.
+//
+// The handler may be called while the write lock of the
+// map is held, so it must not access the map.
+func WithMisuseHandler(handler func(m Misuse)) Option {
+	return func(tm *TimedMap) {
+		WithStrictChecks()(tm)
+		tm.strict.report = handler
+	}
+}
+
+// WithCleanupInterval sets the interval of the internal
+// cleanup loop, overriding the cleanupTickTime passed on
+// creation. An interval of 0 disables the internal loop.
+//
+// This is mostly useful in combination with Reconfigure
+// to change the interval of a running map.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.cleanupTickTime = interval
+	}
+}
+
+// WithProvenance enables recording the caller passed to
+// SetBy and SetContext with each key-value pair. Values
+// set by other operations are recorded without caller.
+func WithProvenance() Option {
+	return func(tm *TimedMap) {
+		tm.provenance = true
+	}
+}
+
+// WithSectionQuota sets the maximum number of key-value
+// pairs each section of the map can hold. Values of new
+// keys set in a section which has reached the quota are
+// rejected. Expired key-value pairs which were not yet
+// removed by the cleanup loop are counted as well.
+//
+// Use SetHeadroom to be notified about the remaining
+// quota of a section.
+func WithSectionQuota(max int) Option {
+	return func(tm *TimedMap) {
+		tm.quota = max
+	}
+}
+
+// WithDefaultTTL sets the expiration duration used when
+// DefaultTTL is passed as expiration duration, e.g. by
+// SetDefault and Touch, and the TTL rules of the map do
+// not define one for the key.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.defaultExpiration = d
+	}
+}
+
+// WithDeterministicOrder makes Range, the snapshot
+// functions, the key and value listings and the cleanup
+// iterate the key-value pairs ordered by section and key
+// instead of in the random order of Go maps. This makes
+// the order of callbacks executed by the cleanup and of
+// snapshots written by WriteSnapshot reproducible, e.g.
+// for golden-file tests.
+//
+// Keys are ordered by their type first, then numbers
+// and strings by value and all other keys by their
+// default formatting. As each iteration sorts the keys
+// of the map, this option is intended for tests and
+// debugging.
+func WithDeterministicOrder() Option {
+	return func(tm *TimedMap) {
+		tm.ordered = true
+	}
+}
+
+// WithSlidingExpiration makes each key-value pair expire
+// after not being read for its expiration duration, like
+// when set using SetSliding. Values set with KeepTTL keep
+// the sliding expiration of the pair.
+func WithSlidingExpiration() Option {
+	return func(tm *TimedMap) {
+		tm.sliding = true
+	}
+}
+
+// WithMaxLifetime caps the total lifetime of each key-value
+// pair to d after it has been set without existing before.
+// Neither overwriting the value nor refreshing or sliding
+// the expiration extends the lifetime of a pair beyond the
+// cap. SetMaxLifetime overrides the cap for single pairs.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.maxLifetime = d
+	}
+}
+
+// WithCleanupYield makes each cleanup cycle release the
+// write lock of the map after checking every n key-value
+// pairs and re-acquire it afterwards, so that a long
+// cleanup of a large map does not block other operations
+// for its whole duration. Writers waiting for the lock
+// in turn can not starve the cleanup, as the lock is
+// granted in the order it has been requested once a
+// waiter is blocked for more than a millisecond.
+//
+// The number of yields is reported in Stats. Yielding is
+// not applied when the map was created using
+// WithDeterministicOrder.
+func WithCleanupYield(n int) Option {
+	return func(tm *TimedMap) {
+		tm.cleanupYield = n
+	}
+}
+
+// WithTTLOverrides installs TTLOverrides on creation of
+// the map. See SetTTLOverrides for details.
+func WithTTLOverrides(o *TTLOverrides) Option {
+	return func(tm *TimedMap) {
+		tm.ttlOverrides = o
+	}
+}
+
+// WithTTLJitter randomly spreads the expiration of each
+// value set by up to the given fraction of its expiration
+// duration in both directions, e.g. a fraction of 0.1 lets
+// a value set with a TTL of 10 minutes expire between 9
+// and 11 minutes after being set. This prevents values set
+// at once from expiring in the same cleanup cycle.
+//
+// The fraction is limited to 1. Values set with
+// NoExpiration or KeepTTL are not affected.
+func WithTTLJitter(fraction float64) Option {
+	return func(tm *TimedMap) {
+		tm.ttlJitter = math.Min(fraction, 1)
+	}
+}
+
+// WithGracePeriod keeps key-value pairs in the map for the
+// given grace period after they have expired. While in
+// their grace period, pairs are treated as expired by all
+// operations except GetValueStale, which returns them
+// marked as stale. This allows serving stale values while
+// a new value is loaded. The callbacks of a pair are
+// executed when its grace period has passed.
+func WithGracePeriod(d time.Duration) Option {
+	return func(tm *TimedMap) {
+		tm.grace = d
+	}
+}
+
+// WithRemovalPacing spreads the finalizers set using
+// SetFinalizer of key-value pairs removed by mass removals,
+// i.e. Flush, DeleteSection and RemoveWhere, over time
+// instead of executing them at once. The pairs are removed
+// from the map immediately, while their finalizers are
+// queued and executed in the background in batches of at
+// most batch finalizers every interval. The finalizers of
+// concurrent mass removals are coalesced into one queue.
+//
+// progress is called after each batch, if not nil. Queued
+// finalizers are executed without holding the lock of the
+// map. All finalizers still queued when the map is closed
+// are executed by Close.
+func WithRemovalPacing(batch int, interval time.Duration, progress func(p RemovalProgress)) Option {
+	return func(tm *TimedMap) {
+		tm.pacer = newRemovalPacer(batch, interval, progress)
+	}
+}
+
+// WithOrderedExpiry guarantees that the callbacks and the
+// expire handler of the key-value pairs of each section are
+// executed in the order of their expiration times, across
+// cleanup cycles, entry timers and expiration on access.
+// When a pair is expired, all overdue pairs of its section
+// expiring before it are expired first.
+//
+// Pairs set or changed to expiration times before the one
+// of a pair already expired in the same section are expired
+// right away and therefore out of order. Pairs expired by
+// a DecayFunc are treated as expiring when detected. As
+// each expiration searches the map for overdue pairs, the
+// cleanup does not yield using WithCleanupYield with this
+// option.
+func WithOrderedExpiry() Option {
+	return func(tm *TimedMap) {
+		tm.orderedExpiry = true
+	}
+}
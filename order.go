@@ -0,0 +1,80 @@
+package timedmap
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// eachElement calls fn for each element of the container
+// until fn returns false. If the map was created with
+// WithDeterministicOrder, the elements are passed ordered
+// by section and key. Otherwise, the order is undefined.
+//
+// fn may delete the element passed to it. The caller must
+// hold the lock of the map.
+func (tm *TimedMap) eachElement(fn func(k keyWrap, v *element) bool) {
+	if !tm.ordered {
+		for k, v := range tm.container {
+			if !fn(k, v) {
+				return
+			}
+		}
+		return
+	}
+
+	for _, k := range tm.sortedKeys() {
+		if v, ok := tm.container[k]; ok && !fn(k, v) {
+			return
+		}
+	}
+}
+
+// sortedKeys returns a copy of the keys index ordered
+// by section and key.
+//
+// The caller must hold the lock of the map.
+func (tm *TimedMap) sortedKeys() []keyWrap {
+	keys := make([]keyWrap, len(tm.keys))
+	copy(keys, tm.keys)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sec != keys[j].sec {
+			return keys[i].sec < keys[j].sec
+		}
+		return lessKey(keys[i].key, keys[j].key)
+	})
+	return keys
+}
+
+// lessKey reports whether key a is ordered before key b.
+//
+// Keys of different types are ordered by their type name.
+// Numbers and strings are compared by value, booleans with
+// false before true. All other keys are compared by their
+// default formatting.
+func lessKey(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return !va.IsValid() && vb.IsValid()
+	}
+
+	if ta, tb := va.Type(), vb.Type(); ta != tb {
+		return ta.String() < tb.String()
+	}
+
+	switch va.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return va.Int() < vb.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return va.Uint() < vb.Uint()
+	case reflect.Float32, reflect.Float64:
+		return va.Float() < vb.Float()
+	case reflect.String:
+		return va.String() < vb.String()
+	case reflect.Bool:
+		return !va.Bool() && vb.Bool()
+	}
+
+	return fmt.Sprintf("%v", a) < fmt.Sprintf("%v", b)
+}
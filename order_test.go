@@ -0,0 +1,83 @@
+package timedmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministicOrder(t *testing.T) {
+	var expired []interface{}
+	tm := NewWithOptions(0,
+		WithDeterministicOrder(),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }))
+
+	for _, k := range []int{5, 3, 9, 1, 7, 2, 8, 4, 6} {
+		tm.Set(k, k*10, time.Hour)
+	}
+	tm.Set("b", 0, time.Hour)
+	tm.Set("a", 0, time.Hour)
+
+	var keys []interface{}
+	tm.Range(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, "a", "b"}, keys)
+	assert.Equal(t, []interface{}{10, 20, 30, 40, 50, 60, 70, 80, 90, 0, 0}, tm.Values())
+
+	keys = nil
+	tm.Range(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	assert.Equal(t, []interface{}{1, 2, 3}, keys)
+
+	tm.Remove(4)
+	tm.Set(4, 40, time.Hour)
+
+	var buf bytes.Buffer
+	var f snapshotFile
+	assert.NoError(t, tm.WriteSnapshot(&buf))
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &f))
+	var snapshotKeys []string
+	for _, e := range f.Entries {
+		snapshotKeys = append(snapshotKeys, string(e.Key))
+	}
+	assert.Equal(t,
+		[]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", `"a"`, `"b"`},
+		snapshotKeys)
+
+	for _, k := range []int{8, 2, 6} {
+		tm.SetExpires(k, 0)
+	}
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, []interface{}{2, 6, 8}, tm.ExpiredKeys())
+
+	tm.cleanUp()
+	assert.Equal(t, []interface{}{2, 6, 8}, expired)
+
+	expired = nil
+	tm.Section(1).Set(1, 1, 0)
+	tm.Set(false, 1, 0)
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, []interface{}{false, 1}, expired)
+}
+
+func TestLessKey(t *testing.T) {
+	assert.True(t, lessKey(1, 2))
+	assert.False(t, lessKey(2, 1))
+	assert.True(t, lessKey(uint8(1), uint8(2)))
+	assert.True(t, lessKey(1.5, 2.5))
+	assert.True(t, lessKey("a", "b"))
+	assert.True(t, lessKey(false, true))
+	assert.False(t, lessKey(true, true))
+	assert.True(t, lessKey(nil, 1))
+	assert.False(t, lessKey(1, nil))
+	assert.True(t, lessKey(1, "a"))
+	assert.True(t, lessKey(struct{ a int }{1}, struct{ a int }{2}))
+}
@@ -0,0 +1,177 @@
+package timedmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// TTLOverrides maps keys or key patterns to expiration
+// durations which take precedence over the expiration
+// durations passed when setting values. Install them using
+// WithTTLOverrides or SetTTLOverrides.
+//
+// Keys are matched in their string representation as
+// stored in the map, i.e. including key prefixes and after
+// normalization. Patterns use the syntax of path.Match,
+// e.g. "session:*", so that * does not match a slash.
+// Exact keys take precedence over patterns, longer
+// patterns over shorter ones.
+type TTLOverrides struct {
+	exact    map[string]time.Duration
+	patterns []ttlPattern
+}
+
+// ttlPattern is a key pattern of TTLOverrides
+// together with its expiration duration.
+type ttlPattern struct {
+	pattern string
+	ttl     time.Duration
+}
+
+// NewTTLOverrides creates TTLOverrides from the given map
+// of keys or key patterns to expiration durations. An error
+// wrapping ErrInvalidTTLOverrides is returned if a pattern
+// is malformed.
+func NewTTLOverrides(rules map[string]time.Duration) (*TTLOverrides, error) {
+	o := &TTLOverrides{
+		exact: make(map[string]time.Duration),
+	}
+
+	for pattern, ttl := range rules {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: pattern %q: %v", ErrInvalidTTLOverrides, pattern, err)
+		}
+		if isLiteralPattern(pattern) {
+			o.exact[pattern] = ttl
+		} else {
+			o.patterns = append(o.patterns, ttlPattern{pattern, ttl})
+		}
+	}
+
+	sort.Slice(o.patterns, func(i, j int) bool {
+		pi, pj := o.patterns[i].pattern, o.patterns[j].pattern
+		if len(pi) != len(pj) {
+			return len(pi) > len(pj)
+		}
+		return pi < pj
+	})
+
+	return o, nil
+}
+
+// ReadTTLOverrides reads TTLOverrides from r, which must
+// contain a JSON object mapping keys or key patterns to
+// expiration durations in the format of time.ParseDuration,
+// for example:
+//
+//	{"session:*": "30s", "hot-key": "1h"}
+//
+// The returned error wraps ErrInvalidTTLOverrides if the
+// overrides could not be decoded or are malformed.
+func ReadTTLOverrides(r io.Reader) (*TTLOverrides, error) {
+	var raw map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTTLOverrides, err)
+	}
+
+	rules := make(map[string]time.Duration, len(raw))
+	for pattern, s := range raw {
+		ttl, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern %q: %v", ErrInvalidTTLOverrides, pattern, err)
+		}
+		rules[pattern] = ttl
+	}
+
+	return NewTTLOverrides(rules)
+}
+
+// Lookup returns the expiration duration overriding the
+// one of the given key. ok is false if no override
+// matches the key.
+func (o *TTLOverrides) Lookup(key interface{}) (ttl time.Duration, ok bool) {
+	if o == nil {
+		return
+	}
+
+	s, isString := key.(string)
+	if !isString {
+		s = fmt.Sprint(key)
+	}
+
+	if ttl, ok = o.exact[s]; ok {
+		return
+	}
+	for _, p := range o.patterns {
+		if matched, _ := path.Match(p.pattern, s); matched {
+			return p.ttl, true
+		}
+	}
+	return
+}
+
+// SetTTLOverrides installs the given TTLOverrides, which
+// replace the previously installed ones. Passing nil
+// removes all overrides.
+//
+// The overrides are applied to all values set afterwards
+// with an expiration duration, i.e. not using KeepTTL, and
+// to SetExpires. Existing key-value pairs matching an
+// override expire after the overriding duration from now
+// on, so that the lifetimes of problematic keys can be
+// changed at runtime.
+func (tm *TimedMap) SetTTLOverrides(o *TTLOverrides) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.ttlOverrides = o
+	if o == nil {
+		return
+	}
+
+	for k, v := range tm.container {
+		if v.expired(now) {
+			continue
+		}
+		if ttl, ok := o.Lookup(k.key); ok {
+			v.expires = expiresAt(now, ttl)
+			v.capExpires()
+			v.warned = false
+			tm.schedule(k, v)
+		}
+	}
+}
+
+// overrideExpires returns the expiration time of a value
+// set for key at now, which expires at the passed time
+// unless overridden by the TTL overrides of the map.
+//
+// The caller must hold the lock of the map.
+func (tm *TimedMap) overrideExpires(key interface{}, now, expires time.Time) time.Time {
+	if ttl, ok := tm.ttlOverrides.Lookup(key); ok {
+		return expiresAt(now, ttl)
+	}
+	return expires
+}
+
+// isLiteralPattern returns true if pattern contains no
+// special characters of path.Match.
+func isLiteralPattern(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return false
+		}
+	}
+	return true
+}
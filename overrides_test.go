@@ -0,0 +1,79 @@
+package timedmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadTTLOverrides(t *testing.T) {
+	f, err := os.Open("testdata/ttl_overrides.json")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	o, err := ReadTTLOverrides(f)
+	assert.Nil(t, err)
+
+	for key, exp := range map[interface{}]time.Duration{
+		"session:1":       30 * time.Second,
+		"session:admin:1": 5 * time.Minute,
+		"hot-key":         time.Hour,
+		42:                10 * time.Second,
+	} {
+		ttl, ok := o.Lookup(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, exp, ttl, key)
+	}
+
+	_, ok := o.Lookup("other")
+	assert.False(t, ok)
+	_, ok = o.Lookup("session")
+	assert.False(t, ok)
+
+	_, err = ReadTTLOverrides(strings.NewReader(`{"a": "forever"}`))
+	assert.ErrorIs(t, err, ErrInvalidTTLOverrides)
+	_, err = ReadTTLOverrides(strings.NewReader(`{"a[": "1s"}`))
+	assert.ErrorIs(t, err, ErrInvalidTTLOverrides)
+	_, err = ReadTTLOverrides(strings.NewReader(`[]`))
+	assert.ErrorIs(t, err, ErrInvalidTTLOverrides)
+}
+
+func TestTTLOverrides(t *testing.T) {
+	o, err := NewTTLOverrides(map[string]time.Duration{
+		"hot:*": time.Second,
+	})
+	assert.Nil(t, err)
+
+	tm := NewWithOptions(0, WithTTLOverrides(o))
+
+	tm.Set("hot:1", 1, time.Hour)
+	tm.Set("cold:1", 1, time.Hour)
+	assert.InDelta(t, time.Second, ttlOf(t, tm, "hot:1"), float64(100*time.Millisecond))
+	assert.InDelta(t, time.Hour, ttlOf(t, tm, "cold:1"), float64(time.Second))
+
+	assert.Nil(t, tm.SetExpires("hot:1", time.Hour))
+	assert.InDelta(t, time.Second, ttlOf(t, tm, "hot:1"), float64(100*time.Millisecond))
+
+	o, err = NewTTLOverrides(map[string]time.Duration{
+		"cold:1": time.Minute,
+	})
+	assert.Nil(t, err)
+	tm.SetTTLOverrides(o)
+	assert.InDelta(t, time.Minute, ttlOf(t, tm, "cold:1"), float64(time.Second))
+
+	tm.Set("hot:1", 1, time.Hour)
+	assert.InDelta(t, time.Hour, ttlOf(t, tm, "hot:1"), float64(time.Second))
+
+	tm.SetTTLOverrides(nil)
+	tm.Set("cold:1", 1, time.Hour)
+	assert.InDelta(t, time.Hour, ttlOf(t, tm, "cold:1"), float64(time.Second))
+}
+
+func ttlOf(t *testing.T, tm *TimedMap, key interface{}) time.Duration {
+	d, err := tm.TTL(key)
+	assert.Nil(t, err)
+	return d
+}
@@ -0,0 +1,158 @@
+package timedmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RemovalProgress reports the progress of the finalizers
+// of mass removals paced using WithRemovalPacing.
+type RemovalProgress struct {
+	// Finalized is the number of finalizers executed
+	// since the queue of the map was last empty.
+	Finalized int
+	// Pending is the number of finalizers which are
+	// still queued.
+	Pending int
+}
+
+// finalization is a queued finalizer together with
+// the value it is executed with.
+type finalization struct {
+	fn    func(value interface{})
+	value interface{}
+}
+
+// removalPacer queues the finalizers of mass removals
+// and executes them in batches.
+type removalPacer struct {
+	mtx       sync.Mutex
+	queue     []finalization
+	finalized int
+	running   bool
+
+	batch    int
+	interval time.Duration
+	progress func(p RemovalProgress)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newRemovalPacer returns a removalPacer executing at most
+// batch finalizers every interval. progress is called after
+// each batch, if not nil. A batch or interval of 0 or less
+// is raised to 1.
+func newRemovalPacer(batch int, interval time.Duration, progress func(p RemovalProgress)) *removalPacer {
+	if batch <= 0 {
+		batch = 1
+	}
+	if interval <= 0 {
+		interval = 1
+	}
+	return &removalPacer{
+		batch:    batch,
+		interval: interval,
+		progress: progress,
+		stop:     make(chan struct{}),
+	}
+}
+
+// bulkDeleteElement removes the element v stored by k from
+// the map like deleteElement. When removals are paced, the
+// finalizer of the element is queued instead of executed.
+//
+// Mass removals call paceRemovals after removing all
+// elements. The caller must hold the write lock of the map.
+func (tm *TimedMap) bulkDeleteElement(k keyWrap, v *element) {
+	if p := tm.pacer; p != nil && v.finalizer != nil {
+		p.mtx.Lock()
+		p.queue = append(p.queue, finalization{v.finalizer, v.value})
+		p.mtx.Unlock()
+		v.finalizer = nil
+	}
+	tm.deleteElement(k, v)
+}
+
+// paceRemovals starts executing the queued finalizers
+// in the background, if not running already.
+func (tm *TimedMap) paceRemovals() {
+	p := tm.pacer
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.running || len(p.queue) == 0 {
+		return
+	}
+	p.running = true
+
+	p.wg.Add(1)
+	atomic.AddInt32(tm.goroutines, 1)
+	go func() {
+		defer p.wg.Done()
+		defer atomic.AddInt32(tm.goroutines, -1)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for p.finalizeBatch(p.batch) {
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// finalizeBatch executes at most n queued finalizers and
+// returns true if there are finalizers left in the queue.
+// A value of n of 0 or less executes all of them.
+func (p *removalPacer) finalizeBatch(n int) bool {
+	p.mtx.Lock()
+	if n <= 0 || n > len(p.queue) {
+		n = len(p.queue)
+	}
+	batch := p.queue[:n]
+	p.queue = p.queue[n:]
+	p.mtx.Unlock()
+
+	for _, f := range batch {
+		f.fn(f.value)
+	}
+
+	p.mtx.Lock()
+	p.finalized += n
+	progress := RemovalProgress{
+		Finalized: p.finalized,
+		Pending:   len(p.queue),
+	}
+	if progress.Pending == 0 {
+		p.queue = nil
+		p.finalized = 0
+		p.running = false
+	}
+	p.mtx.Unlock()
+
+	if p.progress != nil && n > 0 {
+		p.progress(progress)
+	}
+	return progress.Pending > 0
+}
+
+// drain stops executing finalizers in the background,
+// waits for the batch in progress and executes all
+// remaining finalizers at once.
+func (p *removalPacer) drain() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+	p.finalizeBatch(0)
+}
@@ -0,0 +1,87 @@
+package timedmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemovalPacing(t *testing.T) {
+	var mtx sync.Mutex
+	var finalized []interface{}
+	var progress []RemovalProgress
+
+	tm := NewWithOptions(0, WithRemovalPacing(4, 5*time.Millisecond, func(p RemovalProgress) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		progress = append(progress, p)
+	}))
+	defer tm.Close()
+
+	finalizer := func(value interface{}) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		finalized = append(finalized, value)
+	}
+	for i := 0; i < 10; i++ {
+		tm.Set(i, i, time.Hour)
+		assert.Nil(t, tm.SetFinalizer(i, finalizer))
+	}
+	tm.Set(10, 10, time.Hour)
+
+	tm.Flush()
+	assert.Equal(t, 0, tm.Size())
+
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(finalized) == 10
+	}, time.Second, time.Millisecond)
+
+	mtx.Lock()
+	assert.Equal(t, []RemovalProgress{
+		{Finalized: 4, Pending: 6},
+		{Finalized: 8, Pending: 2},
+		{Finalized: 10, Pending: 0},
+	}, progress)
+	mtx.Unlock()
+
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Goroutines == 0
+	}, time.Second, time.Millisecond)
+
+	tm.Remove(0)
+	tm.Set(0, 0, time.Hour)
+	assert.Nil(t, tm.SetFinalizer(0, finalizer))
+	tm.Remove(0)
+	mtx.Lock()
+	assert.Len(t, finalized, 11)
+	mtx.Unlock()
+}
+
+func TestRemovalPacingClose(t *testing.T) {
+	var finalized int
+	tm := NewWithOptions(0, WithRemovalPacing(1, time.Hour, nil))
+
+	for i := 0; i < 5; i++ {
+		tm.Section(1).Set(i, i, time.Hour)
+		assert.Nil(t, tm.Section(1).SetFinalizer(i, func(value interface{}) {
+			finalized++
+		}))
+	}
+	tm.Set(1, 1, time.Hour)
+	assert.Nil(t, tm.SetFinalizer(1, func(value interface{}) {
+		finalized++
+	}))
+
+	tm.DeleteSection(1)
+	assert.Equal(t, 1, tm.Size())
+
+	tm.Close()
+	assert.Equal(t, 6, finalized)
+	assert.Eventually(t, func() bool {
+		return tm.Resources() == Resources{}
+	}, time.Second, time.Millisecond)
+}
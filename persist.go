@@ -0,0 +1,176 @@
+package timedmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// SnapshotFormat is the identifier of the snapshot
+	// format written by WriteSnapshot.
+	SnapshotFormat = "timedmap-snapshot"
+	// SnapshotVersion is the latest version of the
+	// snapshot format which can be read.
+	SnapshotVersion = 1
+)
+
+// snapshotFile is the JSON document written by
+// WriteSnapshot.
+//
+// Fields unknown to a reader must be ignored, so that
+// fields can be added without changing the version of
+// the format. The version is only increased for changes
+// which can not be read by previous readers.
+type snapshotFile struct {
+	Format  string          `json:"format"`
+	Version int             `json:"version"`
+	Entries []snapshotEntry `json:"entries"`
+}
+
+// snapshotEntry is a single key-value pair of a
+// snapshot. Expires and Created are encoded in
+// RFC 3339 format with nanoseconds.
+type snapshotEntry struct {
+	Section int             `json:"section"`
+	Key     json.RawMessage `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+	Created time.Time       `json:"created"`
+	Caller  string          `json:"caller,omitempty"`
+}
+
+// WriteSnapshot writes all key-value pairs of all
+// sections of the map which have not expired to w as
+// JSON document of the latest snapshot format version.
+// Callbacks are not written.
+//
+// Keys and values are encoded using encoding/json, so
+// they must be JSON encodable.
+func (tm *TimedMap) WriteSnapshot(w io.Writer) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	f := snapshotFile{
+		Format:  SnapshotFormat,
+		Version: SnapshotVersion,
+		Entries: []snapshotEntry{},
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	keys := tm.keys
+	if tm.ordered {
+		keys = tm.sortedKeys()
+	}
+	for _, k := range keys {
+		v := tm.container[k]
+		if v.expired(now) {
+			continue
+		}
+		key, err := json.Marshal(k.key)
+		if err != nil {
+			tm.mtx.RUnlock()
+			return err
+		}
+		val, err := json.Marshal(v.valueAt(now))
+		if err != nil {
+			tm.mtx.RUnlock()
+			return err
+		}
+		f.Entries = append(f.Entries, snapshotEntry{
+			Section: k.sec,
+			Key:     key,
+			Value:   val,
+			Expires: v.expires,
+			Created: v.created,
+			Caller:  v.caller,
+		})
+	}
+	tm.mtx.RUnlock()
+
+	return json.NewEncoder(w).Encode(f)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot
+// from r and sets all contained key-value pairs which
+// have not expired yet with their original expiration
+// times, overwriting existing pairs.
+//
+// Keys and values are decoded using encoding/json into
+// their generic representation, so e.g. numeric keys
+// are read as float64.
+func (tm *TimedMap) ReadSnapshot(r io.Reader) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	f, err := decodeSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, e := range f.Entries {
+		if !e.Expires.After(now) {
+			continue
+		}
+		var key, val interface{}
+		if err = json.Unmarshal(e.Key, &key); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(e.Value, &val); err != nil {
+			return err
+		}
+		tm.setAt(tm.key(key), e.Section, val, e.Expires)
+	}
+
+	return nil
+}
+
+// Validate checks whether r contains a snapshot in a
+// format version which can be read by ReadSnapshot. The
+// returned error wraps ErrInvalidSnapshot or
+// ErrSnapshotVersion.
+//
+// This is used to verify the compatibility of snapshots
+// written by other implementations of the format.
+func Validate(r io.Reader) error {
+	_, err := decodeSnapshot(r)
+	return err
+}
+
+// decodeSnapshot reads and validates a snapshot from r.
+func decodeSnapshot(r io.Reader) (*snapshotFile, error) {
+	var f snapshotFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	if f.Format != SnapshotFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidSnapshot, f.Format)
+	}
+	if f.Version < 1 {
+		return nil, fmt.Errorf("%w: invalid version %d", ErrInvalidSnapshot, f.Version)
+	}
+	if f.Version > SnapshotVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrSnapshotVersion, f.Version)
+	}
+
+	for i, e := range f.Entries {
+		if len(e.Key) == 0 || string(e.Key) == "null" {
+			return nil, fmt.Errorf("%w: entry %d has no key", ErrInvalidSnapshot, i)
+		}
+		if len(e.Value) == 0 {
+			return nil, fmt.Errorf("%w: entry %d has no value", ErrInvalidSnapshot, i)
+		}
+		if e.Expires.IsZero() {
+			return nil, fmt.Errorf("%w: entry %d has no expiration", ErrInvalidSnapshot, i)
+		}
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,93 @@
+package timedmap
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, name := range []string{
+		"testdata/snapshot_v1.json",
+		"testdata/snapshot_v1_unknown_fields.json",
+	} {
+		f, err := os.Open(name)
+		assert.Nil(t, err)
+		assert.Nil(t, Validate(f), name)
+		f.Close()
+	}
+
+	f, err := os.Open("testdata/snapshot_v2.json")
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.ErrorIs(t, Validate(f), ErrSnapshotVersion)
+
+	for _, s := range []string{
+		``,
+		`[]`,
+		`{"format": "other", "version": 1}`,
+		`{"format": "timedmap-snapshot"}`,
+		`{"format": "timedmap-snapshot", "version": 1, "entries": [{"value": 1, "expires": "2200-01-01T00:00:00Z"}]}`,
+		`{"format": "timedmap-snapshot", "version": 1, "entries": [{"key": 1, "expires": "2200-01-01T00:00:00Z"}]}`,
+		`{"format": "timedmap-snapshot", "version": 1, "entries": [{"key": 1, "value": 1}]}`,
+		`{"format": "timedmap-snapshot", "version": 1, "entries": [{"key": 1, "value": 1, "expires": "tomorrow"}]}`,
+	} {
+		assert.ErrorIs(t, Validate(strings.NewReader(s)), ErrInvalidSnapshot, s)
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	tm := New(0)
+
+	f, err := os.Open("testdata/snapshot_v1.json")
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.Nil(t, tm.ReadSnapshot(f))
+
+	assert.Equal(t, 3, tm.Size())
+	assert.Equal(t, "world", tm.GetValue("hello"))
+	assert.Equal(t, map[string]interface{}{
+		"a": []interface{}{1.0, 2.5, true, nil},
+	}, tm.GetValue(42.0))
+	assert.Equal(t, 1.0, tm.Section(1).GetValue("hello"))
+	assert.False(t, tm.Contains("expired"))
+
+	exp, err := tm.GetExpires(42.0)
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2199, 12, 31, 22, 0, 0, 123456789, time.UTC).Equal(exp))
+
+	tm.Close()
+	assert.ErrorIs(t, tm.ReadSnapshot(strings.NewReader("")), ErrClosed)
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	tm := New(0)
+
+	tm.Set("a", 1, time.Hour)
+	tm.Set("b", []string{"x"}, time.Hour)
+	tm.Section(2).Set("a", "y", time.Minute)
+	tm.Set("c", 3, 0)
+	time.Sleep(time.Millisecond)
+
+	var buf bytes.Buffer
+	assert.Nil(t, tm.WriteSnapshot(&buf))
+	assert.Nil(t, Validate(bytes.NewReader(buf.Bytes())))
+
+	c := New(0)
+	assert.Nil(t, c.ReadSnapshot(&buf))
+	assert.Equal(t, 3, c.Size())
+	assert.Equal(t, 1.0, c.GetValue("a"))
+	assert.Equal(t, []interface{}{"x"}, c.GetValue("b"))
+	assert.Equal(t, "y", c.Section(2).GetValue("a"))
+
+	exp, _ := tm.GetExpires("a")
+	cexp, _ := c.GetExpires("a")
+	assert.True(t, exp.Equal(cexp))
+
+	tm.Set("f", func() {}, time.Hour)
+	assert.NotNil(t, tm.WriteSnapshot(&buf))
+}
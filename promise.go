@@ -0,0 +1,192 @@
+package timedmap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Promise is a placeholder value for a key-value pair
+// whose value is still being computed. It is stored as
+// value of the pair until it is resolved, so readers
+// using GetValue can detect the pending state by the
+// value being of type *Promise, while readers using
+// GetValueWait block until it is settled.
+type Promise struct {
+	tm       *TimedMap
+	key      interface{}
+	sec      int
+	deadline time.Time
+
+	once sync.Once
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// SetPending sets a Promise as value of the given key,
+// which reserves the key while its value is computed.
+// When the promise is not resolved within ttl, the pair
+// expires and all waiters receive ErrPromiseExpired.
+func (tm *TimedMap) SetPending(key interface{}, ttl time.Duration) *Promise {
+	return tm.setPending(tm.key(key), 0, ttl)
+}
+
+// GetValueWait returns the value of a key in the map like
+// GetValueE. If the value is a pending Promise, it blocks
+// until the promise is settled or ctx is done.
+func (tm *TimedMap) GetValueWait(ctx context.Context, key interface{}) (interface{}, error) {
+	return tm.getValueWait(ctx, tm.key(key), 0)
+}
+
+// setPending stores a new promise for the given key
+// in the given section which expires after ttl.
+func (tm *TimedMap) setPending(key interface{}, sec int, ttl time.Duration) *Promise {
+	p := tm.newPromise(key, sec, expiresAt(time.Now(), ttl))
+	tm.setAt(key, sec, p, p.deadline, p.expire)
+	return p
+}
+
+// getOrSetPending returns the value of the given key in
+// the given section if it exists. Otherwise, a new promise
+// expiring after ttl is stored and returned. If the promise
+// could not be stored, the error of setLockedAt is returned.
+func (tm *TimedMap) getOrSetPending(
+	key interface{},
+	sec int,
+	ttl time.Duration,
+) (val interface{}, p *Promise, err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if v := tm.getLocked(key, sec); v != nil {
+		return v.valueAt(now), nil, nil
+	}
+
+	p = tm.newPromise(key, sec, expiresAt(now, ttl))
+	if _, _, err = tm.setLockedAt(key, sec, p, now, p.deadline, p.expire); err != nil {
+		p = nil
+	}
+	return
+}
+
+// newPromise returns a new unsettled promise for the
+// given key in the given section.
+func (tm *TimedMap) newPromise(key interface{}, sec int, deadline time.Time) *Promise {
+	return &Promise{
+		tm:       tm,
+		key:      key,
+		sec:      sec,
+		deadline: deadline,
+		done:     make(chan struct{}),
+	}
+}
+
+// expire is the callback of the key-value pair holding
+// the promise, which rejects it when the pair expires.
+func (p *Promise) expire(interface{}) {
+	p.settle(nil, ErrPromiseExpired)
+}
+
+// getValueWait returns the value of the given key in
+// the given section, waiting for pending promises.
+func (tm *TimedMap) getValueWait(ctx context.Context, key interface{}, sec int) (interface{}, error) {
+	val, err := tm.getValueE(key, sec)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := val.(*Promise); ok {
+		return p.Wait(ctx)
+	}
+	return val, nil
+}
+
+// Resolve settles the promise with val, which is passed
+// to all waiters. If the map still holds the promise, val
+// is set as value of the key expiring after expiresAfter
+// together with the given callbacks.
+//
+// If the promise has already been settled or has expired,
+// ErrPromiseSettled is returned.
+func (p *Promise) Resolve(val interface{}, expiresAfter time.Duration, cb ...callback) error {
+	if !p.settle(val, nil) {
+		return ErrPromiseSettled
+	}
+	p.replace(func() {
+		p.tm.setLocked(p.key, p.sec, val, expiresAfter, cb...)
+	})
+	return nil
+}
+
+// Reject settles the promise with err, which is passed
+// to all waiters. If the map still holds the promise,
+// the key is removed.
+//
+// If the promise has already been settled or has expired,
+// ErrPromiseSettled is returned.
+func (p *Promise) Reject(err error) error {
+	if !p.settle(nil, err) {
+		return ErrPromiseSettled
+	}
+	p.replace(func() {
+		k := keyWrap{sec: p.sec, key: p.key}
+		p.tm.deleteElement(k, p.tm.container[k])
+	})
+	return nil
+}
+
+// Wait blocks until the promise is settled and returns
+// its value or error. If ctx is done before, the error
+// of ctx is returned.
+func (p *Promise) Wait(ctx context.Context) (interface{}, error) {
+	t := time.NewTimer(time.Until(p.deadline))
+	defer t.Stop()
+
+	select {
+	case <-p.done:
+	case <-t.C:
+		p.settle(nil, ErrPromiseExpired)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	<-p.done
+	return p.val, p.err
+}
+
+// settle sets the result of the promise and wakes all
+// waiters. false is returned if the promise has already
+// been settled. When the deadline of the promise has
+// passed, it is settled with ErrPromiseExpired instead.
+func (p *Promise) settle(val interface{}, err error) (ok bool) {
+	if time.Now().After(p.deadline) {
+		val, err = nil, ErrPromiseExpired
+	}
+	p.once.Do(func() {
+		p.val, p.err = val, err
+		close(p.done)
+		ok = err != ErrPromiseExpired
+	})
+	return
+}
+
+// replace executes fn under the write lock of the map
+// if the map still holds the promise as value.
+func (p *Promise) replace(fn func()) {
+	if p.tm.checkClosed() != nil {
+		return
+	}
+
+	p.tm.mtx.Lock()
+	defer p.tm.mtx.Unlock()
+
+	if v := p.tm.getLocked(p.key, p.sec); v != nil && v.value == p {
+		fn()
+	}
+}
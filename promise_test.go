@@ -0,0 +1,108 @@
+package timedmap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromiseResolve(t *testing.T) {
+	tm := New(0)
+
+	p := tm.SetPending(1, time.Hour)
+	assert.Equal(t, p, tm.GetValue(1))
+
+	res := make(chan interface{})
+	go func() {
+		v, err := tm.GetValueWait(context.Background(), 1)
+		assert.Nil(t, err)
+		res <- v
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, p.Resolve("a", time.Hour))
+	assert.EqualValues(t, "a", <-res)
+	assert.EqualValues(t, "a", tm.GetValue(1))
+	ttl, _ := tm.TTL(1)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	assert.ErrorIs(t, p.Resolve("b", time.Hour), ErrPromiseSettled)
+	assert.EqualValues(t, "a", tm.GetValue(1))
+
+	v, err := tm.GetValueWait(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "a", v)
+
+	_, err = tm.GetValueWait(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestPromiseReject(t *testing.T) {
+	tm := New(0)
+
+	errCompute := errors.New("compute failed")
+	p := tm.Section(1).SetPending(1, time.Hour)
+	assert.Nil(t, p.Reject(errCompute))
+	assert.False(t, tm.Section(1).Contains(1))
+
+	_, err := p.Wait(context.Background())
+	assert.ErrorIs(t, err, errCompute)
+	assert.ErrorIs(t, p.Resolve(1, time.Hour), ErrPromiseSettled)
+}
+
+func TestPromiseExpired(t *testing.T) {
+	tm := New(0)
+
+	p := tm.SetPending(1, 20*time.Millisecond)
+	_, err := tm.GetValueWait(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrPromiseExpired)
+	assert.ErrorIs(t, p.Resolve(1, time.Hour), ErrPromiseSettled)
+	assert.False(t, tm.Contains(1))
+
+	p = tm.SetPending(2, 0)
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	_, err = p.Wait(context.Background())
+	assert.ErrorIs(t, err, ErrPromiseExpired)
+
+	p = tm.SetPending(3, time.Hour)
+	tm.Set(3, "overwritten", time.Hour)
+	assert.Nil(t, p.Resolve("resolved", time.Hour))
+	assert.EqualValues(t, "overwritten", tm.GetValue(3))
+
+	tm.SetPending(4, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = tm.GetValueWait(ctx, 4)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSectionGetValueWaitDeleteSection(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+	p := s.SetPending(1, time.Hour)
+
+	res := make(chan interface{})
+	go func() {
+		v, _ := s.GetValueWait(context.Background(), 1)
+		res <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	deleted := make(chan struct{})
+	go func() {
+		tm.DeleteSection(1)
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatal("DeleteSection blocked by waiter")
+	}
+
+	assert.Nil(t, p.Resolve("a", time.Hour))
+	assert.Equal(t, "a", <-res)
+}
@@ -0,0 +1,82 @@
+package timedmap
+
+import "time"
+
+// SetHeadroom sets a key-value pair like Set and returns
+// the number of key-value pairs which can still be added
+// to the map until the quota set using WithSectionQuota
+// is reached. Producers can use it to throttle themselves
+// before their values are rejected.
+//
+// If the key does not exist and the quota is reached,
+// the value is not set and ErrQuotaExceeded is returned.
+// ErrRejected is returned if the value was rejected by
+// the admission hook. Without quota, remaining is
+// always -1.
+func (tm *TimedMap) SetHeadroom(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (remaining int, err error) {
+	return tm.setHeadroom(tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// setHeadroom sets the value for a key and section if
+// the section has not reached its quota and returns
+// the remaining quota of the section.
+func (tm *TimedMap) setHeadroom(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (remaining int, err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if _, _, err = tm.setLocked(key, sec, val, expiresAfter, cb...); err != nil {
+		return 0, err
+	}
+	if tm.quota <= 0 {
+		return -1, nil
+	}
+	return tm.quota - tm.sectionSizes[sec], nil
+}
+
+// quotaAllows returns true if an element can be stored
+// by k without exceeding the quota of its section.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) quotaAllows(k keyWrap) bool {
+	if tm.quota <= 0 {
+		return true
+	}
+	if _, ok := tm.container[k]; ok {
+		return true
+	}
+	return tm.sectionSizes[k.sec] < tm.quota
+}
+
+// countSection adds n to the number of elements
+// stored in section sec when a quota is set.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) countSection(sec, n int) {
+	if tm.quota <= 0 {
+		return
+	}
+	if tm.sectionSizes == nil {
+		tm.sectionSizes = make(map[int]int)
+	}
+	if tm.sectionSizes[sec] += n; tm.sectionSizes[sec] <= 0 {
+		delete(tm.sectionSizes, sec)
+	}
+}
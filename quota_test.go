@@ -0,0 +1,132 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetHeadroom(t *testing.T) {
+	tm := NewWithOptions(0, WithSectionQuota(2))
+
+	n, err := tm.SetHeadroom(1, 1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = tm.SetHeadroom(1, 2, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = tm.SetHeadroom(2, 2, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = tm.SetHeadroom(3, 3, time.Hour)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	tm.Set(3, 3, time.Hour)
+	assert.False(t, tm.Contains(3))
+
+	n, err = tm.Section(1).SetHeadroom(1, 1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	tm.Remove(1)
+	n, err = tm.SetHeadroom(3, 3, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	tm.Flush()
+	assert.Empty(t, tm.sectionSizes)
+}
+
+func TestSetHeadroomNoQuota(t *testing.T) {
+	tm := New(0)
+
+	n, err := tm.SetHeadroom(1, 1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, n)
+	assert.Nil(t, tm.sectionSizes)
+}
+
+func TestGetOrSetQuota(t *testing.T) {
+	tm := NewWithOptions(0, WithSectionQuota(1))
+	tm.Set(1, 1, time.Hour)
+
+	actual, loaded := tm.GetOrSet(2, 2, time.Hour)
+	assert.Nil(t, actual)
+	assert.False(t, loaded)
+	assert.False(t, tm.Contains(2))
+
+	actual, loaded = tm.GetOrSet(1, 3, time.Hour)
+	assert.Equal(t, 1, actual)
+	assert.True(t, loaded)
+
+	actual, loaded = tm.Section(1).GetOrSet(2, 2, time.Hour)
+	assert.Equal(t, 2, actual)
+	assert.False(t, loaded)
+
+	val, p, err := tm.getOrSetPending(3, 0, time.Hour)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Nil(t, val)
+	assert.Nil(t, p)
+}
+
+func TestGetOrSetRejected(t *testing.T) {
+	tm := NewWithOptions(0, WithAdmissionHook(func(key, value interface{}, ttl time.Duration) (bool, time.Duration) {
+		return key != 1, ttl
+	}))
+
+	actual, loaded := tm.GetOrSet(1, 1, time.Hour)
+	assert.Nil(t, actual)
+	assert.False(t, loaded)
+
+	_, _, err := tm.getOrSet(1, 0, 1, time.Hour)
+	assert.ErrorIs(t, err, ErrRejected)
+	_, _, err = tm.getOrSet(2, 0, 2, KeepTTL)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestSetIfNotExistsQuota(t *testing.T) {
+	tm := NewWithOptions(0, WithSectionQuota(1))
+
+	assert.True(t, tm.SetIfNotExists(1, 1, time.Hour))
+	assert.False(t, tm.SetIfNotExists(1, 2, time.Hour))
+	assert.False(t, tm.SetIfNotExists(2, 2, time.Hour))
+	assert.False(t, tm.Contains(2))
+	assert.True(t, tm.Section(1).SetIfNotExists(2, 2, time.Hour))
+	assert.False(t, tm.SetIfNotExists(3, 3, KeepTTL))
+
+	tm.Remove(1)
+	assert.True(t, tm.SetIfNotExists(2, 2, time.Hour))
+}
+
+func TestReconfigureQuota(t *testing.T) {
+	tm := New(0)
+	for i := 0; i < 3; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Section(1).Set(1, 1, time.Hour)
+
+	tm.Reconfigure(WithSectionQuota(2))
+	assert.Equal(t, map[int]int{0: 3, 1: 1}, tm.sectionSizes)
+	assert.Equal(t, 4, tm.Size())
+
+	tm.Set(3, 3, time.Hour)
+	assert.False(t, tm.Contains(3))
+	tm.Set(0, 10, time.Hour)
+	assert.Equal(t, 10, tm.GetValue(0))
+	assert.True(t, tm.Section(1).SetIfNotExists(2, 2, time.Hour))
+
+	tm.Remove(0)
+	tm.Set(3, 3, time.Hour)
+	assert.False(t, tm.Contains(3))
+	tm.Remove(1)
+	tm.Set(3, 3, time.Hour)
+	assert.True(t, tm.Contains(3))
+
+	tm.Reconfigure(WithSectionQuota(0))
+	assert.Nil(t, tm.sectionSizes)
+	tm.Set(4, 4, time.Hour)
+	assert.True(t, tm.Contains(4))
+}
@@ -0,0 +1,49 @@
+package timedmap
+
+import "sync/atomic"
+
+// Resources contains the number of resources
+// currently owned by a TimedMap.
+type Resources struct {
+	// Goroutines is the number of running goroutines
+	// started by the map, e.g. the cleanup loop or
+	// the goroutines of StreamSnapshot and Child.
+	Goroutines int
+	// Tickers is the number of tickers driving the
+	// internal cleanup, maintenance and scrub loops.
+	Tickers int
+	// Timers is the number of entry timers, when
+	// the map was created using WithEntryTimers.
+	Timers int
+	// Elements is the number of elements currently
+	// stored in the map, including expired ones not
+	// yet removed. Unused elements kept in the element
+	// pool are released by the garbage collector and
+	// are not counted.
+	Elements int
+}
+
+// Resources returns the number of resources
+// currently owned by the map.
+func (tm *TimedMap) Resources() (r Resources) {
+	r.Goroutines = int(atomic.LoadInt32(tm.goroutines))
+	if atomic.LoadUint32(tm.closed) == 0 {
+		if tm.maintenanceStop != nil {
+			r.Tickers++
+		}
+		if tm.scrubStop != nil {
+			r.Tickers++
+		}
+	}
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	if atomic.LoadUint32(tm.cleanerRunning) != 0 && tm.cleanupTickTime > 0 {
+		r.Tickers++
+	}
+
+	r.Timers = tm.timers
+	r.Elements = len(tm.container)
+	return
+}
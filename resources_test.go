@@ -0,0 +1,37 @@
+package timedmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResources(t *testing.T) {
+	tm := New(dCleanupTick)
+	assert.Equal(t, Resources{Goroutines: 1, Tickers: 1}, tm.Resources())
+
+	tm.Set(1, 1, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	tm.Child(ctx)
+	assert.Equal(t, Resources{Goroutines: 2, Tickers: 1, Elements: 1}, tm.Resources())
+
+	cancel()
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources() == Resources{}
+	}, time.Second, time.Millisecond)
+
+	tm = NewWithOptions(0, WithEntryTimers())
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, time.Hour)
+	assert.Equal(t, Resources{Timers: 2, Elements: 2}, tm.Resources())
+
+	tm.Remove(1)
+	assert.Nil(t, tm.Rename(2, 3))
+	assert.Equal(t, Resources{Timers: 1, Elements: 1}, tm.Resources())
+
+	tm.Close()
+	assert.Equal(t, Resources{}, tm.Resources())
+}
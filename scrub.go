@@ -0,0 +1,181 @@
+package timedmap
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DriftKind describes which internal structure of a
+// TimedMap was found out of sync with its container.
+type DriftKind int
+
+const (
+	// DriftKeysIndex is reported when a slot of the keys
+	// index does not refer to the element stored by its
+	// key or when the index does not contain each element
+	// of the map exactly once.
+	DriftKeysIndex DriftKind = iota
+	// DriftSectionSize is reported when the number of
+	// elements counted for the quota of a section does
+	// not match the number of elements in the section.
+	DriftSectionSize
+	// DriftTimers is reported when the number of running
+	// entry timers does not match the number of elements
+	// owning a timer.
+	DriftTimers
+)
+
+// String returns a readable name of the drift kind.
+func (k DriftKind) String() string {
+	switch k {
+	case DriftKeysIndex:
+		return "keys index"
+	case DriftSectionSize:
+		return "section size"
+	case DriftTimers:
+		return "timers"
+	default:
+		return fmt.Sprintf("DriftKind(%d)", int(k))
+	}
+}
+
+// Drift describes an inconsistency found and repaired
+// by a scrub pass.
+type Drift struct {
+	// Kind is the structure found out of sync.
+	Kind DriftKind
+	// Section is the section of the affected key-value
+	// pair or section counter.
+	Section int
+	// Key is the key of the affected key-value pair, if
+	// the drift concerns a single pair.
+	Key interface{}
+	// Message describes the drift and its repair.
+	Message string
+}
+
+// Scrub runs a scrub pass immediately, which validates at
+// most budget slots of the keys index against the elements
+// of the map, continuing where the previous pass stopped.
+// A budget of 0 or less validates the whole index.
+//
+// Once a pass reaches the end of the index, the index
+// size, the section counters of the quota and the number
+// of entry timers are validated against the elements of
+// the map as well.
+//
+// Found inconsistencies are repaired and returned.
+func (tm *TimedMap) Scrub(budget int) []Drift {
+	if tm.checkClosed() != nil {
+		return nil
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	return tm.scrub(budget)
+}
+
+// scrub validates and repairs at most budget slots of
+// the keys index and, at the end of the index, the
+// counters of the map. Each drift is reported to the
+// scrub handler of the map, if set.
+//
+// The write lock of the map must be held.
+func (tm *TimedMap) scrub(budget int) (drifts []Drift) {
+	report := func(kind DriftKind, k keyWrap, format string, args ...interface{}) {
+		d := Drift{
+			Kind:    kind,
+			Section: k.sec,
+			Key:     k.key,
+			Message: fmt.Sprintf(format, args...),
+		}
+		drifts = append(drifts, d)
+		if tm.scrubHandler != nil {
+			tm.scrubHandler(d)
+		}
+	}
+
+	for checked := 0; tm.scrubCursor < len(tm.keys); checked++ {
+		if budget > 0 && checked >= budget {
+			return
+		}
+
+		i := tm.scrubCursor
+		k := tm.keys[i]
+		v, ok := tm.container[k]
+		if !ok {
+			report(DriftKeysIndex, k, "removed slot %d without element", i)
+			last := len(tm.keys) - 1
+			tm.keys[i] = tm.keys[last]
+			tm.keys[last] = keyWrap{}
+			tm.keys = tm.keys[:last]
+			continue
+		}
+		if v.idx != i {
+			report(DriftKeysIndex, k, "moved element from slot %d to %d", v.idx, i)
+			v.idx = i
+		}
+		tm.scrubCursor++
+	}
+	tm.scrubCursor = 0
+
+	if len(tm.keys) != len(tm.container) {
+		report(DriftKeysIndex, keyWrap{},
+			"rebuilt index of %d slots for %d elements", len(tm.keys), len(tm.container))
+		tm.keys = make([]keyWrap, 0, len(tm.container))
+		for k, v := range tm.container {
+			v.idx = len(tm.keys)
+			tm.keys = append(tm.keys, k)
+		}
+	}
+
+	timers := 0
+	sizes := make(map[int]int)
+	for k, v := range tm.container {
+		if v.timer != nil {
+			timers++
+		}
+		sizes[k.sec]++
+	}
+
+	if timers != tm.timers {
+		report(DriftTimers, keyWrap{}, "corrected timer count from %d to %d", tm.timers, timers)
+		tm.timers = timers
+	}
+
+	if tm.quota > 0 {
+		for sec, n := range tm.sectionSizes {
+			if sizes[sec] != n {
+				report(DriftSectionSize, keyWrap{sec: sec},
+					"corrected section size from %d to %d", n, sizes[sec])
+			}
+		}
+		for sec, n := range sizes {
+			if _, ok := tm.sectionSizes[sec]; !ok {
+				report(DriftSectionSize, keyWrap{sec: sec},
+					"corrected section size from 0 to %d", n)
+			}
+		}
+		tm.sectionSizes = sizes
+	}
+
+	return
+}
+
+// scrubLoop runs a scrub pass with the given budget
+// on each tick of tc until the map is closed. The
+// goroutine running the loop is counted by the caller.
+func (tm *TimedMap) scrubLoop(tc <-chan time.Time, budget int) {
+	defer atomic.AddInt32(tm.goroutines, -1)
+
+	for {
+		select {
+		case <-tc:
+			tm.Scrub(budget)
+		case <-tm.scrubStop:
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package timedmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrub(t *testing.T) {
+	tm := NewWithOptions(0, WithSectionQuota(10), WithEntryTimers())
+	defer tm.Close()
+
+	for i := 0; i < 5; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Section(1).Set(1, 1, time.Hour)
+	assert.Empty(t, tm.Scrub(0))
+
+	tm.mtx.Lock()
+	tm.container[keyWrap{key: 2}].idx = 4
+	tm.keys = append(tm.keys, keyWrap{key: 99})
+	tm.timers = 3
+	tm.sectionSizes[1] = 5
+	tm.sectionSizes[2] = 1
+	tm.mtx.Unlock()
+
+	drifts := tm.Scrub(0)
+	kinds := map[DriftKind]int{}
+	for _, d := range drifts {
+		kinds[d.Kind]++
+	}
+	assert.Equal(t, map[DriftKind]int{
+		DriftKeysIndex:   2,
+		DriftTimers:      1,
+		DriftSectionSize: 2,
+	}, kinds)
+	assert.Empty(t, tm.Scrub(0))
+
+	assert.Equal(t, 6, tm.Resources().Timers)
+	remaining, err := tm.Section(1).SetHeadroom(2, 2, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, remaining)
+
+	tm.mtx.Lock()
+	tm.container[tm.keys[len(tm.keys)-1]].idx = 0
+	tm.mtx.Unlock()
+	for i := 0; i < len(tm.keys)-1; i++ {
+		assert.Empty(t, tm.Scrub(1))
+	}
+	assert.Len(t, tm.Scrub(1), 1)
+
+	tm.mtx.Lock()
+	tm.keys = tm.keys[:len(tm.keys)-1]
+	tm.mtx.Unlock()
+	drifts = tm.Scrub(0)
+	assert.Len(t, drifts, 1)
+	assert.Equal(t, DriftKeysIndex, drifts[0].Kind)
+	assert.Equal(t, 7, tm.Size())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i, tm.GetValue(i))
+	}
+	assert.Empty(t, tm.Scrub(0))
+}
+
+func TestScrubber(t *testing.T) {
+	var mtx sync.Mutex
+	var drifts []Drift
+	tm := NewWithOptions(0, WithScrubber(time.Millisecond, 1, func(d Drift) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		drifts = append(drifts, d)
+	}))
+
+	assert.Equal(t, Resources{Goroutines: 1, Tickers: 1}, tm.Resources())
+
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, time.Hour)
+	tm.mtx.Lock()
+	tm.container[keyWrap{key: 1}].idx = 1
+	tm.mtx.Unlock()
+
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(drifts) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, DriftKeysIndex, drifts[0].Kind)
+	assert.Equal(t, 1, drifts[0].Key)
+
+	tm.Close()
+	assert.Eventually(t, func() bool {
+		return tm.Resources() == Resources{}
+	}, time.Second, time.Millisecond)
+}
@@ -1,6 +1,9 @@
 package timedmap
 
 import (
+	"context"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,21 +19,289 @@ type Section interface {
 	// will automatically be removed from the map.
 	Set(key, value interface{}, expiresAfter time.Duration, cb ...callback)
 
+	// SetDefault appends a key-value pair to the section or
+	// sets the value of a key like Set, using the default TTL
+	// of the map as expiration duration.
+	SetDefault(key, value interface{}, cb ...callback)
+
+	// SetPending sets a Promise as value of the given key,
+	// which reserves the key while its value is computed.
+	// When the promise is not resolved within ttl, the pair
+	// expires and all waiters receive ErrPromiseExpired.
+	// nil is returned if the section has been deleted.
+	SetPending(key interface{}, ttl time.Duration) *Promise
+
+	// GetValueWait returns the value of a key in the section
+	// like GetValueE. If the value is a pending Promise, it
+	// blocks until the promise is settled or ctx is done.
+	GetValueWait(ctx context.Context, key interface{}) (interface{}, error)
+
+	// SetHeadroom sets a key-value pair like Set and returns
+	// the number of key-value pairs which can still be added
+	// to the section until the quota set using
+	// WithSectionQuota is reached. If the key does not exist
+	// and the quota is reached, ErrQuotaExceeded is returned.
+	// Without quota, remaining is always -1.
+	SetHeadroom(key, value interface{}, expiresAfter time.Duration, cb ...callback) (remaining int, err error)
+
+	// SetBy sets a key-value pair like Set and records caller
+	// as a short identifier of the caller which set the value,
+	// when the map was created using WithProvenance.
+	SetBy(caller string, key, value interface{}, expiresAfter time.Duration, cb ...callback)
+
+	// SetSliding sets a key-value pair like Set, using idle
+	// as sliding expiration. Each time the value is read
+	// using GetValue, TryGetValue, GetValueE or
+	// GetValueDefault, the pair is refreshed to expire idle
+	// after the read.
+	SetSliding(key, value interface{}, idle time.Duration, cb ...callback)
+
+	// SetContext sets a key-value pair like SetBy with the
+	// caller attached to ctx using WithCaller.
+	SetContext(ctx context.Context, key, value interface{}, expiresAfter time.Duration, cb ...callback)
+
+	// SetExpireAt appends a key-value pair to the map or sets the
+	// value of a key like Set. The key-value pair expires at the
+	// given point of time at. A zero at behaves like KeepTTL.
+	SetExpireAt(key, value interface{}, at time.Time, cb ...callback)
+
+	// SetReported sets the key-value pair like Set and returns
+	// the previous value of the key. replaced is true, if the
+	// key was existent and not expired before.
+	//
+	// When the map has been created using WithValueEqual and
+	// the previous value equals the new one, the previous
+	// value is kept and replaced is false.
+	SetReported(key, value interface{}, expiresAfter time.Duration, cb ...callback) (old interface{}, replaced bool)
+
+	// SetAll sets all passed key-value pairs with their own
+	// expiration parameters under a single lock acquisition.
+	SetAll(entries []KV)
+
+	// Swap sets the key-value pair like Set and returns the
+	// previous value of the key in a single atomic operation.
+	// existed is true, if the key was existent and not expired
+	// before.
+	Swap(key, value interface{}, expiresAfter time.Duration, cb ...callback) (old interface{}, existed bool)
+
+	// SetMulti sets all key-value pairs of the passed map
+	// entries with the given expiration parameters under a
+	// single lock acquisition. If entries is not a map,
+	// ErrValueNoMap is returned.
+	SetMulti(entries interface{}, expiresAfter time.Duration, cb ...callback) error
+
+	// GetOrSet returns the value of the key, if existent and
+	// not expired, and loaded is set to true. Otherwise, the
+	// passed value is set with the given expiration parameters
+	// and returned. Both happens atomically. If the value could
+	// not be stored, e.g. as the quota has been reached, nil
+	// is returned.
+	GetOrSet(key, value interface{}, expiresAfter time.Duration, cb ...callback) (actual interface{}, loaded bool)
+
+	// SetIfNotExists sets the key-value pair only if the key
+	// does not exist or has expired and returns true, if the
+	// pair has been set. Both happens atomically. false is
+	// returned as well if the pair could not be stored.
+	SetIfNotExists(key, value interface{}, expiresAfter time.Duration, cb ...callback) bool
+
+	// Update executes fn with the current value of the key
+	// and stores the returned value with the returned
+	// expiration duration. Both happens under the write
+	// lock of the map. The callbacks of an existing
+	// key-value pair are kept. Errors are returned like by
+	// TimedMap.Update, and ErrSectionDeleted if the section
+	// has been deleted.
+	//
+	// fn must not access the map.
+	Update(key interface{}, fn UpdateFunc) error
+
+	// Upsert sets the value of the key like Update. If the key
+	// does not exist, the value and expiration duration are
+	// returned by insert. Otherwise, they are returned by
+	// update, which receives the current value. Errors are
+	// returned like by Update.
+	//
+	// insert and update must not access the map.
+	Upsert(
+		key interface{},
+		insert func() (val interface{}, expiresAfter time.Duration),
+		update func(old interface{}) (val interface{}, expiresAfter time.Duration),
+	) error
+
+	// Increment adds delta to the numeric value of the key
+	// atomically and returns the new value, which keeps the
+	// type of the stored value. expiresAfter sets the new
+	// expiration duration; pass KeepTTL to keep the current
+	// one. If the key does not exist, delta is stored as
+	// int64.
+	Increment(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error)
+
+	// Decrement subtracts delta from the numeric value of
+	// the key atomically like Increment.
+	Decrement(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error)
+
+	// Observe adds value to the sliding window of the given
+	// size stored for key and returns the aggregates of all
+	// observations within the window. If the key does not
+	// exist, a new window is created, otherwise the size of
+	// the existing window is kept. The key-value pair
+	// expires when no value has been observed for the
+	// duration of the window.
+	//
+	// If the stored value is not a window, ErrValueNoWindow
+	// is returned.
+	Observe(key interface{}, value float64, window time.Duration) (WindowStats, error)
+
+	// WindowStats returns the aggregates of all observations
+	// within the sliding window stored for key. If there is
+	// no value to the key passed, ErrKeyNotFound is returned.
+	// If the stored value is not a window, ErrValueNoWindow
+	// is returned.
+	WindowStats(key interface{}) (WindowStats, error)
+
 	// GetValue returns an interface of the value of a key in the
 	// map. The returned value is nil if there is no value to the
 	// passed key or if the value was expired.
 	GetValue(key interface{}) interface{}
 
+	// TryGetValue returns the value of a key in the map like
+	// GetValue. ok is false, if there is no value to the passed
+	// key or if the value was expired.
+	TryGetValue(key interface{}) (val interface{}, ok bool)
+
+	// GetValueStale returns the value of a key in the section
+	// like TryGetValue. Additionally, values which have expired
+	// but are still in their grace period set using
+	// WithGracePeriod are returned with stale set to true.
+	// stale is also true if the soft expiration time of the
+	// pair has passed.
+	GetValueStale(key interface{}) (val interface{}, stale, ok bool)
+
+	// GetValueE returns the value of a key in the map like
+	// GetValue. If there is no value to the passed key or if
+	// the value was expired, ErrKeyNotFound is returned.
+	GetValueE(key interface{}) (interface{}, error)
+
+	// GetValueDefault returns the value of a key in the map
+	// like GetValue. If there is no value to the passed key
+	// or if the value was expired, def is returned.
+	GetValueDefault(key interface{}, def interface{}) interface{}
+
+	// GetEntry returns the key-value pair of the given key
+	// together with its metadata. If the key-value pair does
+	// not exist in the map or was expired, this will return
+	// an error object.
+	GetEntry(key interface{}) (Entry, error)
+
 	// GetExpires returns the expire time of a key-value pair.
 	// If the key-value pair does not exist in the map or
 	// was expired, this will return an error object.
 	GetExpires(key interface{}) (time.Time, error)
 
+	// TTL returns the remaining lifetime of a key-value pair.
+	// If the key-value pair does not exist in the map or
+	// was expired, this will return an error object.
+	TTL(key interface{}) (time.Duration, error)
+
 	// SetExpires sets the expire time for a key-value
 	// pair to the passed duration. If there is no value
 	// to the key passed , this will return an error.
 	SetExpires(key interface{}, d time.Duration) error
 
+	// Touch resets the expire time for a key-value pair to
+	// the default TTL of the map, as if it was set using
+	// DefaultTTL as expiration duration. If there is no
+	// value to the key passed, this will return an error.
+	Touch(key interface{}) error
+
+	// SetExpiresPrev sets the expire time for a key-value pair
+	// like SetExpires and returns its previous expiration time.
+	SetExpiresPrev(key interface{}, d time.Duration) (time.Time, error)
+
+	// ExpiresAt sets the expire time for a key-value pair
+	// to the passed point of time. If there is no value
+	// to the key passed, this will return an error.
+	ExpiresAt(key interface{}, t time.Time) error
+
+	// AddCallback appends callbacks to the callbacks of a
+	// key-value pair which are executed when it expires.
+	// If there is no value to the key passed, this will
+	// return an error.
+	//
+	// Unlike the callbacks passed to Set, added callbacks
+	// are kept when a new value is set for the key and are
+	// executed after them. They are dropped when the pair
+	// is removed or expires.
+	//
+	// If the pair would hold more callbacks than allowed
+	// by the maps maximum callback count, no callback is
+	// added and ErrTooManyCallbacks is returned.
+	AddCallback(key interface{}, cb ...callback) error
+
+	// CallbackCount returns the number of callbacks of a
+	// key-value pair which are executed when it expires.
+	// If there is no value to the key passed, this will
+	// return an error.
+	CallbackCount(key interface{}) (int, error)
+
+	// ClearCallbacks removes all callbacks of a key-value
+	// pair which would be executed when it expires, including
+	// the ones added using AddCallback. If there is no value
+	// to the key passed, this will return an error.
+	ClearCallbacks(key interface{}) error
+
+	// SetMaxLifetime caps the total lifetime of a key-value
+	// pair to d after it has been set without existing
+	// before, overriding the cap set using WithMaxLifetime.
+	// A d of 0 or less removes the cap of the pair. If there
+	// is no value to the key passed, this will return an error.
+	SetMaxLifetime(key interface{}, d time.Duration) error
+
+	// SetFinalizer sets the finalizer of a key-value pair,
+	// which is executed exactly once with the value when it
+	// permanently leaves the section, i.e. when the pair
+	// expires, is removed, replaced by a different value,
+	// flushed or when the map is closed. If there is no
+	// value to the key passed, this will return an error.
+	SetFinalizer(key interface{}, fn func(value interface{})) error
+
+	// SetWarning registers callbacks for a key-value pair
+	// which are executed once by the cleanup loop as soon
+	// as the pair is less than before away from its
+	// expiration. If there is no value to the key passed,
+	// this will return an error.
+	SetWarning(key interface{}, before time.Duration, cb ...callback) error
+
+	// Hold suspends the expiration of a key-value pair
+	// until the returned release function is called or
+	// the maximum hold duration of the map has passed.
+	// If there is no value to the key passed, this will
+	// return an error.
+	Hold(key interface{}) (release func(), err error)
+
+	// SetDecay registers a DecayFunc for a key-value pair.
+	// From now on, the value returned for the pair is the
+	// stored value passed through fn with the time elapsed
+	// since this call. As soon as fn reports the value as
+	// not alive anymore, the pair expires. If there is no
+	// value to the key passed, this will return an error.
+	SetDecay(key interface{}, fn DecayFunc) error
+
+	// SetSoftExpires sets a soft expiration time for a
+	// key-value pair to the passed duration, which is
+	// independent from its actual expiration time. After
+	// the soft expiration time has passed, the pair is
+	// considered stale and the passed callbacks are
+	// executed once by the cleanup loop. If there is no
+	// value to the key passed, this will return an error.
+	SetSoftExpires(key interface{}, d time.Duration, cb ...callback) error
+
+	// IsStale returns true, if the soft expiration time of
+	// the key-value pair has passed. If there is no value
+	// to the key passed or if the value was expired, this
+	// will return an error.
+	IsStale(key interface{}) (bool, error)
+
 	// Contains returns true, if the key exists in the map.
 	// false will be returned, if there is no value to the
 	// key or if the key-value pair was expired.
@@ -39,11 +310,56 @@ type Section interface {
 	// Remove deletes a key-value pair in the map.
 	Remove(key interface{})
 
+	// Expire expires a key-value pair in the section immediately
+	// and executes its callbacks, regardless of it being held.
+	// If there is no value to the key passed, this will return
+	// an error.
+	Expire(key interface{}) error
+
+	// Rename moves the key-value pair of oldKey together with
+	// its expiration time and callbacks to newKey atomically.
+	// If there is no value to oldKey, ErrKeyNotFound is returned.
+	// If newKey already exists, ErrKeyExists is returned, unless
+	// the map was created using WithReplaceOnRename.
+	//
+	// Holds of the key-value pair are released on rename.
+	Rename(oldKey, newKey interface{}) error
+
+	// RemoveMulti deletes all key-value pairs of the passed
+	// keys in the section under a single lock acquisition
+	// and returns the number of removed pairs.
+	RemoveMulti(keys ...interface{}) int
+
+	// RemoveWhere deletes all key-value pairs in the section
+	// which have not expired and for which fn returns true
+	// under a single lock acquisition and returns the number
+	// of removed pairs.
+	//
+	// The write lock of the map is held while fn is called,
+	// so fn must not access the map.
+	RemoveWhere(fn func(key, value interface{}) bool) int
+
+	// Pop removes a key-value pair from the map and returns
+	// its value. ok is false, if there is no value to the
+	// key or if the key-value pair was expired. No expiry
+	// callbacks are executed for the removed pair.
+	Pop(key interface{}) (val interface{}, ok bool)
+
 	// Refresh extends the expire time for a key-value pair
 	// about the passed duration. If there is no value to
 	// the key passed, this will return an error.
 	Refresh(key interface{}, d time.Duration) error
 
+	// RefreshPrev extends the expire time for a key-value pair
+	// like Refresh and returns its previous expiration time.
+	RefreshPrev(key interface{}, d time.Duration) (time.Time, error)
+
+	// GetAndRefresh returns the value of the given key and
+	// extends its expire time about the passed duration in
+	// a single operation. If there is no value to the key
+	// passed, ErrKeyNotFound is returned.
+	GetAndRefresh(key interface{}, d time.Duration) (interface{}, error)
+
 	// Flush deletes all key-value pairs of the section
 	// in the map.
 	Flush()
@@ -52,16 +368,128 @@ type Section interface {
 	// existent in the section of the map.
 	Size() (i int)
 
+	// SizeLive returns the current number of key-value
+	// pairs existent in the section which have not expired.
+	// Unlike Size, pairs which have expired but were not
+	// yet removed by the cleanup loop are not counted.
+	SizeLive() int
+
 	// Snapshot returns a new map which represents the
 	// current key-value state of the internal container.
 	Snapshot() map[interface{}]interface{}
+
+	// SnapshotEntries returns a new map containing the entries
+	// of all key-value pairs in the section which have not
+	// expired, including their expiration and creation times.
+	SnapshotEntries() map[interface{}]Entry
+
+	// StreamSnapshot returns a channel yielding all key-value
+	// pairs of the section which have not expired. The pairs
+	// are collected in small batches, so that the lock of the
+	// map is only held shortly at a time. The channel is closed
+	// after all pairs have been yielded or when ctx is done.
+	//
+	// ctx must be cancelled if the channel is not read until
+	// it is closed.
+	StreamSnapshot(ctx context.Context) <-chan Entry
+
+	// SnapshotPage returns a page of at most limit key-value
+	// pairs of the section which have not expired, together
+	// with the cursor of the next page. Pass 0 as cursor to
+	// get the first page; nextCursor is 0 after the last
+	// page. A limit of 0 or less returns all remaining pairs.
+	SnapshotPage(cursor, limit int) (page map[interface{}]interface{}, nextCursor int)
+
+	// SnapshotInto writes all key-value pairs of the section
+	// like Snapshot into dst after removing all existing
+	// entries of dst.
+	SnapshotInto(dst map[interface{}]interface{})
+
+	// BorrowSnapshot returns a map like Snapshot, which is
+	// taken from an internal pool, and a release function
+	// which returns the map to the pool. The map must not
+	// be used anymore after release has been called.
+	BorrowSnapshot() (m map[interface{}]interface{}, release func())
+
+	// Values returns the values of all key-value
+	// pairs in the section which have not expired.
+	Values() []interface{}
+
+	// Range calls fn sequentially for each key-value pair
+	// in the section which has not expired. If fn returns
+	// false, the iteration is stopped.
+	//
+	// The read lock of the map is held during the iteration,
+	// so fn must not write to the map.
+	Range(fn func(key, value interface{}) bool)
+
+	// View returns a read-only view of the map which
+	// passes all values through transform on read. The
+	// view does not copy the key-value pairs of the map.
+	View(transform TransformFunc) ReadOnlyMap
+
+	// ExpiredKeys returns the keys of all key-value pairs in
+	// the section which have expired but were not yet removed,
+	// i.e. which would be expired by a cleanup cycle right
+	// now. The pairs are neither removed nor are their
+	// callbacks executed.
+	ExpiredKeys() []interface{}
+
+	// KeysExpiringBefore returns the keys of all key-value
+	// pairs in the section which have not expired yet but
+	// will expire before t.
+	KeysExpiringBefore(t time.Time) []interface{}
+
+	// SetNegative records a negative result for the given
+	// key in the section and returns the duration it is
+	// cached for. See TimedMap.SetNegative for the backoff
+	// applied on consecutive negative results.
+	SetNegative(key interface{}) time.Duration
+
+	// IsNegative returns true if a negative result recorded
+	// for the given key in the section is still cached.
+	IsNegative(key interface{}) bool
+
+	// KeysByExpiry returns the keys of all non-expired
+	// key-value pairs in the section sorted ascending by
+	// their expiration time.
+	KeysByExpiry() []interface{}
+
+	// SoonestExpiring returns the entries of the at most n
+	// non-expired key-value pairs in the section which expire
+	// next, sorted ascending by their expiration time.
+	SoonestExpiring(n int) []Entry
+
+	// NextExpiry returns the soonest point of time at which
+	// a non-expired key-value pair of the section expires.
+	// ok is false if the section contains no non-expired
+	// pairs.
+	NextExpiry() (t time.Time, ok bool)
+
+	// SampleKeys returns a uniform random sample of at most
+	// n keys of non-expired key-value pairs in the section.
+	SampleKeys(n int) []interface{}
 }
 
 // section wraps access to a specific
 // section of the map.
+//
+// When prefix is set, all string keys passed
+// are prefixed with it and only string keys
+// carrying the prefix are visible to the
+// section. Other keys are stored as prefixedKey.
+//
+// gen is the generation of the section at the
+// time the section instance has been created.
+//
+// When done is set, the section is considered
+// deleted as soon as done is closed.
 type section struct {
-	tm  *TimedMap
-	sec int
+	gen    uint64
+	tm     *TimedMap
+	sec    int
+	prefix string
+	done   <-chan struct{}
 }
 
 // newSection creates a new Section instance
@@ -69,6 +497,7 @@ type section struct {
 // section identifier.
 func newSection(tm *TimedMap, sec int) *section {
 	return &section{
+		gen: tm.sectionGen(sec),
 		tm:  tm,
 		sec: sec,
 	}
@@ -79,52 +508,566 @@ func (s *section) Ident() int {
 }
 
 func (s *section) Set(key, value interface{}, expiresAfter time.Duration, cb ...callback) {
-	s.tm.set(key, s.sec, value, expiresAfter, cb...)
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.set(s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) SetDefault(key, value interface{}, cb ...callback) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.set(s.key(key), s.sec, value, DefaultTTL, cb...)
+}
+
+func (s *section) SetPending(key interface{}, ttl time.Duration) *Promise {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.setPending(s.key(key), s.sec, ttl)
+}
+
+func (s *section) GetValueWait(ctx context.Context, key interface{}) (interface{}, error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	val, err := s.tm.getValueE(s.key(key), s.sec)
+	s.unbind()
+
+	// The section lock must not be held while waiting,
+	// as it would block DeleteSection until the promise
+	// is settled.
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := val.(*Promise); ok {
+		return p.Wait(ctx)
+	}
+	return val, nil
+}
+
+func (s *section) SetHeadroom(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (remaining int, err error) {
+	if err = s.bind(); err != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.setHeadroom(s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) GetValueStale(key interface{}) (val interface{}, stale, ok bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.getValueStale(s.key(key), s.sec)
+}
+
+func (s *section) SetSliding(key, value interface{}, idle time.Duration, cb ...callback) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.setSliding(s.key(key), s.sec, value, idle, cb...)
+}
+
+func (s *section) SetBy(caller string, key, value interface{}, expiresAfter time.Duration, cb ...callback) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.setBy(caller, s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) SetContext(ctx context.Context, key, value interface{}, expiresAfter time.Duration, cb ...callback) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.setBy(CallerFromContext(ctx), s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) SetExpireAt(key, value interface{}, at time.Time, cb ...callback) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.setAt(s.key(key), s.sec, value, at, cb...)
+}
+
+func (s *section) SetReported(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, replaced bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.set(s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) SetAll(entries []KV) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.setAll(s.key, s.sec, entries)
+}
+
+func (s *section) Swap(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, existed bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.swap(s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) SetMulti(entries interface{}, expiresAfter time.Duration, cb ...callback) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setMulti(s.key, s.sec, entries, expiresAfter, cb...)
+}
+
+func (s *section) GetOrSet(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (actual interface{}, loaded bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	actual, loaded, _ = s.tm.getOrSet(s.key(key), s.sec, value, expiresAfter, cb...)
+	return
+}
+
+func (s *section) SetIfNotExists(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) bool {
+	if s.bind() != nil {
+		return false
+	}
+	defer s.unbind()
+
+	return s.tm.setIfNotExists(s.key(key), s.sec, value, expiresAfter, cb...)
+}
+
+func (s *section) Update(key interface{}, fn UpdateFunc) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.update(s.key(key), s.sec, fn)
+}
+
+func (s *section) Upsert(
+	key interface{},
+	insert func() (val interface{}, expiresAfter time.Duration),
+	update func(old interface{}) (val interface{}, expiresAfter time.Duration),
+) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.update(s.key(key), s.sec, upsertFunc(insert, update))
+}
+
+func (s *section) Increment(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	defer s.unbind()
+
+	return s.tm.increment(s.key(key), s.sec, delta, expiresAfter)
+}
+
+func (s *section) Decrement(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	defer s.unbind()
+
+	return s.tm.increment(s.key(key), s.sec, -delta, expiresAfter)
+}
+
+func (s *section) Observe(key interface{}, value float64, window time.Duration) (WindowStats, error) {
+	if err := s.bind(); err != nil {
+		return WindowStats{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.observe(s.key(key), s.sec, value, window)
+}
+
+func (s *section) WindowStats(key interface{}) (WindowStats, error) {
+	if err := s.bind(); err != nil {
+		return WindowStats{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.windowStats(s.key(key), s.sec)
 }
 
 func (s *section) GetValue(key interface{}) interface{} {
-	v := s.tm.get(key, s.sec)
-	if v == nil {
+	if s.bind() != nil {
 		return nil
 	}
-	return v.value
+	defer s.unbind()
+
+	val, _ := s.tm.tryGetValue(s.key(key), s.sec)
+	return val
+}
+
+func (s *section) GetValueE(key interface{}) (interface{}, error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	defer s.unbind()
+
+	return s.tm.getValueE(s.key(key), s.sec)
+}
+
+func (s *section) TryGetValue(key interface{}) (val interface{}, ok bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.tryGetValue(s.key(key), s.sec)
+}
+
+func (s *section) GetValueDefault(key interface{}, def interface{}) interface{} {
+	if s.bind() != nil {
+		return def
+	}
+	defer s.unbind()
+
+	return s.tm.getValueDefault(s.key(key), s.sec, def)
+}
+
+func (s *section) GetEntry(key interface{}) (Entry, error) {
+	if err := s.bind(); err != nil {
+		return Entry{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.getEntry(s.tm.key(key), s.key(key), s.sec)
 }
 
 func (s *section) GetExpires(key interface{}) (time.Time, error) {
-	v := s.tm.get(key, s.sec)
-	if v == nil {
-		return time.Time{}, ErrKeyNotFound
+	if err := s.bind(); err != nil {
+		return time.Time{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.getExpires(s.key(key), s.sec)
+}
+
+func (s *section) TTL(key interface{}) (time.Duration, error) {
+	if err := s.bind(); err != nil {
+		return 0, err
 	}
-	return v.expires, nil
+	defer s.unbind()
+
+	return s.tm.ttl(s.key(key), s.sec)
 }
 
 func (s *section) SetExpires(key interface{}, d time.Duration) error {
-	return s.tm.setExpires(key, s.sec, d)
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	_, err := s.tm.setExpires(s.key(key), s.sec, d)
+	return err
+}
+
+func (s *section) Touch(key interface{}) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.touch(s.key(key), s.sec)
+}
+
+func (s *section) SetExpiresPrev(key interface{}, d time.Duration) (time.Time, error) {
+	if err := s.bind(); err != nil {
+		return time.Time{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.setExpires(s.key(key), s.sec, d)
+}
+
+func (s *section) ExpiresAt(key interface{}, t time.Time) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	_, err := s.tm.setExpiresAt(s.key(key), s.sec, t)
+	return err
+}
+
+func (s *section) AddCallback(key interface{}, cb ...callback) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.addCallback(s.key(key), s.sec, cb...)
+}
+
+func (s *section) CallbackCount(key interface{}) (int, error) {
+	if err := s.bind(); err != nil {
+		return 0, err
+	}
+	defer s.unbind()
+
+	return s.tm.callbackCount(s.key(key), s.sec)
+}
+
+func (s *section) SetMaxLifetime(key interface{}, d time.Duration) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setMaxLifetime(s.key(key), s.sec, d)
+}
+
+func (s *section) SetFinalizer(key interface{}, fn func(value interface{})) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setFinalizer(s.key(key), s.sec, fn)
+}
+
+func (s *section) ClearCallbacks(key interface{}) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.clearCallbacks(s.key(key), s.sec)
+}
+
+func (s *section) SetWarning(key interface{}, before time.Duration, cb ...callback) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setWarning(s.key(key), s.sec, before, cb...)
+}
+
+func (s *section) Hold(key interface{}) (release func(), err error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	defer s.unbind()
+
+	return s.tm.hold(s.key(key), s.sec)
+}
+
+func (s *section) SetDecay(key interface{}, fn DecayFunc) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setDecay(s.key(key), s.sec, fn)
+}
+
+func (s *section) SetSoftExpires(key interface{}, d time.Duration, cb ...callback) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.setSoftExpires(s.key(key), s.sec, d, cb...)
+}
+
+func (s *section) IsStale(key interface{}) (bool, error) {
+	if err := s.bind(); err != nil {
+		return false, err
+	}
+	defer s.unbind()
+
+	return s.tm.isStale(s.key(key), s.sec)
 }
 
 func (s *section) Contains(key interface{}) bool {
-	return s.tm.get(key, s.sec) != nil
+	if s.bind() != nil {
+		return false
+	}
+	defer s.unbind()
+
+	return s.tm.contains(s.key(key), s.sec)
 }
 
 func (s *section) Remove(key interface{}) {
-	s.tm.remove(key, s.sec)
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.remove(s.key(key), s.sec)
+}
+
+func (s *section) Expire(key interface{}) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.expire(s.key(key), s.sec)
+}
+
+func (s *section) Rename(oldKey, newKey interface{}) error {
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	return s.tm.rename(s.key(oldKey), s.key(newKey), s.sec)
+}
+
+func (s *section) RemoveMulti(keys ...interface{}) int {
+	if s.bind() != nil {
+		return 0
+	}
+	defer s.unbind()
+
+	return s.tm.removeMulti(s.key, s.sec, keys)
+}
+
+func (s *section) RemoveWhere(fn func(key, value interface{}) bool) int {
+	if s.bind() != nil {
+		return 0
+	}
+	defer s.unbind()
+
+	return s.tm.removeWhere(s.owns, fn)
+}
+
+func (s *section) Pop(key interface{}) (val interface{}, ok bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.pop(s.key(key), s.sec)
 }
 
 func (s *section) Refresh(key interface{}, d time.Duration) error {
-	return s.tm.refresh(key, s.sec, d)
+	if err := s.bind(); err != nil {
+		return err
+	}
+	defer s.unbind()
+
+	_, err := s.tm.refresh(s.key(key), s.sec, d)
+	return err
+}
+
+func (s *section) RefreshPrev(key interface{}, d time.Duration) (time.Time, error) {
+	if err := s.bind(); err != nil {
+		return time.Time{}, err
+	}
+	defer s.unbind()
+
+	return s.tm.refresh(s.key(key), s.sec, d)
+}
+
+func (s *section) GetAndRefresh(key interface{}, d time.Duration) (interface{}, error) {
+	if err := s.bind(); err != nil {
+		return nil, err
+	}
+	defer s.unbind()
+
+	return s.tm.getAndRefresh(s.key(key), s.sec, d)
 }
 
 func (s *section) Flush() {
-	for k := range s.tm.container {
-		if k.sec == s.sec {
-			s.tm.remove(k.key, k.sec)
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	if s.tm.checkClosed() != nil {
+		return
+	}
+
+	s.tm.mtx.Lock()
+	defer s.tm.mtx.Unlock()
+
+	for k, v := range s.tm.container {
+		if _, ok := s.owns(k); ok {
+			s.tm.bulkDeleteElement(k, v)
 		}
 	}
+	s.tm.paceRemovals()
+}
+
+func (s *section) SizeLive() int {
+	if s.bind() != nil {
+		return 0
+	}
+	defer s.unbind()
+
+	return s.tm.sizeLive(s.owns)
 }
 
 func (s *section) Size() (i int) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	if s.tm.checkClosed() != nil {
+		return
+	}
+
+	s.tm.mtx.RLock()
+	defer s.tm.mtx.RUnlock()
+
 	for k := range s.tm.container {
-		if k.sec == s.sec {
+		if _, ok := s.owns(k); ok {
 			i++
 		}
 	}
@@ -132,5 +1075,253 @@ func (s *section) Size() (i int) {
 }
 
 func (s *section) Snapshot() map[interface{}]interface{} {
-	return s.tm.getSnapshot(s.sec)
+	m := make(map[interface{}]interface{})
+	s.fillSnapshot(m)
+	return m
+}
+
+func (s *section) SnapshotEntries() map[interface{}]Entry {
+	if s.bind() != nil {
+		return make(map[interface{}]Entry)
+	}
+	defer s.unbind()
+
+	return s.tm.snapshotEntries(s.owns, s.sec)
+}
+
+func (s *section) StreamSnapshot(ctx context.Context) <-chan Entry {
+	if s.bind() != nil {
+		c := make(chan Entry)
+		close(c)
+		return c
+	}
+	defer s.unbind()
+
+	return s.tm.streamSnapshot(ctx, s.owns)
+}
+
+func (s *section) SnapshotPage(cursor, limit int) (page map[interface{}]interface{}, nextCursor int) {
+	if s.bind() != nil {
+		return make(map[interface{}]interface{}), 0
+	}
+	defer s.unbind()
+
+	return s.tm.snapshotPage(s.owns, cursor, limit)
+}
+
+func (s *section) SnapshotInto(dst map[interface{}]interface{}) {
+	clearSnapshot(dst)
+	s.fillSnapshot(dst)
+}
+
+func (s *section) BorrowSnapshot() (m map[interface{}]interface{}, release func()) {
+	return s.tm.borrowSnapshot(s.fillSnapshot)
+}
+
+func (s *section) Values() []interface{} {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.values(s.owns)
+}
+
+func (s *section) Range(fn func(key, value interface{}) bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	s.tm.rangeElements(s.owns, fn)
+}
+
+func (s *section) View(transform TransformFunc) ReadOnlyMap {
+	return newView(s, transform)
+}
+
+func (s *section) ExpiredKeys() []interface{} {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.expiredKeys(s.owns)
+}
+
+func (s *section) KeysExpiringBefore(t time.Time) []interface{} {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.keysExpiringBefore(s.owns, t)
+}
+
+func (s *section) SetNegative(key interface{}) time.Duration {
+	if s.bind() != nil {
+		return 0
+	}
+	defer s.unbind()
+
+	return s.tm.setNegative(s.key(key), s.sec)
+}
+
+func (s *section) IsNegative(key interface{}) bool {
+	if s.bind() != nil {
+		return false
+	}
+	defer s.unbind()
+
+	return s.tm.isNegative(s.key(key), s.sec)
+}
+
+func (s *section) KeysByExpiry() []interface{} {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.keysByExpiry(s.owns)
+}
+
+func (s *section) SoonestExpiring(n int) []Entry {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.soonestExpiring(s.owns, s.sec, n)
+}
+
+func (s *section) NextExpiry() (t time.Time, ok bool) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	return s.tm.nextExpiry(s.owns)
+}
+
+func (s *section) SampleKeys(n int) []interface{} {
+	if s.bind() != nil {
+		return nil
+	}
+	defer s.unbind()
+
+	return s.tm.sampleKeys(s.owns, n)
+}
+
+// fillSnapshot writes all key-value pairs
+// of the section into m.
+func (s *section) fillSnapshot(m map[interface{}]interface{}) {
+	if s.bind() != nil {
+		return
+	}
+	defer s.unbind()
+
+	if s.prefix == "" {
+		s.tm.fillSnapshot(m, s.sec)
+		return
+	}
+
+	if s.tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	s.tm.mtx.RLock()
+	defer s.tm.mtx.RUnlock()
+
+	for k, v := range s.tm.container {
+		if key, ok := s.owns(k); ok {
+			m[key] = v.valueAt(now)
+		}
+	}
+}
+
+// bind ensures that the section has not been
+// deleted since s has been created and prevents
+// the section from being deleted until unbind
+// is called. If the section has been deleted,
+// the StaleSectionPolicy of the map decides if
+// s is bound to the new section or
+// ErrSectionDeleted is returned. unbind must
+// only be called if bind returned nil.
+func (s *section) bind() error {
+	s.tm.sectionMtx.RLock()
+
+	if s.done != nil {
+		select {
+		case <-s.done:
+			s.tm.sectionMtx.RUnlock()
+			return ErrSectionDeleted
+		default:
+		}
+	}
+
+	gen := s.tm.sectionGens[s.sec]
+	if atomic.LoadUint64(&s.gen) == gen {
+		return nil
+	}
+
+	if s.tm.staleSectionPolicy == StaleSectionRebind {
+		atomic.StoreUint64(&s.gen, gen)
+		return nil
+	}
+
+	s.tm.sectionMtx.RUnlock()
+	return ErrSectionDeleted
+}
+
+// unbind allows the section to be deleted
+// again after a call to bind.
+func (s *section) unbind() {
+	s.tm.sectionMtx.RUnlock()
+}
+
+// key returns the key as stored in the
+// container for the passed key.
+func (s *section) key(key interface{}) interface{} {
+	key = s.tm.key(key)
+	if s.prefix == "" {
+		return key
+	}
+	if sk, ok := key.(string); ok {
+		return s.prefix + sk
+	}
+	return prefixedKey{prefix: s.prefix, key: key}
+}
+
+// prefixedKey is the container key of a key which
+// is not of type string passed to a section with a
+// key prefix, so that it does not collide with the
+// same key of the map or of other prefixes.
+type prefixedKey struct {
+	prefix string
+	key    interface{}
+}
+
+// owns returns true if the given container key
+// belongs to the section. Also, the key as seen
+// from the section is returned.
+func (s *section) owns(k keyWrap) (interface{}, bool) {
+	if k.sec != s.sec {
+		return nil, false
+	}
+	if s.prefix == "" {
+		return k.key, true
+	}
+	if pk, ok := k.key.(prefixedKey); ok {
+		if pk.prefix != s.prefix {
+			return nil, false
+		}
+		return pk.key, true
+	}
+	sk, ok := k.key.(string)
+	if !ok || !strings.HasPrefix(sk, s.prefix) {
+		return nil, false
+	}
+	return sk[len(s.prefix):], true
 }
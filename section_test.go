@@ -53,6 +53,79 @@ func TestSectionSet(t *testing.T) {
 	assert.Nil(t, tm.get(key, sec))
 }
 
+func TestSectionSetReported(t *testing.T) {
+	tm := New(dCleanupTick)
+	s := tm.Section(1)
+
+	tm.Set(1, "x", time.Hour)
+
+	old, replaced := s.SetReported(1, "a", time.Hour)
+	assert.False(t, replaced)
+	assert.Nil(t, old)
+
+	old, replaced = s.SetReported(1, "b", time.Hour)
+	assert.True(t, replaced)
+	assert.EqualValues(t, "a", old)
+	assert.EqualValues(t, "x", tm.GetValue(1))
+}
+
+func TestSectionSetMulti(t *testing.T) {
+	tm := New(0)
+
+	p := tm.WithKeyPrefix("p:")
+	assert.Nil(t, p.SetMulti(map[string]int{"a": 1, "b": 2}, time.Hour))
+	assert.EqualValues(t, 1, tm.GetValue("p:a"))
+	assert.EqualValues(t, 2, p.GetValue("b"))
+
+	s := tm.Section(1)
+	assert.Nil(t, s.SetMulti(map[int]int{1: 1}, time.Hour))
+	assert.EqualValues(t, 1, s.GetValue(1))
+	assert.False(t, tm.Contains(1))
+}
+
+func TestSectionGetOrSet(t *testing.T) {
+	tm := New(dCleanupTick)
+	s := tm.Section(1)
+
+	tm.Set(1, "x", time.Hour)
+
+	actual, loaded := s.GetOrSet(1, "a", time.Hour)
+	assert.False(t, loaded)
+	assert.EqualValues(t, "a", actual)
+
+	actual, loaded = s.GetOrSet(1, "b", time.Hour)
+	assert.True(t, loaded)
+	assert.EqualValues(t, "a", actual)
+}
+
+func TestSectionSetIfNotExists(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	tm.Set(1, "x", time.Hour)
+	assert.True(t, s.SetIfNotExists(1, "a", time.Hour))
+	assert.False(t, s.SetIfNotExists(1, "b", time.Hour))
+	assert.EqualValues(t, "a", s.GetValue(1))
+}
+
+func TestSectionUpdate(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	tm.Set(1, "x", time.Hour)
+	s.Update(1, func(old interface{}, exists bool) (interface{}, time.Duration) {
+		assert.False(t, exists)
+		assert.Nil(t, old)
+		return "a", time.Hour
+	})
+	s.Update(1, func(old interface{}, exists bool) (interface{}, time.Duration) {
+		assert.True(t, exists)
+		return old.(string) + "b", time.Hour
+	})
+	assert.EqualValues(t, "ab", s.GetValue(1))
+	assert.EqualValues(t, "x", tm.GetValue(1))
+}
+
 func TestSectionGetValue(t *testing.T) {
 	const key = "tKeyGetVal"
 	const val = "tValGetVal"
@@ -77,6 +150,31 @@ func TestSectionGetValue(t *testing.T) {
 	assert.Nil(t, s.GetValue(key))
 }
 
+func TestSectionTryGetValue(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	tm.Set(1, 1, time.Hour)
+	_, ok := s.TryGetValue(1)
+	assert.False(t, ok)
+
+	s.Set(1, "", time.Hour)
+	v, ok := s.TryGetValue(1)
+	assert.True(t, ok)
+	assert.EqualValues(t, "", v)
+}
+
+func TestSectionGetValueDefault(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	tm.Set(1, 1, time.Hour)
+	assert.EqualValues(t, 2, s.GetValueDefault(1, 2))
+
+	s.Set(1, 3, time.Hour)
+	assert.EqualValues(t, 3, s.GetValueDefault(1, 2))
+}
+
 func TestSectionGetExpire(t *testing.T) {
 	const key = "tKeyGetExp"
 	const val = "tValGetExp"
@@ -122,6 +220,39 @@ func TestSectionSetExpires(t *testing.T) {
 	assert.Nil(t, tm.get(key, sec))
 }
 
+func TestSectionSetWarning(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
+
+	tm := New(0)
+	s := tm.Section(1)
+
+	assert.ErrorIs(t, s.SetWarning("keyNotExists", time.Second), ErrKeyNotFound)
+
+	s.Set(1, 3, time.Hour)
+	assert.ErrorIs(t, tm.SetWarning(1, time.Second), ErrKeyNotFound)
+	assert.Nil(t, s.SetWarning(1, 2*time.Hour, cb.Cb))
+
+	tm.cleanUp()
+	cb.AssertNumberOfCalls(t, "Cb", 1)
+	assert.EqualValues(t, 3, cb.TestData().Get("v").Int())
+	assert.True(t, s.Contains(1))
+}
+
+func TestSectionSetSoftExpires(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	s.Set(1, 3, time.Hour)
+	assert.ErrorIs(t, tm.SetSoftExpires(1, 0), ErrKeyNotFound)
+	assert.Nil(t, s.SetSoftExpires(1, 0))
+	time.Sleep(time.Millisecond)
+
+	stale, err := s.IsStale(1)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+}
+
 func TestSectionContains(t *testing.T) {
 	const key = "tKeyCont"
 	const sec = 1
@@ -152,6 +283,53 @@ func TestSectionRemove(t *testing.T) {
 	assert.Nil(t, tm.get(key, sec))
 }
 
+func TestSectionRemoveMulti(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	for i := 0; i < 5; i++ {
+		tm.Set(i, i, time.Hour)
+		s.Set(i, i, time.Hour)
+	}
+
+	assert.EqualValues(t, 2, s.RemoveMulti(0, 1))
+	assert.EqualValues(t, 3, s.Size())
+	assert.Len(t, tm.Snapshot(), 5)
+}
+
+func TestSectionRemoveWhere(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	for i := 0; i < 4; i++ {
+		tm.Set(i, i, time.Hour)
+		s.Set(i, i, time.Hour)
+	}
+
+	n := s.RemoveWhere(func(key, value interface{}) bool {
+		return key.(int) < 2
+	})
+	assert.EqualValues(t, 2, n)
+	assert.EqualValues(t, 2, s.Size())
+	assert.Len(t, tm.Snapshot(), 4)
+}
+
+func TestSectionPop(t *testing.T) {
+	tm := New(0)
+	s := tm.Section(1)
+
+	tm.Set(1, 1, time.Hour)
+	_, ok := s.Pop(1)
+	assert.False(t, ok)
+
+	s.Set(1, 2, time.Hour)
+	v, ok := s.Pop(1)
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, v)
+	assert.False(t, s.Contains(1))
+	assert.True(t, tm.Contains(1))
+}
+
 func TestSectionRefresh(t *testing.T) {
 	const key = "tKeyRef"
 	const sec = 1
@@ -216,3 +394,154 @@ func TestSectionSnapshot(t *testing.T) {
 		}
 	}
 }
+
+func TestSectionBorrowSnapshot(t *testing.T) {
+	tm := New(1 * time.Minute)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, i%2, i, 1*time.Minute)
+	}
+
+	m, release := tm.Section(1).BorrowSnapshot()
+	assert.Len(t, m, 5)
+	for i := 1; i < 10; i += 2 {
+		assert.EqualValues(t, i, m[i])
+	}
+
+	release()
+	assert.Len(t, m, 0)
+}
+
+func TestSectionValues(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, i%2, i, time.Hour)
+	}
+
+	vals := tm.Section(1).Values()
+	assert.ElementsMatch(t, []interface{}{1, 3, 5, 7, 9}, vals)
+
+	p := tm.WithKeyPrefix("p:")
+	p.Set("a", "a", time.Hour)
+	assert.Equal(t, []interface{}{"a"}, p.Values())
+}
+
+func TestSectionRange(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, i%2, i, time.Hour)
+	}
+
+	var keys []interface{}
+	tm.Section(1).Range(func(key, value interface{}) bool {
+		assert.Equal(t, key, value)
+		keys = append(keys, key)
+		return true
+	})
+	assert.ElementsMatch(t, []interface{}{1, 3, 5, 7, 9}, keys)
+}
+
+func TestSectionSampleKeys(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 100; i++ {
+		tm.set(i, i%10, i, time.Hour)
+	}
+
+	keys := tm.Section(3).SampleKeys(20)
+	assert.Len(t, keys, 10)
+	for _, k := range keys {
+		assert.EqualValues(t, 3, k.(int)%10)
+	}
+}
+
+func TestSectionWithKeyPrefix(t *testing.T) {
+	tm := New(dCleanupTick)
+	s := tm.WithKeyPrefix("foo:")
+
+	tm.Set("bar", 0, time.Hour)
+	s.Set("bar", 1, time.Hour)
+	s.Set("bazz", 2, time.Hour)
+
+	assert.EqualValues(t, 0, s.Ident())
+	assert.EqualValues(t, 0, tm.GetValue("bar"))
+	assert.EqualValues(t, 1, tm.GetValue("foo:bar"))
+	assert.EqualValues(t, 1, s.GetValue("bar"))
+	assert.True(t, s.Contains("bazz"))
+	assert.False(t, s.Contains("foo:bazz"))
+
+	assert.EqualValues(t, 2, s.Size())
+	assert.Equal(t, map[interface{}]interface{}{"bar": 1, "bazz": 2}, s.Snapshot())
+
+	s.Remove("bazz")
+	assert.False(t, tm.Contains("foo:bazz"))
+
+	s.Flush()
+	assert.EqualValues(t, 0, s.Size())
+	assert.EqualValues(t, 1, tm.Size())
+}
+
+func TestSectionWithKeyPrefixNonString(t *testing.T) {
+	tm := New(0)
+	s := tm.WithKeyPrefix("foo:")
+	o := tm.WithKeyPrefix("bar:")
+
+	tm.Set(1, 0, time.Hour)
+	s.Set(1, 1, time.Hour)
+	o.Set(1, 2, time.Hour)
+
+	assert.EqualValues(t, 0, tm.GetValue(1))
+	assert.EqualValues(t, 1, s.GetValue(1))
+	assert.EqualValues(t, 2, o.GetValue(1))
+
+	assert.Equal(t, map[interface{}]interface{}{1: 1}, s.Snapshot())
+	assert.Equal(t, []interface{}{1}, s.Values())
+	assert.Equal(t, []interface{}{1}, s.SampleKeys(10))
+
+	s.Flush()
+	assert.EqualValues(t, 0, tm.GetValue(1))
+	assert.EqualValues(t, 2, o.GetValue(1))
+}
+
+func TestSectionDeleteSection(t *testing.T) {
+	// Test error policy
+	{
+		tm := New(0)
+		s := tm.Section(1)
+		other := tm.Section(2)
+
+		s.Set(1, 1, time.Hour)
+		other.Set(1, 2, time.Hour)
+
+		tm.DeleteSection(1)
+		assert.EqualValues(t, 1, other.Size())
+
+		s.Set(2, 2, time.Hour)
+		assert.Nil(t, s.GetValue(2))
+		assert.ErrorIs(t, s.Refresh(2, time.Hour), ErrSectionDeleted)
+		_, err := s.GetExpires(2)
+		assert.ErrorIs(t, err, ErrSectionDeleted)
+
+		recreated := tm.Section(1)
+		assert.EqualValues(t, 0, recreated.Size())
+		recreated.Set(1, 3, time.Hour)
+		assert.EqualValues(t, 3, recreated.GetValue(1))
+		assert.False(t, s.Contains(1))
+		assert.EqualValues(t, 2, other.GetValue(1))
+	}
+
+	// Test rebind policy
+	{
+		tm := NewWithOptions(0, WithStaleSectionPolicy(StaleSectionRebind))
+		s := tm.Section(1)
+
+		s.Set(1, 1, time.Hour)
+		tm.DeleteSection(1)
+		assert.False(t, s.Contains(1))
+
+		s.Set(1, 2, time.Hour)
+		assert.EqualValues(t, 2, tm.Section(1).GetValue(1))
+	}
+}
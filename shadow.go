@@ -0,0 +1,123 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ShadowStats contains the read statistics
+// collected by a Shadow.
+type ShadowStats struct {
+	// Reads is the number of reads performed.
+	Reads uint64
+	// PrimaryHits is the number of reads which
+	// found a value in the primary map.
+	PrimaryHits uint64
+	// ShadowHits is the number of reads which
+	// found a value in the shadow map.
+	ShadowHits uint64
+	// Divergences is the number of reads where
+	// the primary and the shadow map had a
+	// different hit or miss outcome.
+	Divergences uint64
+}
+
+// Shadow mirrors all writes to a primary and a shadow
+// map, which can be configured differently. Reads are
+// served from the primary map but are also performed
+// on the shadow map to compare the hit and miss
+// outcomes of both.
+//
+// This allows to validate a new map configuration
+// against production traffic before switching to it.
+type Shadow struct {
+	reads       uint64
+	primaryHits uint64
+	shadowHits  uint64
+	divergences uint64
+
+	primary Section
+	shadow  Section
+}
+
+// NewShadow creates and returns a new instance of
+// Shadow wrapping the given primary and shadow map.
+func NewShadow(primary, shadow Section) *Shadow {
+	return &Shadow{
+		primary: primary,
+		shadow:  shadow,
+	}
+}
+
+// Set sets the key-value pair in both maps. The
+// callbacks are only registered in the primary map
+// so that they are not executed twice.
+func (s *Shadow) Set(key, value interface{}, expiresAfter time.Duration, cb ...callback) {
+	s.primary.Set(key, value, expiresAfter, cb...)
+	s.shadow.Set(key, value, expiresAfter)
+}
+
+// GetValue returns the value of the key in the
+// primary map and records the outcome of the read
+// compared to the shadow map.
+func (s *Shadow) GetValue(key interface{}) interface{} {
+	val, _ := s.TryGetValue(key)
+	return val
+}
+
+// TryGetValue returns the value of the key in the
+// primary map and records the outcome of the read
+// compared to the shadow map.
+func (s *Shadow) TryGetValue(key interface{}) (val interface{}, ok bool) {
+	val, ok = s.primary.TryGetValue(key)
+	_, shadowOk := s.shadow.TryGetValue(key)
+	s.record(ok, shadowOk)
+	return
+}
+
+// Contains returns true, if the key exists in the
+// primary map and records the outcome of the read
+// compared to the shadow map.
+func (s *Shadow) Contains(key interface{}) bool {
+	ok := s.primary.Contains(key)
+	s.record(ok, s.shadow.Contains(key))
+	return ok
+}
+
+// Remove deletes the key-value pair in both maps.
+func (s *Shadow) Remove(key interface{}) {
+	s.primary.Remove(key)
+	s.shadow.Remove(key)
+}
+
+// Flush deletes all key-value pairs of both maps.
+func (s *Shadow) Flush() {
+	s.primary.Flush()
+	s.shadow.Flush()
+}
+
+// Stats returns the read statistics
+// collected so far.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Reads:       atomic.LoadUint64(&s.reads),
+		PrimaryHits: atomic.LoadUint64(&s.primaryHits),
+		ShadowHits:  atomic.LoadUint64(&s.shadowHits),
+		Divergences: atomic.LoadUint64(&s.divergences),
+	}
+}
+
+// record adds the outcome of a read
+// to the statistics.
+func (s *Shadow) record(primaryHit, shadowHit bool) {
+	atomic.AddUint64(&s.reads, 1)
+	if primaryHit {
+		atomic.AddUint64(&s.primaryHits, 1)
+	}
+	if shadowHit {
+		atomic.AddUint64(&s.shadowHits, 1)
+	}
+	if primaryHit != shadowHit {
+		atomic.AddUint64(&s.divergences, 1)
+	}
+}
@@ -0,0 +1,44 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadow(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
+
+	primary := New(0)
+	shadow := New(0)
+	s := NewShadow(primary, shadow)
+
+	s.Set(1, "a", time.Hour, cb.Cb)
+	assert.EqualValues(t, "a", primary.GetValue(1))
+	assert.EqualValues(t, "a", shadow.GetValue(1))
+
+	assert.EqualValues(t, "a", s.GetValue(1))
+	assert.Equal(t, ShadowStats{Reads: 1, PrimaryHits: 1, ShadowHits: 1}, s.Stats())
+
+	shadow.Remove(1)
+	assert.True(t, s.Contains(1))
+	assert.Equal(t, ShadowStats{Reads: 2, PrimaryHits: 2, ShadowHits: 1, Divergences: 1}, s.Stats())
+
+	s.Remove(1)
+	_, ok := s.TryGetValue(1)
+	assert.False(t, ok)
+	assert.Equal(t, ShadowStats{Reads: 3, PrimaryHits: 2, ShadowHits: 1, Divergences: 1}, s.Stats())
+
+	s.Set(2, "b", 0, cb.Cb)
+	time.Sleep(time.Millisecond)
+	primary.cleanUp()
+	shadow.cleanUp()
+	cb.AssertNumberOfCalls(t, "Cb", 1)
+
+	s.Set(3, "c", time.Hour)
+	s.Flush()
+	assert.EqualValues(t, 0, primary.Size())
+	assert.EqualValues(t, 0, shadow.Size())
+}
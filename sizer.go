@@ -0,0 +1,62 @@
+package timedmap
+
+import (
+	"sort"
+	"time"
+)
+
+// KeyCost contains the key of a key-value pair
+// together with its cost as reported by the sizer
+// of the map.
+type KeyCost struct {
+	Key  interface{}
+	Cost int
+	// Section is the identifier of the
+	// section containing the pair.
+	Section int
+}
+
+// LargestEntries returns the keys and costs of the at
+// most n non-expired key-value pairs of all sections of
+// the map with the highest cost, sorted descending by
+// their cost.
+//
+// The costs are only tracked when the map was created
+// using WithSizer, otherwise nil is returned. Changes of
+// a value which has not been set again, e.g. of a map
+// value modified in place, are not reflected.
+func (tm *TimedMap) LargestEntries(n int) []KeyCost {
+	return tm.largestEntries(ownsAll, n)
+}
+
+// largestEntries returns the at most n non-expired
+// elements matched by owns with the highest cost.
+func (tm *TimedMap) largestEntries(owns ownsFunc, n int) []KeyCost {
+	if tm.checkClosed() != nil || n <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	if tm.sizer == nil {
+		tm.mtx.RUnlock()
+		return nil
+	}
+	costs := make([]KeyCost, 0, len(tm.container))
+	for k, v := range tm.container {
+		if key, ok := owns(k); ok && !v.expired(now) {
+			costs = append(costs, KeyCost{key, v.cost, k.sec})
+		}
+	}
+	tm.mtx.RUnlock()
+
+	sort.SliceStable(costs, func(i, j int) bool {
+		return costs[i].Cost > costs[j].Cost
+	})
+
+	if len(costs) > n {
+		costs = costs[:n]
+	}
+	return costs
+}
@@ -0,0 +1,33 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargestEntries(t *testing.T) {
+	tm := NewWithOptions(0, WithSizer(func(key, value interface{}) int {
+		return len(value.(string))
+	}))
+
+	tm.Set(1, "a", time.Hour)
+	tm.Set(2, "aaaa", time.Hour)
+	tm.Set(3, "aaaaaaaa", 0)
+	tm.Set(4, "aa", time.Hour)
+	tm.Section(1).Set(5, "aaa", time.Hour)
+	time.Sleep(time.Millisecond)
+
+	assert.Equal(t, []KeyCost{
+		{Key: 2, Cost: 4},
+		{Key: 5, Cost: 3, Section: 1},
+	}, tm.LargestEntries(2))
+	assert.Len(t, tm.LargestEntries(10), 4)
+	assert.Nil(t, tm.LargestEntries(0))
+
+	tm.Set(1, "aaaaa", time.Hour)
+	assert.Equal(t, []KeyCost{{Key: 1, Cost: 5}}, tm.LargestEntries(1))
+
+	assert.Nil(t, New(0).LargestEntries(1))
+}
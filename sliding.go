@@ -0,0 +1,57 @@
+package timedmap
+
+import "time"
+
+// SetSliding appends a key-value pair to the map or sets
+// the value of a key like Set, using idle as sliding
+// expiration. Each time the value is read using GetValue,
+// TryGetValue, GetValueE or GetValueDefault, the pair
+// is refreshed to expire idle after the read, so that it
+// only expires after not being read for idle.
+//
+// Setting the value again using any other set function
+// stops the sliding expiration of the pair, unless the
+// map was created using WithSlidingExpiration.
+func (tm *TimedMap) SetSliding(key, value interface{}, idle time.Duration, cb ...callback) {
+	tm.setSliding(tm.key(key), 0, value, idle, cb...)
+}
+
+// setSliding sets the value for a key and section
+// with the sliding expiration idle.
+func (tm *TimedMap) setSliding(
+	key interface{},
+	sec int,
+	val interface{},
+	idle time.Duration,
+	cb ...callback,
+) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.slideNext = true
+	tm.setLocked(key, sec, val, idle, cb...)
+	tm.slideNext = false
+}
+
+// slide resets the expiration of the element v stored
+// by key in the given section to now plus its sliding
+// expiration, if set.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) slide(key interface{}, sec int, v *element, now time.Time) {
+	if v.sliding <= 0 {
+		return
+	}
+	v.expires = now.Add(v.sliding)
+	v.capExpires()
+	v.warned = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+}
@@ -0,0 +1,63 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSliding(t *testing.T) {
+	tm := New(0)
+
+	tm.SetSliding(1, 1, time.Minute)
+	tm.Set(2, 2, time.Minute)
+
+	for _, k := range []int{1, 2} {
+		assert.Nil(t, tm.SetExpires(k, time.Second))
+	}
+	assert.Equal(t, 1, tm.GetValue(1))
+	assert.Equal(t, 2, tm.GetValue(2))
+
+	assert.InDelta(t, time.Minute, time.Until(getExpires(t, tm, 1)), float64(time.Second))
+	assert.InDelta(t, time.Second, time.Until(getExpires(t, tm, 2)), float64(time.Second))
+
+	tm.Set(1, 3, time.Second)
+	assert.Equal(t, 3, tm.GetValue(1))
+	assert.InDelta(t, time.Second, time.Until(getExpires(t, tm, 1)), float64(time.Second))
+
+	tm.Section(1).SetSliding(1, 1, 50*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, ok := tm.Section(1).TryGetValue(1)
+		assert.True(t, ok)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, ok := tm.Section(1).TryGetValue(1)
+	assert.False(t, ok)
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	tm := NewWithOptions(0, WithSlidingExpiration())
+
+	tm.Set(1, 1, time.Minute)
+	assert.Nil(t, tm.SetExpires(1, time.Second))
+	_, err := tm.GetValueE(1)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Minute, time.Until(getExpires(t, tm, 1)), float64(time.Second))
+
+	tm.Set(1, 2, KeepTTL)
+	assert.Nil(t, tm.SetExpires(1, time.Second))
+	assert.Equal(t, 2, tm.GetValueDefault(1, nil))
+	assert.InDelta(t, time.Minute, time.Until(getExpires(t, tm, 1)), float64(time.Second))
+
+	tm.Set(1, 3, time.Hour)
+	tm.GetValue(1)
+	assert.InDelta(t, time.Hour, time.Until(getExpires(t, tm, 1)), float64(time.Second))
+}
+
+func getExpires(t *testing.T, tm *TimedMap, key interface{}) time.Time {
+	exp, err := tm.GetExpires(key)
+	assert.Nil(t, err)
+	return exp
+}
@@ -0,0 +1,307 @@
+package timedmap
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// histSubBits is the number of bits used for the
+	// linear sub-buckets of each power of two, which
+	// results in a maximum relative error of 12.5%.
+	histSubBits    = 3
+	histSubBuckets = 1 << histSubBits
+	histBuckets    = histSubBuckets + (64-histSubBits)*histSubBuckets
+)
+
+// Stats contains statistics collected by a TimedMap.
+type Stats struct {
+	// SetLatency contains the latencies of set
+	// operations. Only recorded when the map was
+	// created using WithLatencyTracking.
+	SetLatency LatencyHistogram
+	// GetLatency contains the latencies of get
+	// operations. Only recorded when the map was
+	// created using WithLatencyTracking.
+	GetLatency LatencyHistogram
+	// CleanupLatency contains the latencies of
+	// cleanup cycles. Only recorded when the map
+	// was created using WithLatencyTracking.
+	CleanupLatency LatencyHistogram
+	// Forecast contains the number of key-value
+	// pairs about to expire as of the call of Stats.
+	Forecast ExpiryForecast
+	// Maintenance contains the statistics of the
+	// maintenance passes run on the map.
+	Maintenance MaintenanceStats
+	// CleanupYields is the number of times cleanup
+	// cycles have released the write lock to let
+	// other operations proceed, when the map was
+	// created using WithCleanupYield.
+	CleanupYields uint64
+	// DroppedCallbacks is the number of expirations
+	// whose callbacks have been dropped as the callback
+	// queue was full, when the map was created using
+	// WithAsyncCallbacks and OverflowDropOldest.
+	DroppedCallbacks uint64
+}
+
+// ExpiryForecast contains the number of key-value
+// pairs expiring within the next 1, 10 and 60 seconds.
+// The counts are cumulative, so In10s includes all
+// pairs of In1s. Pairs which have already expired,
+// including pairs in their grace period, are not
+// counted. Pairs are counted in buckets of 100ms by
+// their expiration time, so a pair expired early by
+// its DecayFunc may still be counted until it is
+// removed from the map.
+type ExpiryForecast struct {
+	// At is the time at which the pairs
+	// have been counted.
+	At    time.Time
+	In1s  int
+	In10s int
+	In60s int
+}
+
+// add counts n key-value pairs expiring after d.
+func (f *ExpiryForecast) add(d time.Duration, n int) {
+	if d > time.Minute {
+		return
+	}
+	f.In60s += n
+	if d > 10*time.Second {
+		return
+	}
+	f.In10s += n
+	if d > time.Second {
+		return
+	}
+	f.In1s += n
+}
+
+// forecastSpan returns the index of the smallest
+// forecast window a pair expiring after d falls in.
+func forecastSpan(d time.Duration) int {
+	switch {
+	case d <= time.Second:
+		return 0
+	case d <= 10*time.Second:
+		return 1
+	case d <= time.Minute:
+		return 2
+	}
+	return 3
+}
+
+// LatencyHistogram contains recorded latencies in
+// logarithmic buckets with linear sub-buckets.
+type LatencyHistogram struct {
+	count   uint64
+	buckets [histBuckets]uint64
+}
+
+// Count returns the number of recorded latencies.
+func (h LatencyHistogram) Count() uint64 {
+	return h.count
+}
+
+// Percentile returns the upper bound of the bucket
+// containing the latency at the given percentile p,
+// which must be in the range of [0, 100]. If no
+// latencies have been recorded, 0 is returned.
+func (h LatencyHistogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(p / 100 * float64(h.count))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cum uint64
+	for i, n := range h.buckets {
+		cum += n
+		if cum >= rank {
+			return histUpperBound(i)
+		}
+	}
+
+	return histUpperBound(histBuckets - 1)
+}
+
+// latencyTracker holds the latency
+// histograms recorded by a TimedMap.
+type latencyTracker struct {
+	set     histogram
+	get     histogram
+	cleanup histogram
+}
+
+// histogram records latencies concurrently
+// safe into logarithmic buckets.
+type histogram struct {
+	count   uint64
+	buckets [histBuckets]uint64
+}
+
+// since records the time elapsed since start.
+func (h *histogram) since(start time.Time) {
+	d := time.Since(start)
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.buckets[histIndex(uint64(d))], 1)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// snapshot returns the current state
+// of the histogram.
+func (h *histogram) snapshot() (s LatencyHistogram) {
+	for i := range h.buckets {
+		s.buckets[i] = atomic.LoadUint64(&h.buckets[i])
+		s.count += s.buckets[i]
+	}
+	return
+}
+
+// histIndex returns the bucket index
+// for the given value v.
+func histIndex(v uint64) int {
+	if v < histSubBuckets {
+		return int(v)
+	}
+	e := bits.Len64(v) - 1
+	sub := (v >> uint(e-histSubBits)) & (histSubBuckets - 1)
+	return histSubBuckets + (e-histSubBits)*histSubBuckets + int(sub)
+}
+
+// histUpperBound returns the largest value
+// stored in the bucket with the index i.
+func histUpperBound(i int) time.Duration {
+	if i < histSubBuckets {
+		return time.Duration(i)
+	}
+	e := (i-histSubBuckets)/histSubBuckets + histSubBits
+	sub := uint64((i - histSubBuckets) % histSubBuckets)
+	upper := (histSubBuckets+sub+1)<<uint(e-histSubBits) - 1
+	if upper > uint64(1<<63-1) {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(upper)
+}
+
+// Stats returns the statistics collected
+// by the map.
+func (tm *TimedMap) Stats() (s Stats) {
+	if tm.latencies != nil {
+		s.SetLatency = tm.latencies.set.snapshot()
+		s.GetLatency = tm.latencies.get.snapshot()
+		s.CleanupLatency = tm.latencies.cleanup.snapshot()
+	}
+	s.Forecast = tm.expiryForecast(time.Now())
+	if m, ok := tm.maintenance.Load().(MaintenanceStats); ok {
+		s.Maintenance = m
+	}
+	s.CleanupYields = atomic.LoadUint64(tm.cleanupYields)
+	s.DroppedCallbacks = atomic.LoadUint64(tm.droppedCallbacks)
+	return
+}
+
+// forecastResolution is the width of the buckets
+// the pairs of the map are counted in for the
+// expiry forecast.
+const forecastResolution = 100 * time.Millisecond
+
+// forecastBucket returns the forecast bucket of
+// the point of time t.
+func forecastBucket(t time.Time) int64 {
+	perSec := int64(time.Second / forecastResolution)
+	return t.Unix()*perSec + int64(t.Nanosecond())/int64(forecastResolution)
+}
+
+// bucketStart returns the point of time the
+// forecast bucket b starts at.
+func bucketStart(b int64) time.Time {
+	perSec := int64(time.Second / forecastResolution)
+	return time.Unix(b/perSec, b%perSec*int64(forecastResolution))
+}
+
+// trackExpiry moves the element v into the forecast
+// bucket of its current expiration time.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) trackExpiry(v *element) {
+	b := forecastBucket(v.effectiveExpires())
+	if v.tracked {
+		if v.bucket == b {
+			return
+		}
+		tm.untrackExpiry(v)
+	}
+
+	if tm.expiryBuckets == nil {
+		tm.expiryBuckets = make(map[int64]map[*element]struct{})
+	}
+	set, ok := tm.expiryBuckets[b]
+	if !ok {
+		set = make(map[*element]struct{})
+		tm.expiryBuckets[b] = set
+	}
+	set[v] = struct{}{}
+	v.bucket, v.tracked = b, true
+}
+
+// untrackExpiry removes the element v from its
+// forecast bucket.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) untrackExpiry(v *element) {
+	if !v.tracked {
+		return
+	}
+	set := tm.expiryBuckets[v.bucket]
+	delete(set, v)
+	if len(set) == 0 {
+		delete(tm.expiryBuckets, v.bucket)
+	}
+	v.tracked = false
+}
+
+// expiryForecast counts the key-value pairs of the map
+// which have not expired at now by their remaining
+// lifetime. Buckets which lie completely within one
+// forecast window are counted as a whole, only the
+// pairs of the buckets at the window boundaries are
+// checked one by one.
+func (tm *TimedMap) expiryForecast(now time.Time) (f ExpiryForecast) {
+	f.At = now
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	first := forecastBucket(now)
+	last := forecastBucket(now.Add(time.Minute))
+	for b := first; b <= last; b++ {
+		set := tm.expiryBuckets[b]
+		if len(set) == 0 {
+			continue
+		}
+
+		lo := bucketStart(b).Sub(now)
+		hi := lo + forecastResolution - 1
+		if lo > 0 && forecastSpan(lo) == forecastSpan(hi) {
+			f.add(lo, len(set))
+			continue
+		}
+
+		for v := range set {
+			if !v.expired(now) {
+				f.add(v.effectiveExpires().Sub(now), 1)
+			}
+		}
+	}
+	return
+}
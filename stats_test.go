@@ -0,0 +1,110 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	for _, v := range []uint64{0, 1, 7, 8, 9, 15, 16, 100, 1000, 123456789, 1<<63 - 1} {
+		i := histIndex(v)
+		assert.LessOrEqual(t, v, uint64(histUpperBound(i)), v)
+		if i > 0 {
+			assert.Greater(t, v, uint64(histUpperBound(i-1)), v)
+		}
+	}
+
+	var h histogram
+	assert.EqualValues(t, 0, h.snapshot().Percentile(50))
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		h.since(now)
+	}
+
+	s := h.snapshot()
+	assert.EqualValues(t, 100, s.Count())
+	assert.Greater(t, int64(s.Percentile(99)), int64(0))
+	assert.LessOrEqual(t, s.Percentile(50), s.Percentile(99))
+}
+
+func TestStats(t *testing.T) {
+	tm := New(0)
+	tm.Set(1, 1, time.Hour)
+	assert.EqualValues(t, 0, tm.Stats().SetLatency.Count())
+
+	tm = NewWithOptions(0, WithLatencyTracking())
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 1, time.Hour)
+	tm.GetValue(1)
+	tm.cleanUp()
+
+	s := tm.Stats()
+	assert.EqualValues(t, 2, s.SetLatency.Count())
+	assert.EqualValues(t, 1, s.GetLatency.Count())
+	assert.EqualValues(t, 1, s.CleanupLatency.Count())
+	assert.Greater(t, int64(s.SetLatency.Percentile(100)), int64(0))
+}
+
+func TestStatsForecast(t *testing.T) {
+	tm := New(0)
+	f := tm.Stats().Forecast
+	assert.False(t, f.At.IsZero())
+	assert.Zero(t, f.In60s)
+
+	tm.Set(1, 1, 500*time.Millisecond)
+	tm.Set(2, 2, 5*time.Second)
+	tm.Set(3, 3, 30*time.Second)
+	tm.Set(4, 4, time.Hour)
+	tm.Set(5, 5, 0)
+	time.Sleep(time.Millisecond)
+
+	f = tm.Stats().Forecast
+	assert.EqualValues(t, 1, f.In1s)
+	assert.EqualValues(t, 2, f.In10s)
+	assert.EqualValues(t, 3, f.In60s)
+
+	tm.Remove(3)
+	f = tm.Stats().Forecast
+	assert.EqualValues(t, 2, f.In60s)
+}
+
+func TestStatsForecastGrace(t *testing.T) {
+	tm := NewWithOptions(0, WithGracePeriod(time.Hour))
+
+	tm.Set(1, 1, 500*time.Millisecond)
+	tm.Set(2, 2, 0)
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, 2, tm.Size())
+
+	f := tm.Stats().Forecast
+	assert.EqualValues(t, 1, f.In1s)
+	assert.EqualValues(t, 1, f.In60s)
+}
+
+func TestStatsForecastIncremental(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.Set(i, i, 5*time.Second)
+	}
+	f := tm.Stats().Forecast
+	assert.EqualValues(t, 0, f.In1s)
+	assert.EqualValues(t, 10, f.In10s)
+
+	assert.Nil(t, tm.SetExpires(0, 500*time.Millisecond))
+	assert.Nil(t, tm.Refresh(1, time.Minute))
+	f = tm.Stats().Forecast
+	assert.EqualValues(t, 1, f.In1s)
+	assert.EqualValues(t, 9, f.In10s)
+	assert.EqualValues(t, 9, f.In60s)
+
+	for i := 0; i < 10; i++ {
+		tm.Remove(i)
+	}
+	assert.Zero(t, tm.Stats().Forecast.In60s)
+	assert.Empty(t, tm.expiryBuckets)
+}
@@ -0,0 +1,158 @@
+package timedmap
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// streamBatchSize is the maximum number of entries
+// collected by StreamSnapshot per lock acquisition.
+const streamBatchSize = 64
+
+// Entry contains a key-value pair of a map
+// together with its metadata.
+type Entry struct {
+	Key     interface{}
+	Value   interface{}
+	Expires time.Time
+	// Created is the time the key has
+	// been set without existing before.
+	Created time.Time
+	// Section is the identifier of the
+	// section containing the pair.
+	Section int
+	// Caller identifies the caller which has
+	// set the value, when the map was created
+	// using WithProvenance.
+	Caller string
+}
+
+// StreamSnapshot returns a channel yielding all key-value
+// pairs of the map which have not expired. The pairs are
+// collected in small batches, so that the lock of the map
+// is only held shortly at a time. The channel is closed
+// after all pairs have been yielded or when ctx is done.
+//
+// Unlike Snapshot, the stream does not represent a single
+// point in time. Pairs existing during the whole stream
+// are yielded at least once, whereby pairs may be yielded
+// multiple times when other pairs are removed meanwhile.
+// Pairs set after the stream has been started may not be
+// yielded.
+//
+// ctx must be cancelled if the channel is not read until
+// it is closed.
+func (tm *TimedMap) StreamSnapshot(ctx context.Context) <-chan Entry {
+	return tm.streamSnapshot(ctx, tm.owns)
+}
+
+// SnapshotPage returns a page of at most limit key-value
+// pairs of the map which have not expired, together with
+// the cursor of the next page. Pass 0 as cursor to get the
+// first page; nextCursor is 0 after the last page. A limit
+// of 0 or less returns all remaining pairs.
+//
+// This allows exporting large maps incrementally without
+// allocating a snapshot of the whole map at once. Like for
+// StreamSnapshot, pairs existing during the whole export
+// are returned at least once, whereby pairs may be returned
+// multiple times when other pairs are removed meanwhile.
+// Pairs set after the first page has been requested may
+// not be returned.
+func (tm *TimedMap) SnapshotPage(cursor, limit int) (page map[interface{}]interface{}, nextCursor int) {
+	return tm.snapshotPage(tm.owns, cursor, limit)
+}
+
+// snapshotPage collects at most limit non-expired elements
+// matched by owns, traversing the keys index backwards
+// from cursor like streamSnapshot. A cursor of 0 starts at
+// the end of the index.
+func (tm *TimedMap) snapshotPage(owns ownsFunc, cursor, limit int) (page map[interface{}]interface{}, nextCursor int) {
+	page = make(map[interface{}]interface{})
+
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	if cursor <= 0 || cursor > len(tm.keys) {
+		cursor = len(tm.keys)
+	}
+	for ; cursor > 0 && (limit <= 0 || len(page) < limit); cursor-- {
+		k := tm.keys[cursor-1]
+		key, ok := owns(k)
+		if !ok {
+			continue
+		}
+		if v := tm.container[k]; !v.expired(now) {
+			page[key] = v.valueAt(now)
+		}
+	}
+
+	return page, cursor
+}
+
+// streamSnapshot yields all non-expired elements
+// matched by owns on the returned channel.
+//
+// The keys index is traversed from its end, so that
+// elements moved by a removal during the traversal are
+// only moved to positions which have not been visited
+// yet.
+func (tm *TimedMap) streamSnapshot(ctx context.Context, owns ownsFunc) <-chan Entry {
+	c := make(chan Entry)
+
+	if tm.checkClosed() != nil {
+		close(c)
+		return c
+	}
+
+	tm.mtx.RLock()
+	cursor := len(tm.keys)
+	tm.mtx.RUnlock()
+
+	atomic.AddInt32(tm.goroutines, 1)
+	go func() {
+		defer atomic.AddInt32(tm.goroutines, -1)
+		defer close(c)
+
+		batch := make([]Entry, 0, streamBatchSize)
+		for cursor > 0 {
+			batch = batch[:0]
+			now := time.Now()
+
+			tm.mtx.RLock()
+			if cursor > len(tm.keys) {
+				cursor = len(tm.keys)
+			}
+			for ; cursor > 0 && len(batch) < streamBatchSize; cursor-- {
+				k := tm.keys[cursor-1]
+				key, ok := owns(k)
+				if !ok {
+					continue
+				}
+				v := tm.container[k]
+				if v.expired(now) {
+					continue
+				}
+				batch = append(batch, v.entry(key, k.sec, now))
+			}
+			tm.mtx.RUnlock()
+
+			for _, e := range batch {
+				select {
+				case c <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return c
+}
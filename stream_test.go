@@ -0,0 +1,122 @@
+package timedmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSnapshot(t *testing.T) {
+	tm := New(0)
+
+	const n = 3*streamBatchSize + 5
+	for i := 0; i < n; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Set(n, n, 0)
+	tm.Section(1).Set(0, -1, time.Hour)
+	time.Sleep(time.Millisecond)
+
+	m := map[interface{}]interface{}{}
+	for e := range tm.StreamSnapshot(context.Background()) {
+		m[e.Key] = e.Value
+		assert.False(t, e.Expires.IsZero())
+	}
+	assert.Len(t, m, n)
+	assert.NotContains(t, m, n)
+
+	var count int
+	for e := range tm.Section(1).StreamSnapshot(context.Background()) {
+		assert.EqualValues(t, -1, e.Value)
+		count++
+	}
+	assert.EqualValues(t, 1, count)
+}
+
+func TestStreamSnapshotRemove(t *testing.T) {
+	tm := New(0)
+
+	const n = 4 * streamBatchSize
+	for i := 0; i < n; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+
+	seen := map[interface{}]bool{}
+	for e := range tm.StreamSnapshot(context.Background()) {
+		seen[e.Key] = true
+		if len(seen) == streamBatchSize {
+			for i := 0; i < n; i += 2 {
+				tm.Remove(i)
+			}
+		}
+	}
+
+	for i := 1; i < n; i += 2 {
+		assert.True(t, seen[i], i)
+	}
+}
+
+func TestSnapshotPage(t *testing.T) {
+	tm := New(0)
+
+	const n = 25
+	for i := 0; i < n; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Set(n, n, 0)
+	tm.Section(1).Set(0, -1, time.Hour)
+	time.Sleep(time.Millisecond)
+
+	m := map[interface{}]interface{}{}
+	pages := 0
+	for cursor := 0; ; {
+		page, next := tm.SnapshotPage(cursor, 10)
+		assert.LessOrEqual(t, len(page), 10)
+		for k, v := range page {
+			m[k] = v
+		}
+		pages++
+		if next == 0 {
+			break
+		}
+		cursor = next
+		if pages == 1 {
+			tm.Remove(0)
+			tm.Remove(1)
+		}
+	}
+	assert.Equal(t, 3, pages)
+	for i := 2; i < n; i++ {
+		assert.Equal(t, i, m[i], i)
+	}
+	assert.NotContains(t, m, n)
+
+	page, next := tm.SnapshotPage(0, 0)
+	assert.Len(t, page, n-2)
+	assert.Zero(t, next)
+
+	page, next = tm.Section(1).SnapshotPage(0, 10)
+	assert.Equal(t, map[interface{}]interface{}{0: -1}, page)
+	assert.Zero(t, next)
+}
+
+func TestStreamSnapshotCancel(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 2*streamBatchSize; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := tm.StreamSnapshot(ctx)
+	<-c
+	cancel()
+
+	var count int
+	for range c {
+		count++
+	}
+	assert.Less(t, count, 2*streamBatchSize-1)
+}
@@ -0,0 +1,95 @@
+package timedmap
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StrictCallbackThreshold is the duration after which
+	// a callback is reported as blocking in strict mode.
+	StrictCallbackThreshold = 100 * time.Millisecond
+	// StrictSnapshotInterval is the minimum interval
+	// between two snapshots which is not reported as
+	// excessive snapshot frequency in strict mode.
+	StrictSnapshotInterval = 10 * time.Millisecond
+)
+
+// MisuseKind identifies a misuse pattern detected by
+// the strict mode of a TimedMap.
+type MisuseKind int
+
+const (
+	// MisuseClosed is reported when an operation is
+	// performed on a map which has been closed.
+	MisuseClosed MisuseKind = iota
+	// MisuseSlowCallback is reported when a callback
+	// blocked longer than StrictCallbackThreshold.
+	MisuseSlowCallback
+	// MisuseSnapshotFrequency is reported when two
+	// snapshots are taken within less than
+	// StrictSnapshotInterval.
+	MisuseSnapshotFrequency
+	// MisuseCleanerRestart is reported when the cleanup
+	// loop is started while it is already running.
+	MisuseCleanerRestart
+)
+
+// Misuse describes a misuse pattern detected by the
+// strict mode of a TimedMap.
+type Misuse struct {
+	Kind    MisuseKind
+	Message string
+}
+
+// strictChecks contains the state of the
+// strict mode of a map.
+type strictChecks struct {
+	report       func(m Misuse)
+	lastSnapshot int64
+}
+
+// misuse reports a misuse of the given kind when
+// strict mode is enabled.
+func (tm *TimedMap) misuse(kind MisuseKind, format string, args ...interface{}) {
+	if tm.strict == nil {
+		return
+	}
+	m := Misuse{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if tm.strict.report != nil {
+		tm.strict.report(m)
+	} else {
+		log.Printf("timedmap: %s", m.Message)
+	}
+}
+
+// runCallback executes cb with val and reports it
+// when it blocked for too long in strict mode.
+func (tm *TimedMap) runCallback(cb callback, val interface{}) {
+	if tm.strict == nil {
+		cb(val)
+		return
+	}
+	start := time.Now()
+	cb(val)
+	if d := time.Since(start); d > StrictCallbackThreshold {
+		tm.misuse(MisuseSlowCallback, "callback blocked for %s", d)
+	}
+}
+
+// checkSnapshot reports two snapshots taken within
+// less than StrictSnapshotInterval in strict mode.
+func (tm *TimedMap) checkSnapshot(now time.Time) {
+	if tm.strict == nil {
+		return
+	}
+	last := atomic.SwapInt64(&tm.strict.lastSnapshot, now.UnixNano())
+	if d := time.Duration(now.UnixNano() - last); last != 0 && d < StrictSnapshotInterval {
+		tm.misuse(MisuseSnapshotFrequency, "snapshots taken %s apart", d)
+	}
+}
@@ -0,0 +1,77 @@
+package timedmap
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type misuseRecorder struct {
+	mtx   sync.Mutex
+	kinds []MisuseKind
+}
+
+func (r *misuseRecorder) report(m Misuse) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.kinds = append(r.kinds, m.Kind)
+}
+
+func (r *misuseRecorder) get() []MisuseKind {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]MisuseKind(nil), r.kinds...)
+}
+
+func TestStrictChecks(t *testing.T) {
+	r := new(misuseRecorder)
+	tm := NewWithOptions(0, WithMisuseHandler(r.report))
+
+	tm.Snapshot()
+	tm.Section(1).Snapshot()
+	assert.Equal(t, []MisuseKind{MisuseSnapshotFrequency}, r.get())
+
+	tm.StartCleanerInternal(time.Hour)
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Tickers == 1
+	}, time.Second, time.Millisecond)
+	tm.StartCleanerInternal(time.Hour)
+	assert.Equal(t, []MisuseKind{MisuseSnapshotFrequency, MisuseCleanerRestart}, r.get())
+
+	tm.Set(1, 1, 0, func(interface{}) {
+		time.Sleep(StrictCallbackThreshold + 10*time.Millisecond)
+	})
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, MisuseSlowCallback, r.get()[2])
+
+	tm.Close()
+	tm.Set(2, 2, time.Hour)
+	assert.Equal(t, MisuseClosed, r.get()[3])
+}
+
+func TestStrictChecksLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tm := NewWithOptions(0, WithStrictChecks())
+	tm.Close()
+	tm.Set(1, 1, time.Hour)
+
+	assert.Contains(t, buf.String(), "timedmap: operation on closed map")
+}
+
+func TestNoStrictChecks(t *testing.T) {
+	tm := New(0)
+	tm.Snapshot()
+	tm.Snapshot()
+	tm.Close()
+	tm.Set(1, 1, time.Hour)
+	assert.Nil(t, tm.strict)
+}
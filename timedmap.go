@@ -1,7 +1,13 @@
 package timedmap
 
 import (
+	"container/heap"
+	"context"
+	"math"
+	"math/rand"
 	"reflect"
+	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,18 +15,156 @@ import (
 
 type callback func(value interface{})
 
+// UpdateFunc receives the current value of a key-value
+// pair and whether it exists and returns the new value
+// and its expiration duration.
+type UpdateFunc func(old interface{}, exists bool) (val interface{}, expiresAfter time.Duration)
+
+// KeepTTL can be passed as expiration duration when
+// setting a value to keep the expiration time of the
+// existing key-value pair, like Redis' KEEPTTL.
+//
+// If the key does not exist or has expired, the value
+// is not set at all. SetReported can be used to check
+// if the value has been set.
+const KeepTTL = time.Duration(math.MinInt64)
+
+// NoExpiration can be passed as expiration duration when
+// setting a value or the expiration of a key-value pair to
+// store a pair which never expires, so it is never removed
+// by the cleanup loop. Refreshing such a pair keeps it
+// permanent and TTL returns NoExpiration for it.
+const NoExpiration = time.Duration(math.MaxInt64)
+
+// neverExpires is the expiration time of key-value pairs
+// set with NoExpiration. It is the latest point of time
+// which can be encoded in snapshots.
+var neverExpires = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// DefaultTTL can be passed as expiration duration when
+// setting a value to use the expiration duration defined
+// by the TTL rules of the map for the key. If the map has
+// no TTL rules or they return DefaultTTL, the default TTL
+// set using WithDefaultTTL is used. Without default TTL,
+// the value expires immediately.
+const DefaultTTL = time.Duration(math.MinInt64 + 1)
+
+// KV contains a key-value pair to be set using SetAll
+// together with its expiration duration and an optional
+// callback executed when the pair expires.
+type KV struct {
+	Key          interface{}
+	Value        interface{}
+	ExpiresAfter time.Duration
+	Callback     callback
+}
+
+// ownsFunc returns true if the given container key
+// belongs to a section. Also, the key as seen from
+// the section is returned.
+type ownsFunc func(k keyWrap) (interface{}, bool)
+
 // TimedMap contains a map with all key-value pairs,
 // and a timer, which cleans the map in the set
 // tick durations from expired keys.
+//
+// Additionally, all keys of the container are indexed
+// in the keys slice, which allows random access to the
+// entries of the container.
 type TimedMap struct {
-	mtx         sync.RWMutex
-	container   map[keyWrap]*element
-	elementPool *sync.Pool
+	mtx          sync.RWMutex
+	container    map[keyWrap]*element
+	keys         []keyWrap
+	elementPool  *sync.Pool
+	snapshotPool *sync.Pool
 
 	cleanupTickTime time.Duration
+	cleanerMtx      sync.Mutex
+	cleanerSource   <-chan time.Time
 	cleanerTicker   *time.Ticker
 	cleanerStopChan chan bool
 	cleanerRunning  *uint32
+	cleanupYield    int
+	cleanupYields   *uint64
+	closed          *uint32
+	goroutines      *int32
+	timers          int
+	peak            int
+
+	maintenanceInterval time.Duration
+	maintenanceBudget   int
+	maintenanceStop     chan struct{}
+	maintenanceCredit   int
+	maintenance         atomic.Value
+
+	scrubInterval time.Duration
+	scrubBudget   int
+	scrubHandler  func(d Drift)
+	scrubStop     chan struct{}
+	scrubCursor   int
+
+	asyncQueue       int
+	overflowPolicy   OverflowPolicy
+	expirations      chan expiration
+	droppedCallbacks *uint64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// done is closed when the map is closed to stop
+	// the goroutines of child maps.
+	done chan struct{}
+
+	refreshPolicy     RefreshPolicy
+	maxHold           time.Duration
+	maxCallbacks      int
+	normalizeKey      func(key interface{}) interface{}
+	latencies         *latencyTracker
+	closedPolicy      ClosedPolicy
+	entryTimers       bool
+	ordered           bool
+	orderedExpiry     bool
+	replaceOnRename   bool
+	valueEqual        func(a, b interface{}) bool
+	admit             AdmissionHook
+	ttlRules          func(key interface{}) time.Duration
+	ttlOverrides      *TTLOverrides
+	ttlJitter         float64
+	grace             time.Duration
+	pacer             *removalPacer
+	defaultExpiration time.Duration
+	onExpire          func(e Entry)
+	sizer             func(key, value interface{}) int
+	strict            *strictChecks
+	provenance        bool
+
+	// caller identifies the caller of the set operation
+	// in progress while the write lock is held.
+	caller string
+
+	// sliding enables the sliding expiration of all set
+	// values, slideNext only of the value set by the set
+	// operation in progress while the write lock is held.
+	sliding   bool
+	slideNext bool
+
+	maxLifetime time.Duration
+
+	negatives    map[keyWrap]*negative
+	negativeBase time.Duration
+	negativeMax  time.Duration
+
+	quota        int
+	sectionSizes map[int]int
+	valueTypes   map[int]reflect.Type
+
+	expiryBuckets map[int64]map[*element]struct{}
+
+	sectionMtx         sync.RWMutex
+	childNext          int
+	childFree          []int
+	sectionGens        map[int]uint64
+	staleSectionPolicy StaleSectionPolicy
 }
 
 type keyWrap struct {
@@ -32,10 +176,73 @@ type keyWrap struct {
 // the thime when the value expires and an array of
 // callbacks, which will be executed when the element
 // expires.
+//
+// Optionally, an element can hold a list of warning
+// callbacks which are executed once when the element
+// is less than warnBefore away from its expiration.
+//
+// idx is the position of the elements key in the
+// keys index of the map.
+//
+// While holds is larger than 0, the element does not
+// expire until heldUntil has passed.
+//
+// When decay is set, the value is passed through it
+// on read with the time elapsed since decayStart.
+//
+// When softExpires is set, the element is considered
+// stale after it has passed and the softCbs are
+// executed once by the cleanup loop.
+//
+// When entry timers are enabled, timer fires at the
+// next deadline of the element.
+//
+// addedCbs are the callbacks added using AddCallback,
+// which are kept when a new value is set for the key.
+//
+// When a sizer is configured, cost is the size of the
+// value as reported by the sizer when it was set.
+//
+// When provenance is enabled, caller identifies the
+// caller which has set the value.
+//
+// sliding is the idle timeout applied on each read of
+// the value, deadline the point of time the expiration
+// is capped to by the maximum lifetime, if set.
 type element struct {
-	value   interface{}
-	expires time.Time
-	cbs     []callback
+	value    interface{}
+	expires  time.Time
+	created  time.Time
+	cbs      []callback
+	addedCbs []callback
+
+	warnBefore time.Duration
+	warnCbs    []callback
+	warned     bool
+
+	idx int
+
+	holds     int
+	heldUntil time.Time
+
+	decay      DecayFunc
+	decayStart time.Time
+
+	softExpires time.Time
+	softCbs     []callback
+	softFired   bool
+
+	timer *time.Timer
+
+	cost     int
+	caller   string
+	sliding  time.Duration
+	deadline time.Time
+
+	bucket  int64
+	tracked bool
+
+	finalizer func(value interface{})
 }
 
 // New creates and returns a new instance of TimedMap.
@@ -55,7 +262,14 @@ type element struct {
 // can also be used to re-define the specification of
 // the cleanup loop when already running if you want to.
 func New(cleanupTickTime time.Duration, tickerChan ...<-chan time.Time) *TimedMap {
-	return newTimedMap(make(map[keyWrap]*element), cleanupTickTime, tickerChan)
+	return newTimedMap(make(map[keyWrap]*element), cleanupTickTime, tickerChan, nil)
+}
+
+// NewWithOptions creates and returns a new instance of
+// TimedMap like New and applies the given options to
+// it before the cleanup loop is started.
+func NewWithOptions(cleanupTickTime time.Duration, opts ...Option) *TimedMap {
+	return newTimedMap(make(map[keyWrap]*element), cleanupTickTime, nil, opts)
 }
 
 func FromMap(
@@ -63,31 +277,47 @@ func FromMap(
 	expiration time.Duration,
 	cleanupTickTime time.Duration,
 	tickerChan ...<-chan time.Time,
+) (*TimedMap, error) {
+	return FromMapFunc(m, func(_, _ interface{}) time.Duration {
+		return expiration
+	}, cleanupTickTime, tickerChan...)
+}
+
+// FromMapFunc creates a new instance of TimedMap like
+// FromMap containing all key-value pairs of the map m,
+// whereby the expiration duration of each pair is
+// returned by the function expiration.
+func FromMapFunc(
+	m interface{},
+	expiration func(key, value interface{}) time.Duration,
+	cleanupTickTime time.Duration,
+	tickerChan ...<-chan time.Time,
 ) (*TimedMap, error) {
 	mv := reflect.ValueOf(m)
 	if mv.Kind() != reflect.Map {
 		return nil, ErrValueNoMap
 	}
 
-	exp := time.Now().Add(expiration)
+	now := time.Now()
 	container := make(map[keyWrap]*element)
 
 	iter := mv.MapRange()
 	for iter.Next() {
-		key := iter.Key()
-		val := iter.Value()
+		key := iter.Key().Interface()
+		val := iter.Value().Interface()
 		kw := keyWrap{
 			sec: 0,
-			key: key.Interface(),
+			key: key,
 		}
 		el := &element{
-			value:   val.Interface(),
-			expires: exp,
+			value:   val,
+			expires: expiresAt(now, expiration(key, val)),
+			created: now,
 		}
 		container[kw] = el
 	}
 
-	return newTimedMap(container, cleanupTickTime, tickerChan), nil
+	return newTimedMap(container, cleanupTickTime, tickerChan, nil), nil
 }
 
 // Section returns a sectioned subset of
@@ -100,6 +330,70 @@ func (tm *TimedMap) Section(i int) Section {
 	return newSection(tm, i)
 }
 
+// DeleteSection removes all key-value pairs of the
+// section with the given identifier without executing
+// their callbacks.
+//
+// Section instances of the deleted section which have
+// been created before behave as defined by the maps
+// StaleSectionPolicy. Section instances created
+// afterwards access the new, empty section. The root
+// section 0 represented by the TimedMap itself is
+// flushed but never becomes stale.
+func (tm *TimedMap) DeleteSection(sec int) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.sectionMtx.Lock()
+	defer tm.sectionMtx.Unlock()
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.removeSection(sec)
+
+	if tm.sectionGens == nil {
+		tm.sectionGens = make(map[int]uint64)
+	}
+	tm.sectionGens[sec]++
+}
+
+// removeSection deletes all elements of the
+// given section.
+//
+// The caller must hold the write locks of the
+// map and of the section generations.
+func (tm *TimedMap) removeSection(sec int) {
+	for k, v := range tm.container {
+		if k.sec == sec {
+			tm.bulkDeleteElement(k, v)
+		}
+	}
+	tm.paceRemovals()
+	for k := range tm.negatives {
+		if k.sec == sec {
+			delete(tm.negatives, k)
+		}
+	}
+}
+
+// WithKeyPrefix returns a view of the map which
+// prefixes all passed string keys with the given
+// prefix. Snapshot, Size and Flush of the view only
+// cover string keys carrying the prefix, whereby
+// the keys in the Snapshot are stripped from it.
+//
+// Keys which are not of type string are kept apart
+// from the keys of the map and of views with other
+// prefixes, so they are only visible to views with
+// the same prefix.
+func (tm *TimedMap) WithKeyPrefix(prefix string) Section {
+	s := newSection(tm, 0)
+	s.prefix = prefix
+	return s
+}
+
 // Ident returns the current sections ident.
 // In the case of the root object TimedMap,
 // this is always 0.
@@ -111,31 +405,216 @@ func (tm *TimedMap) Ident() int {
 // a key. expiresAfter sets the expire time after the key-value pair
 // will automatically be removed from the map.
 func (tm *TimedMap) Set(key, value interface{}, expiresAfter time.Duration, cb ...callback) {
-	tm.set(key, 0, value, expiresAfter, cb...)
+	tm.set(tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// SetDefault appends a key-value pair to the map or sets
+// the value of a key like Set, using the default TTL of
+// the map as expiration duration.
+func (tm *TimedMap) SetDefault(key, value interface{}, cb ...callback) {
+	tm.set(tm.key(key), 0, value, DefaultTTL, cb...)
+}
+
+// SetBy sets a key-value pair like Set and records caller
+// as a short identifier of the caller which set the value.
+// The caller is only recorded when the map was created
+// using WithProvenance and is included in the Entry of
+// the pair, e.g. in SnapshotEntries or in the expire
+// handler.
+func (tm *TimedMap) SetBy(caller string, key, value interface{}, expiresAfter time.Duration, cb ...callback) {
+	tm.setBy(caller, tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// SetContext sets a key-value pair like SetBy with the
+// caller attached to ctx using WithCaller.
+func (tm *TimedMap) SetContext(ctx context.Context, key, value interface{}, expiresAfter time.Duration, cb ...callback) {
+	tm.setBy(CallerFromContext(ctx), tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// SetExpireAt appends a key-value pair to the map or sets the
+// value of a key like Set. The key-value pair expires at the
+// given point of time at. A zero at behaves like KeepTTL.
+func (tm *TimedMap) SetExpireAt(key, value interface{}, at time.Time, cb ...callback) {
+	tm.setAt(tm.key(key), 0, value, at, cb...)
+}
+
+// SetReported sets the key-value pair like Set and returns
+// the previous value of the key. replaced is true, if the
+// key was existent and not expired before.
+//
+// When the map has been created using WithValueEqual and
+// the previous value equals the new one, the previous
+// value is kept and replaced is false.
+func (tm *TimedMap) SetReported(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, replaced bool) {
+	return tm.set(tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// SetAll sets all passed key-value pairs with their own
+// expiration parameters under a single lock acquisition.
+func (tm *TimedMap) SetAll(entries []KV) {
+	tm.setAll(tm.key, 0, entries)
+}
+
+// Swap sets the key-value pair like Set and returns the
+// previous value of the key in a single atomic operation.
+// existed is true, if the key was existent and not expired
+// before.
+func (tm *TimedMap) Swap(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, existed bool) {
+	return tm.swap(tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// SetMulti sets all key-value pairs of the passed map
+// entries with the given expiration parameters under a
+// single lock acquisition. If entries is not a map,
+// ErrValueNoMap is returned.
+func (tm *TimedMap) SetMulti(entries interface{}, expiresAfter time.Duration, cb ...callback) error {
+	return tm.setMulti(tm.key, 0, entries, expiresAfter, cb...)
+}
+
+// GetOrSet returns the value of the key, if existent and
+// not expired, and loaded is set to true. Otherwise, the
+// passed value is set with the given expiration parameters
+// and returned. Both happens atomically. If the value could
+// not be stored, e.g. as the quota has been reached, nil
+// is returned.
+func (tm *TimedMap) GetOrSet(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (actual interface{}, loaded bool) {
+	actual, loaded, _ = tm.getOrSet(tm.key(key), 0, value, expiresAfter, cb...)
+	return
+}
+
+// SetIfNotExists sets the key-value pair only if the key
+// does not exist or has expired and returns true, if the
+// pair has been set. Both happens atomically, so that
+// only the first of concurrent callers wins. false is
+// returned as well if the pair could not be stored, e.g.
+// as the quota has been reached.
+func (tm *TimedMap) SetIfNotExists(
+	key, value interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) bool {
+	return tm.setIfNotExists(tm.key(key), 0, value, expiresAfter, cb...)
+}
+
+// Update executes fn with the current value of the key
+// and stores the returned value with the returned
+// expiration duration. Both happens under the write
+// lock of the map, which allows read-modify-write
+// operations without races. The callbacks of an
+// existing key-value pair are kept.
+//
+// If the map has been closed, ErrClosed is returned. If
+// the returned value could not be stored, ErrKeyNotFound
+// is returned when KeepTTL was returned for a missing key,
+// ErrQuotaExceeded when the quota has been reached and
+// ErrRejected when the admission hook rejected the value.
+//
+// fn must not access the map.
+func (tm *TimedMap) Update(key interface{}, fn UpdateFunc) error {
+	return tm.update(tm.key(key), 0, fn)
+}
+
+// Upsert sets the value of the key like Update. If the key
+// does not exist, the value and expiration duration are
+// returned by insert. Otherwise, they are returned by
+// update, which receives the current value. The callbacks
+// of an existing key-value pair are kept. Errors are
+// returned like by Update.
+//
+// insert and update must not access the map.
+func (tm *TimedMap) Upsert(
+	key interface{},
+	insert func() (val interface{}, expiresAfter time.Duration),
+	update func(old interface{}) (val interface{}, expiresAfter time.Duration),
+) error {
+	return tm.update(tm.key(key), 0, upsertFunc(insert, update))
+}
+
+// Increment adds delta to the numeric value of the key
+// atomically and returns the new value, which keeps the
+// type of the stored value. expiresAfter sets the new
+// expiration duration; pass KeepTTL to keep the current
+// one. If the key does not exist, delta is stored as
+// int64.
+//
+// If the stored value is not numeric, ErrValueNotNumeric
+// is returned. If KeepTTL is passed and the key does not
+// exist, ErrKeyNotFound is returned. If the new value
+// could not be stored, the error of setting it, e.g.
+// ErrQuotaExceeded, is returned.
+func (tm *TimedMap) Increment(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error) {
+	return tm.increment(tm.key(key), 0, delta, expiresAfter)
+}
+
+// Decrement subtracts delta from the numeric value of
+// the key atomically like Increment.
+func (tm *TimedMap) Decrement(key interface{}, delta int64, expiresAfter time.Duration) (interface{}, error) {
+	return tm.increment(tm.key(key), 0, -delta, expiresAfter)
 }
 
 // GetValue returns an interface of the value of a key in the
 // map. The returned value is nil if there is no value to the
 // passed key or if the value was expired.
 func (tm *TimedMap) GetValue(key interface{}) interface{} {
-	v := tm.get(key, 0)
-	if v == nil {
-		return nil
-	}
-	tm.mtx.RLock()
-	defer tm.mtx.RUnlock()
-	return v.value
+	val, _ := tm.tryGetValue(tm.key(key), 0)
+	return val
+}
+
+// TryGetValue returns the value of a key in the map like
+// GetValue. ok is false, if there is no value to the passed
+// key or if the value was expired. This allows to
+// distinguish missing keys from stored nil values.
+func (tm *TimedMap) TryGetValue(key interface{}) (val interface{}, ok bool) {
+	return tm.tryGetValue(tm.key(key), 0)
+}
+
+// GetValueE returns the value of a key in the map like
+// GetValue. If there is no value to the passed key or if
+// the value was expired, ErrKeyNotFound is returned.
+func (tm *TimedMap) GetValueE(key interface{}) (interface{}, error) {
+	return tm.getValueE(tm.key(key), 0)
+}
+
+// GetValueDefault returns the value of a key in the map
+// like GetValue. If there is no value to the passed key
+// or if the value was expired, def is returned.
+func (tm *TimedMap) GetValueDefault(key interface{}, def interface{}) interface{} {
+	return tm.getValueDefault(tm.key(key), 0, def)
+}
+
+// GetEntry returns the key-value pair of the given key
+// together with its metadata. If the key-value pair does
+// not exist in the map or was expired, this will return
+// an error object.
+func (tm *TimedMap) GetEntry(key interface{}) (Entry, error) {
+	k := tm.key(key)
+	return tm.getEntry(k, k, 0)
 }
 
 // GetExpires returns the expire time of a key-value pair.
 // If the key-value pair does not exist in the map or
 // was expired, this will return an error object.
 func (tm *TimedMap) GetExpires(key interface{}) (time.Time, error) {
-	v := tm.get(key, 0)
-	if v == nil {
-		return time.Time{}, ErrKeyNotFound
-	}
-	return v.expires, nil
+	return tm.getExpires(tm.key(key), 0)
+}
+
+// TTL returns the remaining lifetime of a key-value pair.
+// If the key-value pair does not exist in the map or
+// was expired, this will return an error object.
+func (tm *TimedMap) TTL(key interface{}) (time.Duration, error) {
+	return tm.ttl(tm.key(key), 0)
 }
 
 // SetExpire is deprecated.
@@ -147,56 +626,301 @@ func (tm *TimedMap) SetExpire(key interface{}, d time.Duration) error {
 // SetExpires sets the expire time for a key-value
 // pair to the passed duration. If there is no value
 // to the key passed , this will return an error.
+//
+// How key-value pairs, which have already expired but
+// were not yet removed by the cleanup loop, are handled
+// is defined by the RefreshPolicy of the map.
 func (tm *TimedMap) SetExpires(key interface{}, d time.Duration) error {
-	return tm.setExpires(key, 0, d)
+	_, err := tm.setExpires(tm.key(key), 0, d)
+	return err
+}
+
+// Touch resets the expire time for a key-value pair to
+// the default TTL of the map, as if it was set using
+// DefaultTTL as expiration duration. If there is no
+// value to the key passed, this will return an error.
+func (tm *TimedMap) Touch(key interface{}) error {
+	return tm.touch(tm.key(key), 0)
+}
+
+// SetExpiresPrev sets the expire time for a key-value pair
+// like SetExpires and returns its previous expiration time.
+func (tm *TimedMap) SetExpiresPrev(key interface{}, d time.Duration) (time.Time, error) {
+	return tm.setExpires(tm.key(key), 0, d)
+}
+
+// ExpiresAt sets the expire time for a key-value pair
+// to the passed point of time. If there is no value
+// to the key passed, this will return an error.
+//
+// Already expired key-value pairs are handled like
+// by SetExpires.
+func (tm *TimedMap) ExpiresAt(key interface{}, t time.Time) error {
+	_, err := tm.setExpiresAt(tm.key(key), 0, t)
+	return err
+}
+
+// AddCallback appends callbacks to the callbacks of a
+// key-value pair which are executed when it expires.
+// If there is no value to the key passed, this will
+// return an error.
+//
+// Unlike the callbacks passed to Set, added callbacks
+// are kept when a new value is set for the key and are
+// executed after them. They are dropped when the pair
+// is removed or expires.
+//
+// If the pair would hold more callbacks than allowed
+// by the maps maximum callback count, no callback is
+// added and ErrTooManyCallbacks is returned.
+func (tm *TimedMap) AddCallback(key interface{}, cb ...callback) error {
+	return tm.addCallback(tm.key(key), 0, cb...)
+}
+
+// CallbackCount returns the number of callbacks of a
+// key-value pair which are executed when it expires.
+// If there is no value to the key passed, this will
+// return an error.
+func (tm *TimedMap) CallbackCount(key interface{}) (int, error) {
+	return tm.callbackCount(tm.key(key), 0)
+}
+
+// ClearCallbacks removes all callbacks of a key-value
+// pair which would be executed when it expires, including
+// the ones added using AddCallback. If there is no value
+// to the key passed, this will return an error.
+func (tm *TimedMap) ClearCallbacks(key interface{}) error {
+	return tm.clearCallbacks(tm.key(key), 0)
+}
+
+// SetWarning registers callbacks for a key-value pair
+// which are executed once by the cleanup loop as soon
+// as the pair is less than before away from its
+// expiration. Refreshing the expiration re-arms the
+// warning. Setting a new value for the key removes
+// all registered warnings. If there is no value to
+// the key passed, this will return an error.
+func (tm *TimedMap) SetWarning(key interface{}, before time.Duration, cb ...callback) error {
+	return tm.setWarning(tm.key(key), 0, before, cb...)
+}
+
+// Hold suspends the expiration of a key-value pair
+// until the returned release function is called or
+// the maximum hold duration of the map has passed.
+// If the pair has expired while being held, it will
+// expire after being released. If there is no value
+// to the key passed, this will return an error.
+//
+// The returned release function can be called
+// multiple times safely.
+func (tm *TimedMap) Hold(key interface{}) (release func(), err error) {
+	return tm.hold(tm.key(key), 0)
+}
+
+// SetDecay registers a DecayFunc for a key-value pair.
+// From now on, the value returned for the pair is the
+// stored value passed through fn with the time elapsed
+// since this call. As soon as fn reports the value as
+// not alive anymore, the pair expires. Setting a new
+// value for the key removes the decay. If there is no
+// value to the key passed, this will return an error.
+func (tm *TimedMap) SetDecay(key interface{}, fn DecayFunc) error {
+	return tm.setDecay(tm.key(key), 0, fn)
+}
+
+// SetSoftExpires sets a soft expiration time for a
+// key-value pair to the passed duration, which is
+// independent from its actual expiration time. After
+// the soft expiration time has passed, the pair is
+// considered stale and the passed callbacks are
+// executed once by the cleanup loop, e.g. to trigger
+// a refresh of the value. Setting a new value for the
+// key removes the soft expiration. If there is no
+// value to the key passed, this will return an error.
+func (tm *TimedMap) SetSoftExpires(key interface{}, d time.Duration, cb ...callback) error {
+	return tm.setSoftExpires(tm.key(key), 0, d, cb...)
+}
+
+// IsStale returns true, if the soft expiration time of
+// the key-value pair has passed. If there is no value
+// to the key passed or if the value was expired, this
+// will return an error.
+func (tm *TimedMap) IsStale(key interface{}) (bool, error) {
+	return tm.isStale(tm.key(key), 0)
 }
 
 // Contains returns true, if the key exists in the map.
 // false will be returned, if there is no value to the
 // key or if the key-value pair was expired.
 func (tm *TimedMap) Contains(key interface{}) bool {
-	return tm.get(key, 0) != nil
+	return tm.contains(tm.key(key), 0)
 }
 
 // Remove deletes a key-value pair in the map.
 func (tm *TimedMap) Remove(key interface{}) {
-	tm.remove(key, 0)
+	tm.remove(tm.key(key), 0)
+}
+
+// Expire expires a key-value pair in the map immediately
+// and executes its callbacks, regardless of it being held.
+// If there is no value to the key passed, this will return
+// an error.
+func (tm *TimedMap) Expire(key interface{}) error {
+	return tm.expire(tm.key(key), 0)
+}
+
+// Rename moves the key-value pair of oldKey together with
+// its expiration time and callbacks to newKey atomically.
+// If there is no value to oldKey, ErrKeyNotFound is returned.
+// If newKey already exists, ErrKeyExists is returned, unless
+// the map was created using WithReplaceOnRename.
+//
+// Holds of the key-value pair are released on rename.
+func (tm *TimedMap) Rename(oldKey, newKey interface{}) error {
+	return tm.rename(tm.key(oldKey), tm.key(newKey), 0)
+}
+
+// RemoveMulti deletes all key-value pairs of the passed
+// keys in the map under a single lock acquisition and
+// returns the number of removed pairs.
+func (tm *TimedMap) RemoveMulti(keys ...interface{}) int {
+	return tm.removeMulti(tm.key, 0, keys)
+}
+
+// RemoveWhere deletes all key-value pairs in the map
+// which have not expired and for which fn returns true
+// under a single lock acquisition and returns the number
+// of removed pairs.
+//
+// The write lock of the map is held while fn is called,
+// so fn must not access the map.
+func (tm *TimedMap) RemoveWhere(fn func(key, value interface{}) bool) int {
+	return tm.removeWhere(tm.owns, fn)
+}
+
+// Pop removes a key-value pair from the map and returns
+// its value. ok is false, if there is no value to the
+// key or if the key-value pair was expired. No expiry
+// callbacks are executed for the removed pair.
+func (tm *TimedMap) Pop(key interface{}) (val interface{}, ok bool) {
+	return tm.pop(tm.key(key), 0)
 }
 
 // Refresh extends the expire time for a key-value pair
 // about the passed duration. If there is no value to
 // the key passed, this will return an error object.
+//
+// How key-value pairs, which have already expired but
+// were not yet removed by the cleanup loop, are handled
+// is defined by the RefreshPolicy of the map.
 func (tm *TimedMap) Refresh(key interface{}, d time.Duration) error {
-	return tm.refresh(key, 0, d)
+	_, err := tm.refresh(tm.key(key), 0, d)
+	return err
+}
+
+// RefreshPrev extends the expire time for a key-value pair
+// like Refresh and returns its previous expiration time.
+func (tm *TimedMap) RefreshPrev(key interface{}, d time.Duration) (time.Time, error) {
+	return tm.refresh(tm.key(key), 0, d)
+}
+
+// GetAndRefresh returns the value of the given key and
+// extends its expire time about the passed duration in
+// a single operation. If there is no value to the key
+// passed, ErrKeyNotFound is returned.
+func (tm *TimedMap) GetAndRefresh(key interface{}, d time.Duration) (interface{}, error) {
+	return tm.getAndRefresh(tm.key(key), 0, d)
 }
 
 // Flush deletes all key-value pairs of the map.
 func (tm *TimedMap) Flush() {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.flush()
+}
+
+// flush deletes all elements of the map.
+func (tm *TimedMap) flush() {
 	tm.mtx.Lock()
 	defer tm.mtx.Unlock()
 
 	for k, v := range tm.container {
-		tm.elementPool.Put(v)
-		delete(tm.container, k)
+		tm.bulkDeleteElement(k, v)
 	}
+	tm.paceRemovals()
+	tm.negatives = nil
 }
 
 // Size returns the current number of key-value pairs
 // existent in the map.
 func (tm *TimedMap) Size() int {
+	if tm.checkClosed() != nil {
+		return 0
+	}
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
 	return len(tm.container)
 }
 
+// SizeLive returns the current number of key-value
+// pairs existent in the map which have not expired.
+// Unlike Size, pairs which have expired but were not
+// yet removed by the cleanup loop are not counted.
+func (tm *TimedMap) SizeLive() int {
+	return tm.sizeLive(ownsAll)
+}
+
+// sizeLive returns the number of non-expired
+// elements matched by owns.
+func (tm *TimedMap) sizeLive(owns ownsFunc) (i int) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	for k, v := range tm.container {
+		if _, ok := owns(k); ok && !v.expired(now) {
+			i++
+		}
+	}
+	return
+}
+
 // StartCleanerInternal starts the cleanup loop controlled
 // by an internal ticker with the given interval.
 //
 // If the cleanup loop is already running, it will be
 // stopped and restarted using the new specification.
 func (tm *TimedMap) StartCleanerInternal(interval time.Duration) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
 	if atomic.LoadUint32(tm.cleanerRunning) != 0 {
-		tm.StopCleaner()
+		tm.misuse(MisuseCleanerRestart, "cleanup loop started while running")
 	}
+
+	tm.cleanerMtx.Lock()
+	defer tm.cleanerMtx.Unlock()
+
+	tm.stopCleanerLocked()
+
+	tm.mtx.Lock()
+	tm.cleanupTickTime = interval
+	tm.mtx.Unlock()
+
 	tm.cleanerTicker = time.NewTicker(interval)
+	tm.cleanerSource = tm.cleanerTicker.C
+	atomic.StoreUint32(tm.cleanerRunning, 1)
+	atomic.AddInt32(tm.goroutines, 1)
 	go tm.cleanupLoop(tm.cleanerTicker.C)
 }
 
@@ -208,9 +932,26 @@ func (tm *TimedMap) StartCleanerInternal(interval time.Duration) {
 // If the cleanup loop is already running, it will be
 // stopped and restarted using the new specification.
 func (tm *TimedMap) StartCleanerExternal(initiator <-chan time.Time) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
 	if atomic.LoadUint32(tm.cleanerRunning) != 0 {
-		tm.StopCleaner()
+		tm.misuse(MisuseCleanerRestart, "cleanup loop started while running")
 	}
+
+	tm.cleanerMtx.Lock()
+	defer tm.cleanerMtx.Unlock()
+
+	tm.stopCleanerLocked()
+
+	tm.mtx.Lock()
+	tm.cleanupTickTime = 0
+	tm.mtx.Unlock()
+
+	tm.cleanerSource = initiator
+	atomic.StoreUint32(tm.cleanerRunning, 1)
+	atomic.AddInt32(tm.goroutines, 1)
 	go tm.cleanupLoop(initiator)
 }
 
@@ -219,218 +960,2427 @@ func (tm *TimedMap) StartCleanerExternal(initiator <-chan time.Time) {
 // where TimedMap is used that the data can be cleaned
 // up correctly.
 func (tm *TimedMap) StopCleaner() {
-	if atomic.LoadUint32(tm.cleanerRunning) == 0 {
+	tm.cleanerMtx.Lock()
+	defer tm.cleanerMtx.Unlock()
+
+	tm.stopCleanerLocked()
+}
+
+// stopCleanerSource stops the cleanup loop only if it
+// is currently controlled by the initiator channel src.
+func (tm *TimedMap) stopCleanerSource(src <-chan time.Time) {
+	tm.cleanerMtx.Lock()
+	defer tm.cleanerMtx.Unlock()
+
+	if tm.cleanerSource == src {
+		tm.stopCleanerLocked()
+	}
+}
+
+// stopCleanerLocked stops the cleanup loop, if running.
+//
+// The caller must hold the cleaner lock of the map.
+func (tm *TimedMap) stopCleanerLocked() {
+	if !atomic.CompareAndSwapUint32(tm.cleanerRunning, 1, 0) {
 		return
 	}
 	tm.cleanerStopChan <- true
 	if tm.cleanerTicker != nil {
 		tm.cleanerTicker.Stop()
 	}
+	tm.cleanerSource = nil
 }
 
-// Snapshot returns a new map which represents the
-// current key-value state of the internal container.
-func (tm *TimedMap) Snapshot() map[interface{}]interface{} {
-	return tm.getSnapshot(0)
+// View returns a read-only view of the map which
+// passes all values through transform on read. The
+// view does not copy the key-value pairs of the map.
+func (tm *TimedMap) View(transform TransformFunc) ReadOnlyMap {
+	return newView(tm, transform)
 }
 
-// cleanupLoop holds the loop executing the cleanup
-// when initiated by tc.
-func (tm *TimedMap) cleanupLoop(tc <-chan time.Time) {
-	atomic.StoreUint32(tm.cleanerRunning, 1)
-	defer func() {
-		atomic.StoreUint32(tm.cleanerRunning, 0)
-	}()
+// Values returns the values of all key-value
+// pairs in the map which have not expired.
+func (tm *TimedMap) Values() []interface{} {
+	return tm.values(tm.owns)
+}
 
-	for {
-		select {
-		case <-tc:
-			tm.cleanUp()
-		case <-tm.cleanerStopChan:
-			return
-		}
+// Range calls fn sequentially for each key-value pair
+// in the map which has not expired. If fn returns false,
+// the iteration is stopped.
+//
+// The read lock of the map is held during the iteration,
+// so fn must not write to the map.
+func (tm *TimedMap) Range(fn func(key, value interface{}) bool) {
+	tm.rangeElements(tm.owns, fn)
+}
+
+// SetReady marks the map as ready, e.g. after an
+// initial bulk population has been completed, which
+// releases all callers blocked in WaitReady.
+// Calling SetReady multiple times has no further
+// effect.
+func (tm *TimedMap) SetReady() {
+	tm.readyOnce.Do(func() {
+		close(tm.ready)
+	})
+}
+
+// IsReady returns true, if SetReady has been
+// called on the map.
+func (tm *TimedMap) IsReady() bool {
+	select {
+	case <-tm.ready:
+		return true
+	default:
+		return false
 	}
 }
 
-// expireElement removes the specified key-value element
-// from the map and executes all defined callback functions
-func (tm *TimedMap) expireElement(key interface{}, sec int, v *element) {
+// WaitReady blocks until SetReady has been called on
+// the map or ctx is done. In the latter case, the error
+// of the context is returned. Passing an already
+// cancelled context allows to fail fast when the map
+// is not ready yet.
+func (tm *TimedMap) WaitReady(ctx context.Context) error {
+	if tm.IsReady() {
+		return nil
+	}
+	select {
+	case <-tm.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SampleKeys returns a uniform random sample of at most n
+// keys of non-expired key-value pairs in the map without
+// iterating the whole container.
+func (tm *TimedMap) SampleKeys(n int) []interface{} {
+	return tm.sampleKeys(tm.owns, n)
+}
+
+// Close stops the cleanup loop and flushes
+// the map. Calling Close multiple times has
+// no further effect.
+//
+// How operations on the map and its sections
+// behave after Close is defined by the
+// ClosedPolicy of the map.
+func (tm *TimedMap) Close() {
+	if !atomic.CompareAndSwapUint32(tm.closed, 0, 1) {
+		return
+	}
+	tm.StopCleaner()
+	close(tm.done)
+	if tm.maintenanceStop != nil {
+		close(tm.maintenanceStop)
+	}
+	if tm.scrubStop != nil {
+		close(tm.scrubStop)
+	}
+	tm.flush()
+	if tm.pacer != nil {
+		tm.pacer.drain()
+	}
+}
+
+// Clone returns a new, independent TimedMap containing
+// all key-value pairs of all sections of the map with
+// their remaining lifetimes and registered callbacks.
+// Options of the map are applied to the clone as well.
+//
+// The clone runs its own cleanup loop with the interval
+// of the internal cleanup loop of the map. When the map
+// is driven by an external initiator, the cleanup loop
+// of the clone must be started by the caller.
+//
+// Callback functions are shared between both maps, so
+// they are executed for each map the key-value pair
+// expires in. Holds are not transferred to the clone.
+func (tm *TimedMap) Clone() *TimedMap {
+	if tm.checkClosed() != nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	container := make(map[keyWrap]*element, len(tm.container))
+	for k, v := range tm.container {
+		if v.expired(now) {
+			continue
+		}
+		container[k] = v.clone()
+	}
+	cleanupTickTime := tm.cleanupTickTime
+	tm.mtx.RUnlock()
+
+	c := newTimedMap(container, cleanupTickTime, nil, []Option{func(c *TimedMap) {
+		tm.mtx.RLock()
+		defer tm.mtx.RUnlock()
+		tm.copyOptions(c)
+	}})
+
+	if c.entryTimers {
+		c.mtx.Lock()
+		for k, v := range c.container {
+			c.schedule(k, v)
+		}
+		c.mtx.Unlock()
+	}
+
+	if tm.IsReady() {
+		c.SetReady()
+	}
+
+	return c
+}
+
+// MergeStrategy defines how Merge handles keys
+// which exist in both maps.
+type MergeStrategy int
+
+const (
+	// MergeKeepExisting keeps the existing
+	// key-value pair of the map.
+	MergeKeepExisting MergeStrategy = iota
+
+	// MergeOverwrite replaces the existing
+	// key-value pair with the one of the
+	// merged map.
+	MergeOverwrite
+
+	// MergeKeepLongerTTL keeps the key-value
+	// pair which expires later.
+	MergeKeepLongerTTL
+)
+
+// Merge copies all key-value pairs of all sections of
+// other into the map with their remaining lifetimes and
+// registered callbacks. Keys existing in both maps are
+// handled as defined by strategy.
+//
+// Like with Clone, callback functions are shared between
+// both maps and holds are not transferred.
+func (tm *TimedMap) Merge(other *TimedMap, strategy MergeStrategy) {
+	if tm.checkClosed() != nil || other == tm {
+		return
+	}
+
+	now := time.Now()
+
+	other.mtx.RLock()
+	elements := make(map[keyWrap]*element, len(other.container))
+	for k, v := range other.container {
+		if !v.expired(now) {
+			elements[k] = v.clone()
+		}
+	}
+	other.mtx.RUnlock()
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	for k, v := range elements {
+		if ev, ok := tm.container[k]; ok {
+			if !ev.expired(now) {
+				switch strategy {
+				case MergeKeepExisting:
+					continue
+				case MergeKeepLongerTTL:
+					if !v.expires.After(ev.expires) {
+						continue
+					}
+				}
+			}
+			tm.deleteElement(k, ev)
+		}
+		tm.insertElement(k, v)
+		tm.schedule(k, v)
+	}
+}
+
+// copyOptions applies the configuration
+// of the map to c.
+func (tm *TimedMap) copyOptions(c *TimedMap) {
+	c.refreshPolicy = tm.refreshPolicy
+	c.maxHold = tm.maxHold
+	c.maxCallbacks = tm.maxCallbacks
+	c.normalizeKey = tm.normalizeKey
+	c.closedPolicy = tm.closedPolicy
+	c.entryTimers = tm.entryTimers
+	c.cleanupYield = tm.cleanupYield
+	c.ordered = tm.ordered
+	c.orderedExpiry = tm.orderedExpiry
+	c.replaceOnRename = tm.replaceOnRename
+	c.valueEqual = tm.valueEqual
+	c.admit = tm.admit
+	c.ttlRules = tm.ttlRules
+	c.ttlOverrides = tm.ttlOverrides
+	c.ttlJitter = tm.ttlJitter
+	c.grace = tm.grace
+	if p := tm.pacer; p != nil {
+		c.pacer = newRemovalPacer(p.batch, p.interval, p.progress)
+	}
+	c.defaultExpiration = tm.defaultExpiration
+	c.onExpire = tm.onExpire
+	c.sizer = tm.sizer
+	c.provenance = tm.provenance
+	c.sliding = tm.sliding
+	c.maxLifetime = tm.maxLifetime
+	c.quota = tm.quota
+	for sec, typ := range tm.valueTypes {
+		if c.valueTypes == nil {
+			c.valueTypes = make(map[int]reflect.Type)
+		}
+		c.valueTypes[sec] = typ
+	}
+	if tm.strict != nil {
+		c.strict = &strictChecks{report: tm.strict.report}
+	}
+	c.negativeBase = tm.negativeBase
+	c.negativeMax = tm.negativeMax
+	c.staleSectionPolicy = tm.staleSectionPolicy
+	c.maintenanceInterval = tm.maintenanceInterval
+	c.maintenanceBudget = tm.maintenanceBudget
+	c.scrubInterval = tm.scrubInterval
+	c.scrubBudget = tm.scrubBudget
+	c.scrubHandler = tm.scrubHandler
+	c.asyncQueue = tm.asyncQueue
+	c.overflowPolicy = tm.overflowPolicy
+	if tm.latencies != nil {
+		c.latencies = new(latencyTracker)
+	}
+}
+
+// Reconfigure applies the given options to the running
+// map without dropping any key-value pairs. When the
+// cleanup interval is changed using WithCleanupInterval,
+// the internal cleanup loop is restarted with the new
+// interval, or stopped if it is 0.
+//
+// Only the options setting the cleanup interval, the
+// RefreshPolicy, the maximum hold duration and callback
+// count, the value equality, the admission hook, the
+// TTL rules, the default TTL, the expire handler, the
+// sizer, the section quota, the negative backoff and the
+// rename behavior are applied. All other options can
+// only be set on creation and are ignored.
+//
+// When the section quota is lowered, sections holding
+// more key-value pairs than the new quota keep them until
+// they expire or are removed, while new keys are rejected
+// until the section is within the quota again.
+//
+// When a sizer is configured, the costs of all stored
+// key-value pairs are determined again, so that costs
+// of different sizers are not mixed.
+func (tm *TimedMap) Reconfigure(opts ...Option) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+
+	c := new(TimedMap)
+	c.cleanupTickTime = tm.cleanupTickTime
+	tm.copyOptions(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	tm.refreshPolicy = c.refreshPolicy
+	tm.maxHold = c.maxHold
+	tm.maxCallbacks = c.maxCallbacks
+	tm.valueEqual = c.valueEqual
+	tm.admit = c.admit
+	tm.ttlRules = c.ttlRules
+	tm.defaultExpiration = c.defaultExpiration
+	tm.onExpire = c.onExpire
+	tm.negativeBase = c.negativeBase
+	tm.negativeMax = c.negativeMax
+	tm.replaceOnRename = c.replaceOnRename
+
+	if tm.sizer != nil || c.sizer != nil {
+		tm.sizer = c.sizer
+		for k, v := range tm.container {
+			v.cost = 0
+			if tm.sizer != nil {
+				v.cost = tm.sizer(k.key, v.value)
+			}
+		}
+	}
+
+	if c.quota != tm.quota {
+		tm.quota = c.quota
+		tm.sectionSizes = nil
+		for k := range tm.container {
+			tm.countSection(k.sec, 1)
+		}
+	}
+
+	interval := c.cleanupTickTime
+	restart := interval != tm.cleanupTickTime && !tm.entryTimers
+	if restart && interval <= 0 {
+		tm.cleanupTickTime = 0
+	}
+
+	tm.mtx.Unlock()
+
+	if !restart {
+		return
+	}
+	if interval > 0 {
+		tm.StartCleanerInternal(interval)
+	} else {
+		tm.StopCleaner()
+	}
+}
+
+// CleanUpNow runs a full cleanup cycle immediately and
+// returns the number of expired key-value pairs. This is
+// useful when no cleanup loop is running and the cleanup
+// shall be driven by the application.
+func (tm *TimedMap) CleanUpNow() int {
+	if tm.checkClosed() != nil {
+		return 0
+	}
+
+	return tm.cleanUp()
+}
+
+// ExpiredKeys returns the keys of all key-value pairs in
+// the map which have expired but were not yet removed,
+// i.e. which would be expired by a cleanup cycle right
+// now. The pairs are neither removed nor are their
+// callbacks executed.
+func (tm *TimedMap) ExpiredKeys() []interface{} {
+	return tm.expiredKeys(tm.owns)
+}
+
+// KeysExpiringBefore returns the keys of all key-value
+// pairs in the map which have not expired yet but will
+// expire before t.
+func (tm *TimedMap) KeysExpiringBefore(t time.Time) []interface{} {
+	return tm.keysExpiringBefore(tm.owns, t)
+}
+
+// NextExpiry returns the soonest point of time at which
+// a non-expired key-value pair of all sections of the
+// map expires. ok is false if the map contains no
+// non-expired pairs.
+func (tm *TimedMap) NextExpiry() (t time.Time, ok bool) {
+	return tm.nextExpiry(ownsAll)
+}
+
+// SoonestExpiring returns the entries of the at most n
+// non-expired key-value pairs in the map which expire
+// next, sorted ascending by their expiration time.
+func (tm *TimedMap) SoonestExpiring(n int) []Entry {
+	return tm.soonestExpiring(tm.owns, 0, n)
+}
+
+// KeysByExpiry returns the keys of all non-expired
+// key-value pairs in the map sorted ascending by their
+// expiration time.
+func (tm *TimedMap) KeysByExpiry() []interface{} {
+	return tm.keysByExpiry(tm.owns)
+}
+
+// CleanupN expires at most max expired key-value pairs
+// and returns the number of expired pairs. remaining is
+// true, if there are still expired pairs left in the map.
+//
+// This is useful when driving the cleanup externally in
+// bounded slices interleaved with other work.
+func (tm *TimedMap) CleanupN(max int) (expired int, remaining bool) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if tm.orderedExpiry {
+		return tm.expireOverdue(now, max)
+	}
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if !v.expired(now) || tm.inGrace(v, now) {
+			return true
+		}
+		if expired >= max {
+			remaining = true
+			return false
+		}
+		tm.expireElement(k.key, k.sec, v)
+		expired++
+		return true
+	})
+
+	return
+}
+
+// Snapshot returns a new map which represents the
+// current key-value state of the internal container.
+func (tm *TimedMap) Snapshot() map[interface{}]interface{} {
+	return tm.getSnapshot(0)
+}
+
+// SnapshotEntries returns a new map containing the entries
+// of all key-value pairs in the map which have not expired,
+// including their expiration and creation times.
+func (tm *TimedMap) SnapshotEntries() map[interface{}]Entry {
+	return tm.snapshotEntries(tm.owns, 0)
+}
+
+// SnapshotInto writes all key-value pairs of the map
+// like Snapshot into dst after removing all existing
+// entries of dst. This allows re-using a map across
+// periodic snapshots.
+func (tm *TimedMap) SnapshotInto(dst map[interface{}]interface{}) {
+	clearSnapshot(dst)
+	tm.fillSnapshot(dst, 0)
+}
+
+// BorrowSnapshot returns a map like Snapshot, which is
+// taken from an internal pool, and a release function
+// which returns the map to the pool. This avoids
+// allocating a new map on each snapshot when called
+// frequently.
+//
+// The map must not be used anymore after release
+// has been called.
+func (tm *TimedMap) BorrowSnapshot() (m map[interface{}]interface{}, release func()) {
+	return tm.borrowSnapshot(func(m map[interface{}]interface{}) {
+		tm.fillSnapshot(m, 0)
+	})
+}
+
+// cleanupLoop holds the loop executing the cleanup
+// when initiated by tc.
+//
+// The loop is marked as running and counted by the
+// caller before it is started and as stopped by
+// StopCleaner, so that a map closed right after being
+// created does not miss a loop which has not been
+// scheduled yet.
+func (tm *TimedMap) cleanupLoop(tc <-chan time.Time) {
+	defer atomic.AddInt32(tm.goroutines, -1)
+
+	for {
+		select {
+		case <-tc:
+			tm.cleanUp()
+		case <-tm.cleanerStopChan:
+			return
+		}
+	}
+}
+
+// expireElement removes the specified key-value element
+// from the map and executes all defined callback functions
+//
+// As elements are only expired while the write lock is
+// held and are removed from the map right after, each
+// expiration is passed exactly once to the callbacks and
+// the expire handler of the map.
+//
+// If the map was created with WithOrderedExpiry, all
+// overdue elements of the section expiring before v are
+// expired first.
+func (tm *TimedMap) expireElement(key interface{}, sec int, v *element) {
+	if tm.orderedExpiry {
+		tm.expirePreceding(sec, v)
+	}
+	tm.expireOne(key, sec, v)
+}
+
+// expireOne removes the specified key-value element
+// from the map and executes all defined callback functions
+// like expireElement, regardless of other overdue elements.
+func (tm *TimedMap) expireOne(key interface{}, sec int, v *element) {
+	if tm.expirations != nil {
+		tm.enqueue(expirationOf(key, sec, v, time.Now()))
+		tm.deleteElement(keyWrap{sec: sec, key: key}, v)
+		return
+	}
+
 	for _, cb := range v.cbs {
+		tm.runCallback(cb, v.value)
+	}
+	for _, cb := range v.addedCbs {
+		tm.runCallback(cb, v.value)
+	}
+	if tm.onExpire != nil {
+		tm.onExpire(v.entry(key, sec, time.Now()))
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.deleteElement(k, v)
+}
+
+// cleanUp iterates trhough the map and expires all key-value
+// pairs which expire time after the current time and returns
+// the number of expired pairs.
+func (tm *TimedMap) cleanUp() (expired int) {
+	now := time.Now()
+
+	if tm.latencies != nil {
+		defer tm.latencies.cleanup.since(now)
+	}
+
+	if tm.cleanupYield > 0 && !tm.ordered && !tm.orderedExpiry {
+		return tm.cleanUpSliced(now)
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if tm.orderedExpiry {
+		expired, _ = tm.expireOverdue(now, 0)
+	}
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if tm.checkElement(k, v, now) {
+			expired++
+		}
+		return true
+	})
+	tm.pruneNegatives(now)
+
+	return
+}
+
+// cleanUpSliced expires all key-value pairs which have
+// expired at now like cleanUp, but releases the write lock
+// after each slice of cleanupYield checked pairs.
+//
+// The keys index is traversed from its end like in
+// streamSnapshot, so that pairs moved by a removal while
+// the lock is released are only moved to positions which
+// have already been checked.
+func (tm *TimedMap) cleanUpSliced(now time.Time) (expired int) {
+	tm.mtx.Lock()
+	cursor := len(tm.keys)
+	for {
+		for n := 0; cursor > 0 && n < tm.cleanupYield; n++ {
+			cursor--
+			k := tm.keys[cursor]
+			v := tm.container[k]
+			if tm.checkElement(k, v, now) {
+				expired++
+			}
+		}
+		if cursor == 0 || atomic.LoadUint32(tm.closed) != 0 {
+			break
+		}
+
+		tm.mtx.Unlock()
+		atomic.AddUint64(tm.cleanupYields, 1)
+		runtime.Gosched()
+		tm.mtx.Lock()
+
+		if cursor > len(tm.keys) {
+			cursor = len(tm.keys)
+		}
+	}
+	tm.pruneNegatives(now)
+	tm.mtx.Unlock()
+
+	return
+}
+
+// checkElement expires the element v stored by k if
+// it has expired at the given point of time and its grace
+// period has passed. Otherwise, due warning and soft
+// expiration callbacks are executed. true is returned if
+// the element has been expired.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) checkElement(k keyWrap, v *element, now time.Time) bool {
+	if v.expired(now) {
+		if tm.inGrace(v, now) {
+			return false
+		}
+		tm.expireElement(k.key, k.sec, v)
+		return true
+	}
+	if v.shouldWarn(now) {
+		tm.warnElement(v)
+	}
+	if !v.softFired && v.stale(now) {
+		v.softFired = true
+		for _, cb := range v.softCbs {
+			cb(v.value)
+		}
+	}
+	return false
+}
+
+// warnElement executes all defined warning callbacks
+// of the element and marks it as warned.
+func (tm *TimedMap) warnElement(v *element) {
+	v.warned = true
+	for _, cb := range v.warnCbs {
 		cb(v.value)
 	}
+}
+
+// set sets the value for a key and section with the
+// given expiration parameters. If a non-expired value
+// was existent on this key, it is returned and replaced
+// is set to true.
+func (tm *TimedMap) set(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, replaced bool) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	old, replaced, _ = tm.setLocked(key, sec, val, expiresAfter, cb...)
+	return
+}
+
+// setBy sets the value for a key and section like set
+// and records caller as the caller which set the value,
+// if provenance is enabled.
+func (tm *TimedMap) setBy(
+	caller string,
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) {
+	if !tm.provenance {
+		tm.set(key, sec, val, expiresAfter, cb...)
+		return
+	}
+
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.caller = caller
+	tm.setLocked(key, sec, val, expiresAfter, cb...)
+	tm.caller = ""
+}
+
+// swap sets the value for a key and section and returns
+// the previous value, if it existed and has not expired.
+func (tm *TimedMap) swap(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, existed bool) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if v := tm.getLocked(key, sec); v != nil {
+		old, existed = v.valueAt(time.Now()), true
+	}
+	tm.setLocked(key, sec, val, expiresAfter, cb...)
+	return
+}
+
+// setAt sets the value for a key and section which
+// expires at the given point of time.
+func (tm *TimedMap) setAt(
+	key interface{},
+	sec int,
+	val interface{},
+	at time.Time,
+	cb ...callback,
+) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.set.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	tm.setLockedAt(key, sec, val, time.Now(), at, cb...)
+}
+
+// setLocked sets the value for a key and section like
+// set. The caller must hold the write lock of the map.
+func (tm *TimedMap) setLocked(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (old interface{}, replaced bool, err error) {
+	now := time.Now()
+
+	if expiresAfter == DefaultTTL {
+		expiresAfter = tm.defaultTTL(key)
+	}
+
+	var expires time.Time
+	if expiresAfter != KeepTTL {
+		expires = expiresAt(now, expiresAfter)
+	}
+
+	return tm.setLockedAt(key, sec, val, now, expires, cb...)
+}
+
+// defaultTTL returns the expiration duration
+// for the given key used when DefaultTTL is
+// passed as expiration duration.
+func (tm *TimedMap) defaultTTL(key interface{}) time.Duration {
+	if tm.ttlRules != nil {
+		if d := tm.ttlRules(key); d != DefaultTTL {
+			return d
+		}
+	}
+	return tm.defaultExpiration
+}
+
+// setLockedAt sets the value for a key and section
+// which expires at the given point of time. If expires
+// is zero, the expiration time of the existing value
+// is kept and nothing is set if there is none.
+//
+// If the value has not been stored, an error is returned:
+// ErrValueType if it is not of the value type of the
+// section, ErrRejected if it was rejected by the
+// admission hook, ErrQuotaExceeded if the quota of the
+// section has been reached and ErrKeyNotFound if expires
+// is zero and the key does not exist.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) setLockedAt(
+	key interface{},
+	sec int,
+	val interface{},
+	now, expires time.Time,
+	cb ...callback,
+) (old interface{}, replaced bool, err error) {
+	if err = tm.checkValueType(sec, val); err != nil {
+		return
+	}
+
+	if !expires.IsZero() {
+		expires = tm.overrideExpires(key, now, expires)
+		expires = tm.jitterExpires(now, expires)
+	}
+
+	if tm.admit != nil {
+		ttl := KeepTTL
+		if !expires.IsZero() {
+			ttl = expires.Sub(now)
+		}
+		allow, ttl := tm.admit(key, val, ttl)
+		if !allow {
+			err = ErrRejected
+			return
+		}
+		expires = time.Time{}
+		if ttl != KeepTTL {
+			expires = expiresAt(now, ttl)
+		}
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	// re-use element when existent on this key
+	v, ok := tm.container[k]
+	if ok && !v.expired(now) {
+		old, replaced = v.valueAt(now), true
+	}
+
+	unchanged := replaced && tm.valueEqual != nil && tm.valueEqual(v.value, val)
+
+	if expires.IsZero() {
+		if !replaced {
+			err = ErrKeyNotFound
+			return
+		}
+	} else {
+		if !ok {
+			if !tm.quotaAllows(k) {
+				err = ErrQuotaExceeded
+				return
+			}
+			v = tm.elementPool.Get().(*element)
+			tm.insertElement(k, v)
+		}
+		v.expires = expires
+	}
+
+	delete(tm.negatives, k)
+
+	if !expires.IsZero() {
+		v.sliding = 0
+		if (tm.sliding || tm.slideNext) && !expires.Equal(neverExpires) {
+			v.sliding = expires.Sub(now)
+		}
+	}
+
+	// Equal values are kept together with their
+	// metadata, only expiration and callbacks are
+	// applied.
+	if !replaced {
+		v.created = now
+		v.addedCbs = nil
+		v.deadline = time.Time{}
+		if tm.maxLifetime > 0 {
+			v.deadline = now.Add(tm.maxLifetime)
+		}
+	}
+	v.capExpires()
+
+	if unchanged {
+		if tm.caller != "" {
+			v.caller = tm.caller
+		}
+		v.cbs = cb
+		v.warned = false
+		tm.schedule(k, v)
+		return old, false, nil
+	}
+
+	if ok {
+		v.finalize()
+	}
+	v.value = val
+	v.cbs = cb
+	v.caller = tm.caller
+	if tm.sizer != nil {
+		v.cost = tm.sizer(key, val)
+	}
+	v.clearMeta()
+	if !ok {
+		v.holds = 0
+		v.heldUntil = time.Time{}
+	}
+	tm.schedule(k, v)
+
+	return
+}
+
+// setMulti sets all key-value pairs of the map entries
+// in the given section. Each key is passed through
+// keyFn before being set.
+func (tm *TimedMap) setMulti(
+	keyFn func(key interface{}) interface{},
+	sec int,
+	entries interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	mv := reflect.ValueOf(entries)
+	if mv.Kind() != reflect.Map {
+		return ErrValueNoMap
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	iter := mv.MapRange()
+	for iter.Next() {
+		key := keyFn(iter.Key().Interface())
+		tm.setLocked(key, sec, iter.Value().Interface(), expiresAfter, cb...)
+	}
+
+	return nil
+}
+
+// setAll sets all key-value pairs of entries in the
+// given section. Each key is passed through keyFn
+// before being set.
+func (tm *TimedMap) setAll(keyFn func(key interface{}) interface{}, sec int, entries []KV) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	for _, e := range entries {
+		if e.Callback != nil {
+			tm.setLocked(keyFn(e.Key), sec, e.Value, e.ExpiresAfter, e.Callback)
+		} else {
+			tm.setLocked(keyFn(e.Key), sec, e.Value, e.ExpiresAfter)
+		}
+	}
+}
+
+// getOrSet returns the value of the given key in the
+// given section, if existent. Otherwise, the passed
+// value is set. If it could not be stored, the error
+// of setLockedAt is returned.
+func (tm *TimedMap) getOrSet(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) (actual interface{}, loaded bool, err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	if v := tm.getLocked(key, sec); v != nil {
+		return v.valueAt(time.Now()), true, nil
+	}
+
+	if _, _, err = tm.setLocked(key, sec, val, expiresAfter, cb...); err != nil {
+		return
+	}
+	return val, false, nil
+}
+
+// setIfNotExists sets the value of the given key in the
+// given section if it does not exist and returns true
+// if the value has been set.
+func (tm *TimedMap) setIfNotExists(
+	key interface{},
+	sec int,
+	val interface{},
+	expiresAfter time.Duration,
+	cb ...callback,
+) bool {
+	if tm.checkClosed() != nil {
+		return false
+	}
+
+	_, loaded, err := tm.getOrSet(key, sec, val, expiresAfter, cb...)
+	return !loaded && err == nil
+}
+
+// upsertFunc returns an UpdateFunc calling insert if
+// the key does not exist and update otherwise.
+func upsertFunc(
+	insert func() (interface{}, time.Duration),
+	update func(old interface{}) (interface{}, time.Duration),
+) UpdateFunc {
+	return func(old interface{}, exists bool) (interface{}, time.Duration) {
+		if !exists {
+			return insert()
+		}
+		return update(old)
+	}
+}
+
+// update sets the value of the given key in the
+// given section to the result of fn. If the result
+// could not be stored, the error of setLockedAt is
+// returned.
+func (tm *TimedMap) update(key interface{}, sec int, fn UpdateFunc) (err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		val, expiresAfter := fn(nil, false)
+		_, _, err = tm.setLocked(key, sec, val, expiresAfter)
+		return
+	}
+
+	val, expiresAfter := fn(v.valueAt(time.Now()), true)
+	_, _, err = tm.setLocked(key, sec, val, expiresAfter, v.cbs...)
+	return
+}
+
+// increment adds delta to the numeric value of the
+// given key in the given section.
+func (tm *TimedMap) increment(
+	key interface{},
+	sec int,
+	delta int64,
+	expiresAfter time.Duration,
+) (interface{}, error) {
+	if err := tm.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		if expiresAfter == KeepTTL {
+			return nil, ErrKeyNotFound
+		}
+		if _, _, err := tm.setLocked(key, sec, delta, expiresAfter); err != nil {
+			return nil, err
+		}
+		return delta, nil
+	}
+
+	val, ok := addNumeric(v.valueAt(time.Now()), delta)
+	if !ok {
+		return nil, ErrValueNotNumeric
+	}
+
+	if _, _, err := tm.setLocked(key, sec, val, expiresAfter, v.cbs...); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// get returns an element object by key and section
+// if the value has not already expired
+func (tm *TimedMap) get(key interface{}, sec int) *element {
+	if tm.checkClosed() != nil {
+		return nil
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.get.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	return tm.getLocked(key, sec)
+}
+
+// tryGetValue returns the value of the given key
+// in the given section, if the value has not
+// already expired.
+func (tm *TimedMap) tryGetValue(key interface{}, sec int) (val interface{}, ok bool) {
+	if tm.checkClosed() != nil {
+		return nil, false
+	}
+
+	if tm.latencies != nil {
+		defer tm.latencies.get.since(time.Now())
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	tm.slide(key, sec, v, now)
+	return v.valueAt(now), true
+}
+
+// getValueE returns the value of the given key in the
+// given section or ErrKeyNotFound if it does not exist.
+func (tm *TimedMap) getValueE(key interface{}, sec int) (interface{}, error) {
+	if err := tm.checkClosed(); err != nil {
+		return nil, err
+	}
+	val, ok := tm.tryGetValue(key, sec)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return val, nil
+}
+
+// getValueDefault returns the value of the given key
+// in the given section or def if it does not exist.
+func (tm *TimedMap) getValueDefault(key interface{}, sec int, def interface{}) interface{} {
+	if val, ok := tm.tryGetValue(key, sec); ok {
+		return val
+	}
+	return def
+}
+
+// getEntry returns the entry of the container key k
+// in the given section. key is the key as seen from
+// the section, which is set as key of the entry.
+func (tm *TimedMap) getEntry(key, k interface{}, sec int) (Entry, error) {
+	if err := tm.checkClosed(); err != nil {
+		return Entry{}, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(k, sec)
+	if v == nil {
+		return Entry{}, ErrKeyNotFound
+	}
+	return v.entry(key, sec, time.Now()), nil
+}
+
+// getExpires returns the expiration time of the
+// given key in the given section.
+func (tm *TimedMap) getExpires(key interface{}, sec int) (time.Time, error) {
+	if err := tm.checkClosed(); err != nil {
+		return time.Time{}, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return time.Time{}, ErrKeyNotFound
+	}
+	return v.expires, nil
+}
+
+// contains returns true if the given key exists in
+// the given section and has not expired yet.
+//
+// Unlike get, contains only takes the read lock and
+// leaves expired elements to the cleaner.
+func (tm *TimedMap) contains(key interface{}, sec int) bool {
+	if tm.checkClosed() != nil {
+		return false
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	v, ok := tm.container[k]
+	return ok && !v.expired(time.Now())
+}
+
+// ttl returns the remaining lifetime of the given
+// key in the given section.
+func (tm *TimedMap) ttl(key interface{}, sec int) (time.Duration, error) {
+	if err := tm.checkClosed(); err != nil {
+		return 0, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return 0, ErrKeyNotFound
+	}
+
+	if v.expires.Equal(neverExpires) {
+		return NoExpiration, nil
+	}
+
+	// Held elements may outlive their expiration time.
+	d := time.Until(v.expires)
+	if d < 0 {
+		d = 0
+	}
+	return d, nil
+}
+
+// getRaw returns the raw element object by key,
+// not depending on expiration time
+func (tm *TimedMap) getRaw(key interface{}, sec int) *element {
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.RLock()
+	v, ok := tm.container[k]
+	tm.mtx.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return v
+}
+
+// remove removes an element from the map by giveb
+// key and section
+func (tm *TimedMap) remove(key interface{}, sec int) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v, ok := tm.container[k]
+	if !ok {
+		return
+	}
+
+	tm.deleteElement(k, v)
+}
+
+// removeMulti removes all elements of the given keys in
+// the given section. Each key is passed through keyFn
+// before being removed.
+func (tm *TimedMap) removeMulti(
+	keyFn func(key interface{}) interface{},
+	sec int,
+	keys []interface{},
+) (n int) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	for _, key := range keys {
+		k := keyWrap{
+			sec: sec,
+			key: keyFn(key),
+		}
+		if v, ok := tm.container[k]; ok {
+			tm.deleteElement(k, v)
+			n++
+		}
+	}
+
+	return
+}
+
+// compareAndRemove removes the element of the given key in
+// the given section only if its value equals val. Returns
+// true, if the element has been removed.
+func (tm *TimedMap) compareAndRemove(key interface{}, sec int, val interface{}) bool {
+	if tm.checkClosed() != nil {
+		return false
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v, ok := tm.container[k]
+	if !ok || v.value != val {
+		return false
+	}
+
+	tm.deleteElement(k, v)
+	return true
+}
+
+// pop removes an element from the map by given key and
+// section and returns its value, if it has not already
+// expired.
+func (tm *TimedMap) pop(key interface{}, sec int) (val interface{}, ok bool) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return nil, false
+	}
+
+	val = v.valueAt(time.Now())
+	v.finalizer = nil
+	tm.deleteElement(k, v)
+
+	return val, true
+}
+
+// insertElement adds the element v by k to the
+// container and the keys index.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) insertElement(k keyWrap, v *element) {
+	v.idx = len(tm.keys)
+	tm.keys = append(tm.keys, k)
+	tm.container[k] = v
+	tm.countSection(k.sec, 1)
+	if len(tm.container) > tm.peak {
+		tm.peak = len(tm.container)
+	}
+}
+
+// deleteElement removes the element v stored by k from
+// the container and the keys index and returns it to
+// the element pool.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) deleteElement(k keyWrap, v *element) {
+	v.finalize()
+
+	last := len(tm.keys) - 1
+	if v.idx != last {
+		lk := tm.keys[last]
+		tm.keys[v.idx] = lk
+		tm.container[lk].idx = v.idx
+	}
+	tm.keys[last] = keyWrap{}
+	tm.keys = tm.keys[:last]
+
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+		tm.timers--
+	}
+
+	tm.untrackExpiry(v)
+	tm.elementPool.Put(v)
+	delete(tm.container, k)
+	tm.countSection(k.sec, -1)
+}
+
+// refresh extends the lifetime of the given key in the
+// given section by the duration d. The previous
+// expiration time is returned.
+func (tm *TimedMap) refresh(key interface{}, sec int, d time.Duration) (prev time.Time, err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getForUpdate(key, sec)
+	if v == nil {
+		return prev, ErrKeyNotFound
+	}
+	prev = v.expires
+	tm.refreshLocked(key, sec, v, d)
+	return
+}
+
+// getAndRefresh returns the value of the given key in
+// the given section and extends its expire time about
+// the duration d in a single locked operation.
+func (tm *TimedMap) getAndRefresh(key interface{}, sec int, d time.Duration) (interface{}, error) {
+	if err := tm.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getForUpdate(key, sec)
+	if v == nil {
+		return nil, ErrKeyNotFound
+	}
+	tm.refreshLocked(key, sec, v, d)
+	return v.valueAt(time.Now()), nil
+}
+
+// refreshLocked extends the expire time of the element
+// v stored by key in section sec about the duration d.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) refreshLocked(key interface{}, sec int, v *element, d time.Duration) {
+	v.expires = expiresAt(v.expires, d)
+	v.capExpires()
+	v.warned = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+}
+
+// setExpires sets the lifetime of the given key in the
+// given section to the duration d.
+// The previous expiration time is returned.
+func (tm *TimedMap) setExpires(key interface{}, sec int, d time.Duration) (time.Time, error) {
+	return tm.setExpiresAt(key, sec, expiresAt(time.Now(), d))
+}
+
+// setExpiresAt sets the expiration time of the given
+// key in the given section to t.
+// The previous expiration time is returned.
+func (tm *TimedMap) setExpiresAt(key interface{}, sec int, t time.Time) (prev time.Time, err error) {
+	if err = tm.checkClosed(); err != nil {
+		return
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getForUpdate(key, sec)
+	if v == nil {
+		return prev, ErrKeyNotFound
+	}
+	prev = v.expires
+	v.expires = tm.overrideExpires(key, time.Now(), t)
+	v.capExpires()
+	v.warned = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+	return
+}
+
+// touch resets the lifetime of the given key in the
+// given section to its default TTL.
+func (tm *TimedMap) touch(key interface{}, sec int) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getForUpdate(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.expires = expiresAt(time.Now(), tm.defaultTTL(key))
+	v.capExpires()
+	v.warned = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+	return nil
+}
+
+// hold suspends the expiration of the given key in the
+// given section until the returned release function
+// is called.
+func (tm *TimedMap) hold(key interface{}, sec int) (release func(), err error) {
+	if err := tm.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	v.holds++
+	if until := time.Now().Add(tm.maxHold); until.After(v.heldUntil) {
+		v.heldUntil = until
+	}
+	tm.schedule(k, v)
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			tm.mtx.Lock()
+			defer tm.mtx.Unlock()
+			if tm.container[k] == v && v.holds > 0 {
+				v.holds--
+				tm.schedule(k, v)
+			}
+		})
+	}
+
+	return release, nil
+}
+
+// getLocked returns an element object by key and section
+// if the value has not already expired. Expired elements
+// are expired and removed.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) getLocked(key interface{}, sec int) *element {
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	v, ok := tm.container[k]
+	if !ok {
+		return nil
+	}
+
+	if now := time.Now(); v.expired(now) {
+		if !tm.inGrace(v, now) {
+			tm.expireElement(key, sec, v)
+		}
+		return nil
+	}
+
+	return v
+}
+
+// getForUpdate returns an element object by key and
+// section which shall get a new expiration time.
+// Elements which have already expired are either
+// returned or expired and removed, depending on the
+// maps RefreshPolicy.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) getForUpdate(key interface{}, sec int) *element {
+	k := keyWrap{
+		sec: sec,
+		key: key,
+	}
+
+	if tm.refreshPolicy != RefreshResurrect {
+		return tm.getLocked(key, sec)
+	}
+
+	return tm.container[k]
+}
+
+// setDecay registers the decay function fn for the
+// given key in the given section.
+func (tm *TimedMap) setDecay(key interface{}, sec int, fn DecayFunc) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.decay = fn
+	v.decayStart = time.Now()
+	return nil
+}
+
+// setSoftExpires sets the soft expiration of the given
+// key in the given section to the duration d.
+func (tm *TimedMap) setSoftExpires(key interface{}, sec int, d time.Duration, cb ...callback) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.softExpires = time.Now().Add(d)
+	v.softCbs = cb
+	v.softFired = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+	return nil
+}
+
+// isStale returns true if the soft expiration time of
+// the given key in the given section has passed.
+func (tm *TimedMap) isStale(key interface{}, sec int) (bool, error) {
+	if err := tm.checkClosed(); err != nil {
+		return false, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return false, ErrKeyNotFound
+	}
+	return v.stale(time.Now()), nil
+}
+
+// addCallback appends cb to the callbacks of the
+// given key in the given section.
+func (tm *TimedMap) addCallback(key interface{}, sec int, cb ...callback) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	if tm.maxCallbacks > 0 && len(v.cbs)+len(v.addedCbs)+len(cb) > tm.maxCallbacks {
+		return ErrTooManyCallbacks
+	}
+
+	v.addedCbs = append(v.addedCbs, cb...)
+	return nil
+}
+
+// callbackCount returns the number of callbacks
+// of the given key in the given section.
+func (tm *TimedMap) callbackCount(key interface{}, sec int) (int, error) {
+	if err := tm.checkClosed(); err != nil {
+		return 0, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return 0, ErrKeyNotFound
+	}
+	return len(v.cbs) + len(v.addedCbs), nil
+}
+
+// clearCallbacks removes all expiration callbacks of
+// the given key in the given section.
+func (tm *TimedMap) clearCallbacks(key interface{}, sec int) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.cbs = nil
+	v.addedCbs = nil
+	return nil
+}
+
+// setWarning registers the warning callbacks cb for the
+// given key in the given section which are executed
+// before expiration.
+func (tm *TimedMap) setWarning(key interface{}, sec int, before time.Duration, cb ...callback) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	v.warnBefore = before
+	v.warnCbs = cb
+	v.warned = false
+	tm.schedule(keyWrap{sec: sec, key: key}, v)
+	return nil
+}
+
+func (tm *TimedMap) getSnapshot(sec int) (m map[interface{}]interface{}) {
+	m = make(map[interface{}]interface{})
+	tm.fillSnapshot(m, sec)
+	return
+}
 
-	k := keyWrap{
-		sec: sec,
-		key: key,
+// fillSnapshot writes all key-value pairs of the
+// given section into m.
+func (tm *TimedMap) fillSnapshot(m map[interface{}]interface{}, sec int) {
+	if tm.checkClosed() != nil {
+		return
 	}
 
-	tm.elementPool.Put(v)
-	delete(tm.container, k)
+	now := time.Now()
+	tm.checkSnapshot(now)
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if k.sec == sec {
+			m[k.key] = v.valueAt(now)
+		}
+		return true
+	})
 }
 
-// cleanUp iterates trhough the map and expires all key-value
-// pairs which expire time after the current time
-func (tm *TimedMap) cleanUp() {
+// values returns all non-expired values of the
+// elements matched by owns.
+func (tm *TimedMap) values(owns ownsFunc) (vals []interface{}) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
 	now := time.Now()
 
-	tm.mtx.Lock()
-	defer tm.mtx.Unlock()
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
 
-	for k, v := range tm.container {
-		if now.After(v.expires) {
-			tm.expireElement(k.key, k.sec, v)
+	vals = make([]interface{}, 0, len(tm.container))
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if _, ok := owns(k); ok && !v.expired(now) {
+			vals = append(vals, v.valueAt(now))
 		}
+		return true
+	})
+
+	return
+}
+
+// sectionGen returns the current generation
+// of the given section.
+func (tm *TimedMap) sectionGen(sec int) uint64 {
+	tm.sectionMtx.RLock()
+	defer tm.sectionMtx.RUnlock()
+
+	return tm.sectionGens[sec]
+}
+
+// checkClosed returns ErrClosed if the map has been
+// closed. If the ClosedPolicy of the map is ClosedPanic,
+// it panics with ErrClosed instead.
+func (tm *TimedMap) checkClosed() error {
+	if atomic.LoadUint32(tm.closed) == 0 {
+		return nil
+	}
+	tm.misuse(MisuseClosed, "operation on closed map")
+	if tm.closedPolicy == ClosedPanic {
+		panic(ErrClosed)
 	}
+	return ErrClosed
 }
 
-// set sets the value for a key and section with the
-// given expiration parameters
-func (tm *TimedMap) set(key interface{}, sec int, val interface{}, expiresAfter time.Duration, cb ...callback) {
-	// re-use element when existent on this key
-	if v := tm.getRaw(key, sec); v != nil {
-		tm.mtx.Lock()
-		defer tm.mtx.Unlock()
-		v.value = val
-		v.expires = time.Now().Add(expiresAfter)
-		v.cbs = cb
+// key returns the key as stored in the
+// container for the passed key.
+func (tm *TimedMap) key(key interface{}) interface{} {
+	if tm.normalizeKey == nil {
+		return key
+	}
+	return tm.normalizeKey(key)
+}
+
+// storedKey returns the passed key unchanged, for
+// keys which are already stored as in the container.
+func storedKey(key interface{}) interface{} {
+	return key
+}
+
+// rangeElements calls fn for each non-expired element
+// matched by owns until fn returns false.
+func (tm *TimedMap) rangeElements(owns ownsFunc, fn func(key, value interface{}) bool) {
+	if tm.checkClosed() != nil {
 		return
 	}
 
-	k := keyWrap{
-		sec: sec,
-		key: key,
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		key, ok := owns(k)
+		if !ok || v.expired(now) {
+			return true
+		}
+		return fn(key, v.valueAt(now))
+	})
+}
+
+// expire expires the element of the given key in
+// the given section and executes its callbacks.
+func (tm *TimedMap) expire(key interface{}, sec int) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
 	}
 
 	tm.mtx.Lock()
 	defer tm.mtx.Unlock()
 
-	v := tm.elementPool.Get().(*element)
-	v.value = val
-	v.expires = time.Now().Add(expiresAfter)
-	v.cbs = cb
-	tm.container[k] = v
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return ErrKeyNotFound
+	}
+	tm.expireElement(key, sec, v)
+	return nil
 }
 
-// get returns an element object by key and section
-// if the value has not already expired
-func (tm *TimedMap) get(key interface{}, sec int) *element {
-	v := tm.getRaw(key, sec)
-
-	if v == nil {
-		return nil
+// rename moves the element of oldKey in the
+// given section to newKey.
+func (tm *TimedMap) rename(oldKey, newKey interface{}, sec int) error {
+	if err := tm.checkClosed(); err != nil {
+		return err
 	}
 
 	tm.mtx.Lock()
 	defer tm.mtx.Unlock()
 
-	if time.Now().After(v.expires) {
-		tm.expireElement(key, sec, v)
-		return nil
+	v := tm.getLocked(oldKey, sec)
+	if v == nil {
+		return ErrKeyNotFound
 	}
 
-	return v
+	from := keyWrap{sec: sec, key: oldKey}
+	to := keyWrap{sec: sec, key: newKey}
+
+	// The target is looked up directly, as getLocked
+	// neither returns nor removes elements in their
+	// grace period. Expired targets are expired before
+	// being replaced, so that their callbacks are
+	// executed and their slot is released.
+	if t, ok := tm.container[to]; ok {
+		switch {
+		case t.expired(time.Now()):
+			tm.expireElement(newKey, sec, t)
+		case !tm.replaceOnRename:
+			return ErrKeyExists
+		case t == v:
+			return nil
+		default:
+			tm.deleteElement(to, t)
+		}
+	}
+
+	tm.keys[v.idx] = to
+	delete(tm.container, from)
+	tm.container[to] = v
+
+	v.holds = 0
+	v.heldUntil = time.Time{}
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+		tm.timers--
+	}
+	tm.schedule(to, v)
+
+	return nil
 }
 
-// getRaw returns the raw element object by key,
-// not depending on expiration time
-func (tm *TimedMap) getRaw(key interface{}, sec int) *element {
-	k := keyWrap{
-		sec: sec,
-		key: key,
+// keysExpiringBefore returns the keys of all non-expired
+// elements matched by owns which expire before t.
+func (tm *TimedMap) keysExpiringBefore(owns ownsFunc, t time.Time) (keys []interface{}) {
+	if tm.checkClosed() != nil {
+		return
 	}
 
+	now := time.Now()
+
 	tm.mtx.RLock()
-	v, ok := tm.container[k]
-	tm.mtx.RUnlock()
+	defer tm.mtx.RUnlock()
 
-	if !ok {
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		key, ok := owns(k)
+		if ok && !v.expired(now) && v.expires.Before(t) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return
+}
+
+// keysByExpiry returns the keys of all non-expired
+// elements matched by owns sorted ascending by their
+// expiration time, taking holds into account.
+func (tm *TimedMap) keysByExpiry(owns ownsFunc) []interface{} {
+	if tm.checkClosed() != nil {
 		return nil
 	}
 
-	return v
+	type keyExpires struct {
+		key     interface{}
+		expires time.Time
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	pairs := make([]keyExpires, 0, len(tm.container))
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if key, ok := owns(k); ok && !v.expired(now) {
+			pairs = append(pairs, keyExpires{key, v.effectiveExpires()})
+		}
+		return true
+	})
+	tm.mtx.RUnlock()
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].expires.Before(pairs[j].expires)
+	})
+
+	keys := make([]interface{}, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.key
+	}
+	return keys
 }
 
-// remove removes an element from the map by giveb
-// key and section
-func (tm *TimedMap) remove(key interface{}, sec int) {
-	k := keyWrap{
-		sec: sec,
-		key: key,
+// soonestExpiring returns the entries of the at most n
+// non-expired elements matched by owns, which belong
+// to section sec, expiring next.
+func (tm *TimedMap) soonestExpiring(owns ownsFunc, sec, n int) []Entry {
+	if tm.checkClosed() != nil || n <= 0 {
+		return nil
 	}
 
-	tm.mtx.Lock()
-	defer tm.mtx.Unlock()
+	now := time.Now()
+	h := make(expiryHeap, 0, n)
 
-	v, ok := tm.container[k]
-	if !ok {
+	tm.mtx.RLock()
+	for k, v := range tm.container {
+		key, ok := owns(k)
+		if !ok || v.expired(now) {
+			continue
+		}
+		expires := v.effectiveExpires()
+		if len(h) < n {
+			heap.Push(&h, expiryItem{v.entry(key, sec, now), expires})
+		} else if expires.Before(h[0].expires) {
+			h[0] = expiryItem{v.entry(key, sec, now), expires}
+			heap.Fix(&h, 0)
+		}
+	}
+	tm.mtx.RUnlock()
+
+	entries := make([]Entry, len(h))
+	for i := len(h) - 1; i >= 0; i-- {
+		entries[i] = heap.Pop(&h).(expiryItem).entry
+	}
+	return entries
+}
+
+// expiryItem is an entry together with its effective
+// expiration time.
+type expiryItem struct {
+	entry   Entry
+	expires time.Time
+}
+
+// expiryHeap is a max-heap of expiryItems ordered by
+// their effective expiration time, so that the latest
+// expiring item can be replaced in O(log n).
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[j].expires.Before(h[i].expires) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryItem)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// nextExpiry returns the soonest expiration time of
+// all non-expired elements matched by owns, taking
+// holds into account.
+func (tm *TimedMap) nextExpiry(owns ownsFunc) (t time.Time, ok bool) {
+	if tm.checkClosed() != nil {
 		return
 	}
 
-	tm.elementPool.Put(v)
-	delete(tm.container, k)
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	for k, v := range tm.container {
+		if _, own := owns(k); !own || v.expired(now) {
+			continue
+		}
+		if expires := v.effectiveExpires(); !ok || expires.Before(t) {
+			t, ok = expires, true
+		}
+	}
+	return
 }
 
-// refresh extends the lifetime of the given key in the
-// given section by the duration d.
-func (tm *TimedMap) refresh(key interface{}, sec int, d time.Duration) error {
-	v := tm.get(key, sec)
-	if v == nil {
-		return ErrKeyNotFound
+// snapshotEntries returns the entries of all
+// non-expired elements matched by owns, which
+// belong to the section sec.
+func (tm *TimedMap) snapshotEntries(owns ownsFunc, sec int) map[interface{}]Entry {
+	m := make(map[interface{}]Entry)
+
+	if tm.checkClosed() != nil {
+		return m
 	}
-	tm.mtx.Lock()
-	v.expires = v.expires.Add(d)
-	tm.mtx.Unlock()
-	return nil
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if key, ok := owns(k); ok && !v.expired(now) {
+			m[key] = v.entry(key, sec, now)
+		}
+		return true
+	})
+	return m
 }
 
-// setExpires sets the lifetime of the given key in the
-// given section to the duration d.
-func (tm *TimedMap) setExpires(key interface{}, sec int, d time.Duration) error {
-	v := tm.get(key, sec)
-	if v == nil {
-		return ErrKeyNotFound
+// expiredKeys returns the keys of all expired
+// elements matched by owns.
+func (tm *TimedMap) expiredKeys(owns ownsFunc) (keys []interface{}) {
+	if tm.checkClosed() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	tm.mtx.RLock()
+	defer tm.mtx.RUnlock()
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		if key, ok := owns(k); ok && v.expired(now) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return
+}
+
+// removeWhere deletes all non-expired elements matched
+// by owns for which fn returns true and returns the
+// number of deleted elements.
+func (tm *TimedMap) removeWhere(owns ownsFunc, fn func(key, value interface{}) bool) (n int) {
+	if tm.checkClosed() != nil {
+		return
 	}
+
+	now := time.Now()
+
 	tm.mtx.Lock()
-	v.expires = time.Now().Add(d)
-	tm.mtx.Unlock()
-	return nil
+	defer tm.mtx.Unlock()
+
+	tm.eachElement(func(k keyWrap, v *element) bool {
+		key, ok := owns(k)
+		if ok && !v.expired(now) && fn(key, v.valueAt(now)) {
+			tm.bulkDeleteElement(k, v)
+			n++
+		}
+		return true
+	})
+	tm.paceRemovals()
+	return
 }
 
-func (tm *TimedMap) getSnapshot(sec int) (m map[interface{}]interface{}) {
-	m = make(map[interface{}]interface{})
+// sampleKeys returns a uniform random sample of at most
+// n keys of non-expired elements matched by owns.
+//
+// The keys index is traversed in random order using a
+// partial Fisher-Yates shuffle, which only records the
+// swapped positions instead of modifying the index.
+func (tm *TimedMap) sampleKeys(owns ownsFunc, n int) []interface{} {
+	if tm.checkClosed() != nil {
+		return nil
+	}
+
+	now := time.Now()
 
 	tm.mtx.RLock()
 	defer tm.mtx.RUnlock()
 
-	for k, v := range tm.container {
-		if k.sec == sec {
-			m[k.key] = v.value
+	res := make([]interface{}, 0, n)
+	swapped := make(map[int]int)
+	at := func(i int) int {
+		if j, ok := swapped[i]; ok {
+			return j
+		}
+		return i
+	}
+
+	l := len(tm.keys)
+	for i := 0; i < l && len(res) < n; i++ {
+		j := i + rand.Intn(l-i)
+		pick := at(j)
+		swapped[j] = at(i)
+
+		k := tm.keys[pick]
+		if key, ok := owns(k); ok && !tm.container[k].expired(now) {
+			res = append(res, key)
 		}
 	}
 
+	return res
+}
+
+// owns returns true if the given container key
+// belongs to the root section of the map. Also,
+// the key as seen from the section is returned.
+func (tm *TimedMap) owns(k keyWrap) (interface{}, bool) {
+	return k.key, k.sec == 0
+}
+
+// ownsAll matches the keys of all sections.
+func ownsAll(k keyWrap) (interface{}, bool) {
+	return k.key, true
+}
+
+// borrowSnapshot takes a map from the snapshot pool,
+// fills it using fill and returns it together with
+// the function returning it to the pool.
+func (tm *TimedMap) borrowSnapshot(
+	fill func(m map[interface{}]interface{}),
+) (m map[interface{}]interface{}, release func()) {
+	m = tm.snapshotPool.Get().(map[interface{}]interface{})
+	fill(m)
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			clearSnapshot(m)
+			tm.snapshotPool.Put(m)
+		})
+	}
+
 	return
 }
 
+// clearSnapshot removes all entries of m.
+func clearSnapshot(m map[interface{}]interface{}) {
+	for k := range m {
+		delete(m, k)
+	}
+}
+
+// expired returns true when the expiration time of the
+// element has passed at the given point of time and the
+// element is not held.
+func (v *element) expired(now time.Time) bool {
+	if v.holds > 0 && now.Before(v.heldUntil) {
+		return false
+	}
+	if v.decay != nil {
+		if _, alive := v.decay(v.value, now.Sub(v.decayStart)); !alive {
+			return true
+		}
+	}
+	return now.After(v.expires)
+}
+
+// expiresAt returns the point of time d after t. If d is
+// NoExpiration or t is the expiration time of a pair which
+// never expires, the returned time is never reached.
+func expiresAt(t time.Time, d time.Duration) time.Time {
+	if d == NoExpiration || t.Equal(neverExpires) {
+		return neverExpires
+	}
+	return t.Add(d)
+}
+
+// jitterExpires returns the expiration time expires of a
+// value set at now, randomly spread by up to the TTL jitter
+// fraction of the map in both directions.
+func (tm *TimedMap) jitterExpires(now, expires time.Time) time.Time {
+	if tm.ttlJitter <= 0 || expires.Equal(neverExpires) {
+		return expires
+	}
+	spread := int64(float64(expires.Sub(now)) * tm.ttlJitter)
+	if spread <= 0 {
+		return expires
+	}
+	return expires.Add(time.Duration(rand.Int63n(2*spread+1) - spread))
+}
+
+// effectiveExpires returns the time at which the
+// element expires, which is extended by a hold.
+func (v *element) effectiveExpires() time.Time {
+	if v.holds > 0 && v.heldUntil.After(v.expires) {
+		return v.heldUntil
+	}
+	return v.expires
+}
+
+// valueAt returns the value of the element at the
+// given point of time.
+func (v *element) valueAt(now time.Time) interface{} {
+	if v.decay == nil {
+		return v.value
+	}
+	val, _ := v.decay(v.value, now.Sub(v.decayStart))
+	return val
+}
+
+// shouldWarn returns true when the element has warning
+// callbacks registered which have not been executed yet
+// and the warning point of time has passed.
+func (v *element) shouldWarn(now time.Time) bool {
+	return !v.warned && len(v.warnCbs) > 0 && !now.Before(v.expires.Add(-v.warnBefore))
+}
+
+// clearMeta removes all warnings, decay and soft
+// expiration registered for the current value of
+// the element.
+func (v *element) clearMeta() {
+	v.warnBefore = 0
+	v.warnCbs = nil
+	v.warned = false
+	v.decay = nil
+	v.softExpires = time.Time{}
+	v.softCbs = nil
+	v.softFired = false
+}
+
+// entry returns the Entry of the element
+// stored by the given key in section sec.
+func (v *element) entry(key interface{}, sec int, now time.Time) Entry {
+	return Entry{
+		Key:     key,
+		Value:   v.valueAt(now),
+		Expires: v.expires,
+		Created: v.created,
+		Section: sec,
+		Caller:  v.caller,
+	}
+}
+
+// clone returns a copy of the element without
+// holds, timer and position in the keys index.
+func (v *element) clone() *element {
+	return &element{
+		value:       v.value,
+		expires:     v.expires,
+		created:     v.created,
+		cbs:         append([]callback(nil), v.cbs...),
+		addedCbs:    append([]callback(nil), v.addedCbs...),
+		warnBefore:  v.warnBefore,
+		warnCbs:     append([]callback(nil), v.warnCbs...),
+		warned:      v.warned,
+		decay:       v.decay,
+		decayStart:  v.decayStart,
+		softExpires: v.softExpires,
+		softCbs:     append([]callback(nil), v.softCbs...),
+		softFired:   v.softFired,
+		caller:      v.caller,
+		sliding:     v.sliding,
+		deadline:    v.deadline,
+	}
+}
+
+// stale returns true when the element has a soft
+// expiration time set which has passed.
+func (v *element) stale(now time.Time) bool {
+	return !v.softExpires.IsZero() && now.After(v.softExpires)
+}
+
 func newTimedMap(
 	container map[keyWrap]*element,
 	cleanupTickTime time.Duration,
 	tickerChan []<-chan time.Time,
+	opts []Option,
 ) *TimedMap {
 	tm := &TimedMap{
-		container:       container,
-		cleanerRunning:  new(uint32),
-		cleanerStopChan: make(chan bool),
+		container:        container,
+		cleanerRunning:   new(uint32),
+		closed:           new(uint32),
+		goroutines:       new(int32),
+		cleanupYields:    new(uint64),
+		droppedCallbacks: new(uint64),
+		ready:            make(chan struct{}),
+		done:             make(chan struct{}),
+		cleanerStopChan:  make(chan bool),
+		maxHold:          DefaultMaxHoldDuration,
+		maxCallbacks:     DefaultMaxCallbacks,
+		negativeBase:     DefaultNegativeBackoffBase,
+		negativeMax:      DefaultNegativeBackoffMax,
 		elementPool: &sync.Pool{
 			New: func() interface{} {
 				return new(element)
 			},
 		},
+		snapshotPool: &sync.Pool{
+			New: func() interface{} {
+				return make(map[interface{}]interface{})
+			},
+		},
+	}
+
+	tm.keys = make([]keyWrap, 0, len(container))
+	for k, v := range container {
+		v.idx = len(tm.keys)
+		tm.keys = append(tm.keys, k)
+	}
+	tm.peak = len(container)
+
+	tm.cleanupTickTime = cleanupTickTime
+	for _, opt := range opts {
+		opt(tm)
+	}
+	for k, v := range container {
+		tm.countSection(k.sec, 1)
+		tm.trackExpiry(v)
 	}
 
 	if len(tickerChan) > 0 {
 		tm.StartCleanerExternal(tickerChan[0])
-	} else if cleanupTickTime > 0 {
-		tm.StartCleanerInternal(cleanupTickTime)
+	} else if tm.cleanupTickTime > 0 && !tm.entryTimers {
+		tm.StartCleanerInternal(tm.cleanupTickTime)
+	}
+
+	if tm.maintenanceInterval > 0 {
+		tm.maintenanceStop = make(chan struct{})
+		ticker := time.NewTicker(tm.maintenanceInterval)
+		atomic.AddInt32(tm.goroutines, 1)
+		go func() {
+			defer ticker.Stop()
+			tm.maintenanceLoop(ticker.C, tm.maintenanceBudget)
+		}()
+	}
+
+	if tm.asyncQueue > 0 {
+		tm.expirations = make(chan expiration, tm.asyncQueue)
+		atomic.AddInt32(tm.goroutines, 1)
+		go tm.dispatchLoop()
+	}
+
+	if tm.scrubInterval > 0 {
+		tm.scrubStop = make(chan struct{})
+		ticker := time.NewTicker(tm.scrubInterval)
+		atomic.AddInt32(tm.goroutines, 1)
+		go func() {
+			defer ticker.Stop()
+			tm.scrubLoop(ticker.C, tm.scrubBudget)
+		}()
 	}
 
 	return tm
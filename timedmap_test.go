@@ -1,6 +1,9 @@
 package timedmap
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -82,6 +85,26 @@ func TestFromMap(t *testing.T) {
 	})
 }
 
+func TestFromMapFunc(t *testing.T) {
+	tm, err := FromMapFunc(
+		map[string]int{"a": 1, "b": 60},
+		func(key, value interface{}) time.Duration {
+			return time.Duration(value.(int)) * time.Minute
+		}, 0)
+	assert.Nil(t, err)
+
+	assert.EqualValues(t, 1, tm.GetValue("a"))
+	assert.EqualValues(t, 60, tm.GetValue("b"))
+	assert.Equal(t, []interface{}{"a", "b"}, tm.KeysByExpiry())
+
+	a, _ := tm.GetExpires("a")
+	b, _ := tm.GetExpires("b")
+	assert.Equal(t, 59*time.Minute, b.Sub(a))
+
+	_, err = FromMapFunc("this is not a map", nil, 0)
+	assert.ErrorIs(t, err, ErrValueNoMap)
+}
+
 func TestFlush(t *testing.T) {
 	tm := New(dCleanupTick)
 
@@ -98,160 +121,1640 @@ func TestIdent(t *testing.T) {
 	assert.EqualValues(t, 0, tm.Ident())
 }
 
-func TestSet(t *testing.T) {
-	const key = "tKeySet"
-	const val = "tValSet"
+func TestSet(t *testing.T) {
+	const key = "tKeySet"
+	const val = "tValSet"
+
+	tm := New(dCleanupTick)
+
+	tm.Set(key, val, 20*time.Millisecond)
+	if v := tm.get(key, 0); v == nil {
+		t.Fatal("key was not set")
+	} else if v.value.(string) != val {
+		t.Fatal("value was not like set")
+	}
+	assert.Equal(t, val, tm.get(key, 0).value)
+
+	time.Sleep(40 * time.Millisecond)
+	assert.Nil(t, tm.get(key, 0))
+}
+
+func TestSetReported(t *testing.T) {
+	tm := New(dCleanupTick)
+
+	old, replaced := tm.SetReported(1, "a", time.Hour)
+	assert.False(t, replaced)
+	assert.Nil(t, old)
+
+	old, replaced = tm.SetReported(1, "b", 0)
+	assert.True(t, replaced)
+	assert.EqualValues(t, "a", old)
+
+	time.Sleep(time.Millisecond)
+
+	old, replaced = tm.SetReported(1, "c", time.Hour)
+	assert.False(t, replaced)
+	assert.Nil(t, old)
+	assert.EqualValues(t, "c", tm.GetValue(1))
+}
+
+func TestSetAll(t *testing.T) {
+	tm := New(0)
+
+	var expired []interface{}
+	tm.SetAll([]KV{
+		{Key: 1, Value: "a", ExpiresAfter: time.Hour},
+		{Key: 2, Value: "b", ExpiresAfter: 0, Callback: func(v interface{}) {
+			expired = append(expired, v)
+		}},
+	})
+	tm.Section(1).SetAll([]KV{{Key: 1, Value: "c", ExpiresAfter: time.Minute}})
+	time.Sleep(time.Millisecond)
+
+	assert.EqualValues(t, "a", tm.GetValue(1))
+	assert.EqualValues(t, "c", tm.Section(1).GetValue(1))
+	ttl, _ := tm.Section(1).TTL(1)
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	tm.cleanUp()
+	assert.Equal(t, []interface{}{"b"}, expired)
+}
+
+func TestSwap(t *testing.T) {
+	tm := NewWithOptions(0, WithValueEqual(func(a, b interface{}) bool {
+		return a == b
+	}))
+
+	old, existed := tm.Swap(1, "a", time.Hour)
+	assert.False(t, existed)
+	assert.Nil(t, old)
+
+	old, existed = tm.Swap(1, "a", time.Hour)
+	assert.True(t, existed)
+	assert.EqualValues(t, "a", old)
+
+	old, existed = tm.Swap(1, "b", 0)
+	assert.True(t, existed)
+	assert.EqualValues(t, "a", old)
+
+	time.Sleep(time.Millisecond)
+	old, existed = tm.Section(0).Swap(1, "c", time.Hour)
+	assert.False(t, existed)
+	assert.Nil(t, old)
+	assert.EqualValues(t, "c", tm.GetValue(1))
+}
+
+func TestTTLJitter(t *testing.T) {
+	tm := NewWithOptions(0, WithTTLJitter(0.1))
+
+	now := time.Now()
+	expires := map[time.Time]bool{}
+	for i := 0; i < 100; i++ {
+		tm.Set(i, i, 10*time.Minute)
+		exp, err := tm.GetExpires(i)
+		assert.Nil(t, err)
+		assert.InDelta(t, 10*time.Minute, exp.Sub(now), float64(time.Minute+time.Second))
+		expires[exp] = true
+	}
+	assert.Greater(t, len(expires), 90)
+
+	tm.Set("forever", 1, NoExpiration)
+	d, err := tm.TTL("forever")
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpiration, d)
+
+	tm.Set(1, 2, KeepTTL)
+	assert.Equal(t, 2, tm.GetValue(1))
+}
+
+func TestTTLRules(t *testing.T) {
+	tm := NewWithOptions(0, WithTTLRules(func(key interface{}) time.Duration {
+		if k, ok := key.(string); ok && strings.HasPrefix(k, "token:") {
+			return time.Minute
+		}
+		return time.Hour
+	}))
+
+	tm.Set("token:a", 1, DefaultTTL)
+	tm.Set("profile:a", 1, DefaultTTL)
+	tm.Set("other", 1, time.Second)
+
+	ttl, _ := tm.TTL("token:a")
+	assert.Greater(t, ttl, 59*time.Second)
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	ttl, _ = tm.TTL("profile:a")
+	assert.Greater(t, ttl, time.Minute)
+
+	ttl, _ = tm.TTL("other")
+	assert.LessOrEqual(t, ttl, time.Second)
+
+	tm = New(0)
+	tm.Set(1, 1, DefaultTTL)
+	time.Sleep(time.Millisecond)
+	assert.False(t, tm.Contains(1))
+}
+
+func TestSetDefault(t *testing.T) {
+	tm := NewWithOptions(0, WithDefaultTTL(time.Hour))
+
+	tm.SetDefault(1, 1)
+	tm.Section(1).SetDefault(1, 2)
+	ttl, _ := tm.TTL(1)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	ttl, _ = tm.Section(1).TTL(1)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	tm = NewWithOptions(0,
+		WithDefaultTTL(time.Hour),
+		WithTTLRules(func(key interface{}) time.Duration {
+			if key == "short" {
+				return time.Minute
+			}
+			return DefaultTTL
+		}))
+
+	tm.SetDefault("short", 1)
+	tm.Set("long", 1, time.Second)
+	assert.Nil(t, tm.Touch("long"))
+
+	ttl, _ = tm.TTL("short")
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, _ = tm.TTL("long")
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+}
+
+func TestAdmissionHook(t *testing.T) {
+	tm := NewWithOptions(0, WithAdmissionHook(func(key, value interface{}, ttl time.Duration) (bool, time.Duration) {
+		if value == nil {
+			return false, 0
+		}
+		if ttl != KeepTTL && ttl > time.Minute {
+			return true, time.Minute
+		}
+		return true, ttl
+	}))
+
+	tm.Set(1, nil, time.Hour)
+	assert.False(t, tm.Contains(1))
+
+	tm.Set(1, 1, time.Hour)
+	ttl, err := tm.TTL(1)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	tm.Set(1, 2, KeepTTL)
+	assert.EqualValues(t, 2, tm.GetValue(1))
+
+	tm.SetAll([]KV{{Key: 2, Value: nil, ExpiresAfter: time.Hour}})
+	assert.False(t, tm.Contains(2))
+
+	tm.Section(1).Set(1, 1, 2*time.Minute)
+	ttl, err = tm.Section(1).TTL(1)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, ttl, time.Minute)
+}
+
+func TestSetValueEqual(t *testing.T) {
+	tm := NewWithOptions(0, WithValueEqual(func(a, b interface{}) bool {
+		return strings.EqualFold(a.(string), b.(string))
+	}))
+
+	tm.Set(1, "a", time.Minute)
+	assert.Nil(t, tm.SetSoftExpires(1, time.Hour))
+
+	old, replaced := tm.SetReported(1, "A", time.Hour)
+	assert.False(t, replaced)
+	assert.EqualValues(t, "a", old)
+	assert.EqualValues(t, "a", tm.GetValue(1))
+	ttl, _ := tm.TTL(1)
+	assert.Greater(t, ttl, time.Minute)
+	assert.False(t, tm.getRaw(1, 0).softExpires.IsZero())
+
+	old, replaced = tm.SetReported(1, "b", time.Hour)
+	assert.True(t, replaced)
+	assert.EqualValues(t, "a", old)
+	assert.EqualValues(t, "b", tm.GetValue(1))
+	assert.True(t, tm.getRaw(1, 0).softExpires.IsZero())
+}
+
+func TestSetMulti(t *testing.T) {
+	tm := New(0)
+
+	assert.ErrorIs(t, tm.SetMulti("this is not a map", time.Hour), ErrValueNoMap)
+
+	assert.Nil(t, tm.SetMulti(map[string]int{"a": 1, "b": 2}, time.Hour))
+	assert.Nil(t, tm.SetMulti(map[interface{}]interface{}{1: "c"}, time.Hour))
+	assert.Equal(t, map[interface{}]interface{}{"a": 1, "b": 2, 1: "c"}, tm.Snapshot())
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, "a", KeepTTL)
+	assert.False(t, tm.Contains(1))
+
+	tm.Set(1, "a", time.Hour)
+	exp, err := tm.GetExpires(1)
+	assert.Nil(t, err)
+
+	old, replaced := tm.SetReported(1, "b", KeepTTL)
+	assert.True(t, replaced)
+	assert.EqualValues(t, "a", old)
+	assert.EqualValues(t, "b", tm.GetValue(1))
+
+	newExp, err := tm.GetExpires(1)
+	assert.Nil(t, err)
+	assert.Equal(t, exp, newExp)
+
+	tm.Set(2, "a", 0)
+	time.Sleep(time.Millisecond)
+	_, replaced = tm.SetReported(2, "b", KeepTTL)
+	assert.False(t, replaced)
+	assert.False(t, tm.Contains(2))
+}
+
+func TestGetOrSet(t *testing.T) {
+	tm := New(dCleanupTick)
+
+	actual, loaded := tm.GetOrSet(1, "a", 20*time.Millisecond)
+	assert.False(t, loaded)
+	assert.EqualValues(t, "a", actual)
+
+	actual, loaded = tm.GetOrSet(1, "b", time.Hour)
+	assert.True(t, loaded)
+	assert.EqualValues(t, "a", actual)
+
+	time.Sleep(30 * time.Millisecond)
+
+	actual, loaded = tm.GetOrSet(1, "c", time.Hour)
+	assert.False(t, loaded)
+	assert.EqualValues(t, "c", actual)
+
+	var stored int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, loaded := tm.GetOrSet(2, i, time.Hour); !loaded {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, stored)
+}
+
+func TestSetIfNotExists(t *testing.T) {
+	tm := New(0)
+
+	assert.True(t, tm.SetIfNotExists(1, "a", time.Hour))
+	assert.False(t, tm.SetIfNotExists(1, "b", time.Hour))
+	assert.EqualValues(t, "a", tm.GetValue(1))
+
+	tm.Set(1, "a", 0)
+	time.Sleep(time.Millisecond)
+	assert.True(t, tm.SetIfNotExists(1, "c", time.Hour))
+	assert.False(t, tm.SetIfNotExists(1, "d", time.Hour))
+	assert.EqualValues(t, "c", tm.GetValue(1))
+}
+
+func TestUpsert(t *testing.T) {
+	tm := New(0)
+
+	insert := func() (interface{}, time.Duration) { return 1, time.Hour }
+	update := func(old interface{}) (interface{}, time.Duration) { return old.(int) + 1, KeepTTL }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm.Upsert(1, insert, update)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 100, tm.GetValue(1))
+	ttl, _ := tm.TTL(1)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	tm.Section(1).Upsert(1, insert, update)
+	assert.EqualValues(t, 1, tm.Section(1).GetValue(1))
+}
+
+func TestUpdate(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
+
+	tm := New(0)
+
+	inc := func(old interface{}, exists bool) (interface{}, time.Duration) {
+		if !exists {
+			return 1, time.Hour
+		}
+		return old.(int) + 1, time.Hour
+	}
+
+	tm.Update(1, inc)
+	assert.EqualValues(t, 1, tm.GetValue(1))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm.Update(1, inc)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 101, tm.GetValue(1))
+
+	// Callbacks are kept
+	tm.Set(2, 1, time.Hour, cb.Cb)
+	tm.Update(2, func(old interface{}, exists bool) (interface{}, time.Duration) {
+		assert.True(t, exists)
+		return 2, 0
+	})
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	cb.AssertCalled(t, "Cb")
+	assert.EqualValues(t, 2, cb.TestData().Get("v").Int())
+}
+
+func TestUpdateErrors(t *testing.T) {
+	tm := NewWithOptions(0,
+		WithSectionQuota(1),
+		WithAdmissionHook(func(key, value interface{}, ttl time.Duration) (bool, time.Duration) {
+			return value != "rejected", ttl
+		}))
+
+	keep := func(old interface{}, exists bool) (interface{}, time.Duration) {
+		return 1, KeepTTL
+	}
+	assert.ErrorIs(t, tm.Update(1, keep), ErrKeyNotFound)
+
+	set := func(val interface{}) UpdateFunc {
+		return func(old interface{}, exists bool) (interface{}, time.Duration) {
+			return val, time.Hour
+		}
+	}
+	assert.ErrorIs(t, tm.Update(1, set("rejected")), ErrRejected)
+	assert.Nil(t, tm.Update(1, set(1)))
+	assert.ErrorIs(t, tm.Update(2, set(2)), ErrQuotaExceeded)
+	assert.Nil(t, tm.Update(1, keep))
+	assert.Nil(t, tm.Section(1).Update(2, set(2)))
+	assert.False(t, tm.Contains(2))
+
+	assert.ErrorIs(t, tm.Upsert(3,
+		func() (interface{}, time.Duration) { return 3, time.Hour },
+		func(old interface{}) (interface{}, time.Duration) { return old, time.Hour },
+	), ErrQuotaExceeded)
+
+	s := tm.Section(2)
+	tm.DeleteSection(2)
+	assert.ErrorIs(t, s.Update(1, set(1)), ErrSectionDeleted)
+
+	tm.Close()
+	assert.ErrorIs(t, tm.Update(1, set(1)), ErrClosed)
+	assert.ErrorIs(t, tm.Section(1).Update(1, set(1)), ErrClosed)
+}
+
+func TestGetValue(t *testing.T) {
+	const key = "tKeyGetVal"
+	const val = "tValGetVal"
+
+	tm := New(dCleanupTick)
+
+	tm.Set(key, val, 50*time.Millisecond)
+	assert.Nil(t, tm.GetValue("keyNotExists"))
+
+	assert.Equal(t, val, tm.GetValue(key))
+
+	time.Sleep(60 * time.Millisecond)
+
+	assert.Nil(t, tm.GetValue(key))
+
+	tm.Set(key, val, 1*time.Microsecond)
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, tm.GetValue(key))
+}
+
+func TestTryGetValue(t *testing.T) {
+	tm := New(0)
+
+	_, ok := tm.TryGetValue("keyNotExists")
+	assert.False(t, ok)
+
+	tm.Set(1, nil, time.Hour)
+	v, ok := tm.TryGetValue(1)
+	assert.True(t, ok)
+	assert.Nil(t, v)
+
+	tm.Set(2, 0, 0)
+	time.Sleep(time.Millisecond)
+	_, ok = tm.TryGetValue(2)
+	assert.False(t, ok)
+}
+
+func TestGetValueE(t *testing.T) {
+	tm := New(0)
+
+	_, err := tm.GetValueE("keyNotExists")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(1, nil, time.Hour)
+	v, err := tm.GetValueE(1)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	tm.Set(2, 0, 0)
+	time.Sleep(time.Millisecond)
+	_, err = tm.GetValueE(2)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Section(1).Set(1, 1, time.Hour)
+	v, err = tm.Section(1).GetValueE(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+
+	tm.Close()
+	_, err = tm.GetValueE(1)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestGetValueDefault(t *testing.T) {
+	tm := New(0)
+
+	assert.EqualValues(t, "def", tm.GetValueDefault("keyNotExists", "def"))
+
+	tm.Set(1, nil, time.Hour)
+	assert.Nil(t, tm.GetValueDefault(1, "def"))
+
+	tm.Set(2, 0, 0)
+	time.Sleep(time.Millisecond)
+	assert.EqualValues(t, "def", tm.GetValueDefault(2, "def"))
+}
+
+func TestGetExpire(t *testing.T) {
+	const key = "tKeyGetExp"
+	const val = "tValGetExp"
+
+	tm := New(dCleanupTick)
+
+	tm.Set(key, val, 50*time.Millisecond)
+	ct := time.Now().Add(50 * time.Millisecond)
+
+	_, err := tm.GetExpires("keyNotExists")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	exp, err := tm.GetExpires(key)
+	assert.Nil(t, err)
+	assert.Less(t, ct.Sub(exp), 1*time.Millisecond)
+}
+
+func TestSetExpireAt(t *testing.T) {
+	tm := New(0)
+	at := time.Now().Add(time.Hour).Round(time.Second)
+
+	tm.SetExpireAt(1, 1, at)
+	exp, err := tm.GetExpires(1)
+	assert.Nil(t, err)
+	assert.True(t, at.Equal(exp))
+
+	tm.SetExpireAt(2, 2, time.Now().Add(-time.Second))
+	assert.False(t, tm.Contains(2))
+
+	at = at.Add(time.Hour)
+	assert.Nil(t, tm.ExpiresAt(1, at))
+	exp, err = tm.GetExpires(1)
+	assert.Nil(t, err)
+	assert.True(t, at.Equal(exp))
+
+	assert.ErrorIs(t, tm.ExpiresAt(3, at), ErrKeyNotFound)
+
+	s := tm.Section(1)
+	s.SetExpireAt(1, 1, at)
+	assert.Nil(t, s.ExpiresAt(1, at.Add(time.Hour)))
+	exp, err = s.GetExpires(1)
+	assert.Nil(t, err)
+	assert.True(t, at.Add(time.Hour).Equal(exp))
+}
+
+func TestGetEntry(t *testing.T) {
+	tm := New(0)
+
+	start := time.Now()
+	tm.Set(1, 1, time.Hour)
+	created := tm.getRaw(1, 0).created
+	assert.False(t, created.Before(start))
+
+	tm.Set(1, 2, 2*time.Hour)
+	e, err := tm.GetEntry(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, e.Key)
+	assert.EqualValues(t, 2, e.Value)
+	assert.EqualValues(t, 0, e.Section)
+	assert.True(t, created.Equal(e.Created))
+	exp, _ := tm.GetExpires(1)
+	assert.True(t, exp.Equal(e.Expires))
+
+	_, err = tm.GetEntry(2)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	s := tm.WithKeyPrefix("foo:")
+	s.Set("bar", 3, time.Hour)
+	e, err = s.GetEntry("bar")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "bar", e.Key)
+
+	tm.Section(2).Set(1, 4, time.Hour)
+	e, err = tm.Section(2).GetEntry(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, e.Section)
+}
+
+func TestSnapshotInto(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, "a", time.Hour)
+	tm.Section(1).Set(1, "c", time.Hour)
+
+	m := map[interface{}]interface{}{3: "x"}
+	tm.SnapshotInto(m)
+	assert.Equal(t, map[interface{}]interface{}{1: "a"}, m)
+
+	tm.Section(1).SnapshotInto(m)
+	assert.Equal(t, map[interface{}]interface{}{1: "c"}, m)
+}
+
+func TestSnapshotEntries(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, "a", time.Hour)
+	tm.Set(2, "b", 0)
+	tm.Section(1).Set(1, "c", time.Minute)
+	time.Sleep(time.Millisecond)
+
+	m := tm.SnapshotEntries()
+	assert.Len(t, m, 1)
+	assert.EqualValues(t, "a", m[1].Value)
+	exp, _ := tm.GetExpires(1)
+	assert.True(t, exp.Equal(m[1].Expires))
+	assert.False(t, m[1].Created.IsZero())
+
+	m = tm.Section(1).SnapshotEntries()
+	assert.Len(t, m, 1)
+	assert.EqualValues(t, "c", m[1].Value)
+	assert.EqualValues(t, 1, m[1].Section)
+}
+
+func TestSetBy(t *testing.T) {
+	var expired []Entry
+	tm := NewWithOptions(0,
+		WithProvenance(),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e) }))
+
+	tm.SetBy("importer", 1, "a", time.Hour)
+	tm.SetContext(WithCaller(context.Background(), "sessions"), 2, "b", time.Hour)
+	tm.Section(1).SetBy("importer", 1, "c", time.Hour)
+	tm.Set(3, "d", time.Hour)
+
+	m := tm.SnapshotEntries()
+	assert.Equal(t, "importer", m[1].Caller)
+	assert.Equal(t, "sessions", m[2].Caller)
+	assert.Empty(t, m[3].Caller)
+	assert.Equal(t, "importer", tm.Section(1).SnapshotEntries()[1].Caller)
+
+	tm.Set(1, "e", time.Hour)
+	assert.Empty(t, tm.SnapshotEntries()[1].Caller)
+
+	assert.Nil(t, tm.SetExpires(2, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "sessions", expired[0].Caller)
+
+	tm = New(0)
+	tm.SetBy("importer", 1, "a", time.Hour)
+	assert.EqualValues(t, "a", tm.GetValue(1))
+	assert.Empty(t, tm.SnapshotEntries()[1].Caller)
+}
+
+func TestTTL(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, 0)
+	time.Sleep(time.Millisecond)
+
+	d, err := tm.TTL(1)
+	assert.Nil(t, err)
+	assert.Greater(t, d, 59*time.Minute)
+	assert.LessOrEqual(t, d, time.Hour)
+
+	_, err = tm.TTL(2)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Section(1).Set(1, 1, time.Minute)
+	d, err = tm.Section(1).TTL(1)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, d, time.Minute)
+}
+
+func TestNoExpiration(t *testing.T) {
+	tm := NewWithOptions(0, WithSlidingExpiration())
+
+	tm.Set(1, 1, NoExpiration)
+	tm.Set(2, 2, time.Hour)
+	tm.Section(1).Set("c", 3, NoExpiration)
+
+	d, err := tm.TTL(1)
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpiration, d)
+	assert.Equal(t, 1, tm.GetValue(1))
+
+	assert.Nil(t, tm.Refresh(1, time.Hour))
+	d, _ = tm.TTL(1)
+	assert.Equal(t, NoExpiration, d)
+
+	assert.Nil(t, tm.SetExpires(2, NoExpiration))
+	d, _ = tm.TTL(2)
+	assert.Equal(t, NoExpiration, d)
+
+	var buf bytes.Buffer
+	assert.Nil(t, tm.WriteSnapshot(&buf))
+	restored := New(0)
+	assert.Nil(t, restored.ReadSnapshot(&buf))
+	d, _ = restored.Section(1).TTL("c")
+	assert.Equal(t, NoExpiration, d)
+
+	assert.Nil(t, tm.SetExpires(1, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.False(t, tm.Contains(1))
+	assert.True(t, tm.Contains(2))
+	assert.True(t, tm.Section(1).Contains("c"))
+}
+
+func TestSetExpires(t *testing.T) {
+	const key = "tKeyRef"
+
+	tm := New(dCleanupTick)
+
+	err := tm.Refresh("keyNotExists", time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	err = tm.SetExpires("notExistentKey", 1*time.Second)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(key, 1, 12*time.Millisecond)
+	err = tm.SetExpires(key, 50*time.Millisecond)
+	assert.Nil(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.NotNil(t, tm.get(key, 0))
+
+	time.Sleep(52 * time.Millisecond)
+	assert.Nil(t, tm.get(key, 0))
+}
+
+func TestRefreshPolicy(t *testing.T) {
+	t.Run("reject-expired", func(t *testing.T) {
+		tm := NewWithOptions(0)
+
+		tm.Set(1, 1, 0)
+		tm.Set(2, 2, 0)
+		time.Sleep(time.Millisecond)
+
+		assert.ErrorIs(t, tm.Refresh(1, time.Hour), ErrKeyNotFound)
+		assert.ErrorIs(t, tm.SetExpires(2, time.Hour), ErrKeyNotFound)
+		assert.Nil(t, tm.getRaw(1, 0))
+		assert.Nil(t, tm.getRaw(2, 0))
+	})
+
+	t.Run("resurrect", func(t *testing.T) {
+		tm := NewWithOptions(0, WithRefreshPolicy(RefreshResurrect))
+
+		tm.Set(1, 1, 0)
+		tm.Set(2, 2, 0)
+		time.Sleep(time.Millisecond)
+
+		assert.Nil(t, tm.Refresh(1, time.Hour))
+		assert.Nil(t, tm.SetExpires(2, time.Hour))
+		assert.EqualValues(t, 1, tm.GetValue(1))
+		assert.EqualValues(t, 2, tm.GetValue(2))
+
+		tm.Remove(1)
+		assert.ErrorIs(t, tm.Refresh(1, time.Hour), ErrKeyNotFound)
+	})
+}
+
+func TestHold(t *testing.T) {
+	tm := New(dCleanupTick)
+
+	_, err := tm.Hold("keyNotExists")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(1, 1, 20*time.Millisecond)
+	release, err := tm.Hold(1)
+	assert.Nil(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, tm.GetValue(1))
+
+	release()
+	release()
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, tm.Contains(1))
+
+	t.Run("max-hold", func(t *testing.T) {
+		tm := NewWithOptions(dCleanupTick, WithMaxHoldDuration(30*time.Millisecond))
+
+		tm.Set(1, 1, 10*time.Millisecond)
+		release, err := tm.Hold(1)
+		assert.Nil(t, err)
+		defer release()
+
+		time.Sleep(20 * time.Millisecond)
+		assert.True(t, tm.Contains(1))
+
+		time.Sleep(30 * time.Millisecond)
+		assert.False(t, tm.Contains(1))
+	})
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	tm := NewWithOptions(0, WithKeyNormalizer(func(key interface{}) interface{} {
+		if s, ok := key.(string); ok {
+			return strings.ToLower(strings.TrimSpace(s))
+		}
+		return key
+	}))
+
+	tm.Set(" Foo", 1, time.Hour)
+	assert.EqualValues(t, 1, tm.GetValue("foo"))
+	assert.EqualValues(t, 1, tm.GetValue("FOO "))
+	assert.True(t, tm.Contains("fOo"))
+	assert.Equal(t, map[interface{}]interface{}{"foo": 1}, tm.Snapshot())
+
+	p := tm.WithKeyPrefix("p:")
+	p.Set("BAR", 2, time.Hour)
+	assert.EqualValues(t, 2, tm.GetValue("p:bar"))
+	assert.EqualValues(t, 2, p.GetValue("Bar"))
+
+	s := tm.Section(1)
+	s.Set("Bazz", 3, time.Hour)
+	assert.EqualValues(t, 3, s.GetValue("bazz"))
+
+	tm.Remove("FOO")
+	assert.False(t, tm.Contains("foo"))
+}
+
+func TestContains(t *testing.T) {
+	const key = "tKeyCont"
+
+	tm := New(dCleanupTick)
+
+	tm.Set(key, 1, 30*time.Millisecond)
+
+	assert.False(t, tm.Contains("keyNotExists"))
+	assert.True(t, tm.Contains(key))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, tm.Contains(key))
+}
+
+func TestContainsReadOnly(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, 1, 0)
+	time.Sleep(time.Millisecond)
+
+	assert.False(t, tm.Contains(1))
+	assert.NotNil(t, tm.getRaw(1, 0))
+
+	tm.Set(2, 2, 10*time.Millisecond)
+	_, err := tm.Hold(2)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, tm.Contains(2))
+}
+
+func TestRemove(t *testing.T) {
+	const key = "tKeyRem"
+
+	tm := New(dCleanupTick)
+
+	tm.Set(key, 1, time.Hour)
+	tm.Remove(key)
+
+	assert.Nil(t, tm.get(key, 0))
+}
+
+func TestRemoveMulti(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 5; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+
+	assert.EqualValues(t, 3, tm.RemoveMulti(0, 1, 2, 10))
+	assert.EqualValues(t, 0, tm.RemoveMulti(0))
+	assert.EqualValues(t, 0, tm.RemoveMulti())
+	assert.Equal(t, map[interface{}]interface{}{3: 3, 4: 4}, tm.Snapshot())
+}
+
+func TestExpire(t *testing.T) {
+	tm := New(0)
+
+	var expired []interface{}
+	cb := func(v interface{}) { expired = append(expired, v) }
+	tm.Set(1, "a", time.Hour, cb)
+	tm.Section(1).Set(1, "b", time.Hour, cb)
+
+	_, err := tm.Hold(1)
+	assert.Nil(t, err)
+
+	assert.Nil(t, tm.Expire(1))
+	assert.False(t, tm.Contains(1))
+	assert.ErrorIs(t, tm.Expire(1), ErrKeyNotFound)
+
+	assert.Nil(t, tm.Section(1).Expire(1))
+	assert.Equal(t, []interface{}{"a", "b"}, expired)
+}
+
+func TestRename(t *testing.T) {
+	tm := New(0)
+
+	var expired interface{}
+	tm.Set(1, "a", time.Hour, func(v interface{}) { expired = v })
+	tm.Set(2, "b", time.Hour)
+	exp, _ := tm.GetExpires(1)
+
+	assert.ErrorIs(t, tm.Rename(3, 4), ErrKeyNotFound)
+	assert.ErrorIs(t, tm.Rename(1, 2), ErrKeyExists)
+
+	assert.Nil(t, tm.Rename(1, 3))
+	assert.False(t, tm.Contains(1))
+	assert.EqualValues(t, "a", tm.GetValue(3))
+	nexp, _ := tm.GetExpires(3)
+	assert.True(t, exp.Equal(nexp))
+	assert.ElementsMatch(t, []interface{}{2, 3}, tm.SampleKeys(10))
+
+	assert.Nil(t, tm.SetExpires(3, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.EqualValues(t, "a", expired)
+
+	s := tm.Section(1)
+	s.Set(1, "c", time.Hour)
+	assert.Nil(t, s.Rename(1, 2))
+	assert.EqualValues(t, "c", s.GetValue(2))
+	assert.EqualValues(t, "b", tm.GetValue(2))
+}
+
+func TestRenameReplace(t *testing.T) {
+	tm := NewWithOptions(0, WithReplaceOnRename())
+
+	var called int
+	cb := func(interface{}) { called++ }
+	tm.Set(1, "a", time.Hour, cb)
+	tm.Set(2, "b", time.Hour, cb)
+
+	assert.Nil(t, tm.Rename(1, 1))
+	assert.EqualValues(t, "a", tm.GetValue(1))
+
+	assert.Nil(t, tm.Rename(1, 2))
+	assert.False(t, tm.Contains(1))
+	assert.EqualValues(t, "a", tm.GetValue(2))
+	assert.Equal(t, 1, tm.Size())
+	assert.Equal(t, []interface{}{2}, tm.SampleKeys(10))
+	assert.Zero(t, called)
+
+	assert.Nil(t, tm.Expire(2))
+	assert.Equal(t, 1, called)
+}
+
+func TestRenameOntoGraceKey(t *testing.T) {
+	var expired []interface{}
+	tm := NewWithOptions(0,
+		WithGracePeriod(time.Hour),
+		WithCleanupYield(1),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }))
+
+	tm.Set(1, "a", time.Hour)
+	tm.Set(2, "b", 0)
+	tm.Set(3, "c", 0)
+	tm.Set(4, "d", 0)
+	time.Sleep(time.Millisecond)
+
+	assert.Nil(t, tm.Rename(1, 2))
+	assert.Equal(t, []interface{}{2}, expired)
+	assert.EqualValues(t, "a", tm.GetValue(2))
+	assert.Equal(t, 3, tm.Size())
+	assert.Len(t, tm.keys, 3)
+
+	old, existed := tm.Swap(3, "e", time.Hour)
+	assert.Nil(t, old)
+	assert.False(t, existed)
+	actual, loaded := tm.GetOrSet(4, "f", time.Hour)
+	assert.EqualValues(t, "f", actual)
+	assert.False(t, loaded)
+
+	assert.NotPanics(t, func() { tm.CleanUpNow() })
+	assert.Equal(t, 3, tm.Size())
+	assert.ElementsMatch(t, []interface{}{2, 3, 4}, tm.SampleKeys(10))
+}
+
+func TestRemoveWhere(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	tm.Set(10, 10, 0)
+	time.Sleep(time.Millisecond)
+
+	n := tm.RemoveWhere(func(key, value interface{}) bool {
+		return value.(int)%2 == 0
+	})
+	assert.EqualValues(t, 5, n)
+	assert.EqualValues(t, 6, tm.Size())
+	assert.Len(t, tm.keys, 6)
+	for _, v := range tm.Values() {
+		assert.EqualValues(t, 1, v.(int)%2)
+	}
+}
+
+func TestPop(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
+
+	tm := New(0)
+
+	_, ok := tm.Pop("keyNotExists")
+	assert.False(t, ok)
+
+	tm.Set(1, 3, time.Hour, cb.Cb)
+	v, ok := tm.Pop(1)
+	assert.True(t, ok)
+	assert.EqualValues(t, 3, v)
+	assert.Nil(t, tm.getRaw(1, 0))
+	cb.AssertNotCalled(t, "Cb")
+
+	_, ok = tm.Pop(1)
+	assert.False(t, ok)
+}
+
+func TestRefresh(t *testing.T) {
+	const key = "tKeyRef"
+
+	tm := New(dCleanupTick)
+
+	err := tm.Refresh("keyNotExists", time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(key, 1, 12*time.Millisecond)
+	assert.Nil(t, tm.Refresh(key, 50*time.Millisecond))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.NotNil(t, tm.get(key, 0))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, tm.get(key, 0))
+}
+
+func TestGetAndRefresh(t *testing.T) {
+	tm := New(0)
+
+	_, err := tm.GetAndRefresh(1, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(1, 1, time.Minute)
+	before, _ := tm.GetExpires(1)
+
+	v, err := tm.GetAndRefresh(1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+
+	after, _ := tm.GetExpires(1)
+	assert.Equal(t, time.Hour, after.Sub(before))
+
+	tm.Set(2, 2, 0)
+	time.Sleep(time.Millisecond)
+	_, err = tm.GetAndRefresh(2, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Section(1).Set(1, 3, time.Minute)
+	v, err = tm.Section(1).GetAndRefresh(1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, v)
+
+	tm.Close()
+	_, err = tm.GetAndRefresh(1, time.Hour)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestTouch(t *testing.T) {
+	tm := NewWithOptions(0, WithTTLRules(func(key interface{}) time.Duration {
+		return time.Duration(key.(int)) * time.Hour
+	}))
+
+	assert.ErrorIs(t, tm.Touch(1), ErrKeyNotFound)
+
+	tm.Set(1, 1, time.Second)
+	assert.Nil(t, tm.Touch(1))
+	ttl, _ := tm.TTL(1)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	tm.Section(1).Set(2, 2, time.Second)
+	assert.Nil(t, tm.Section(1).Touch(2))
+	ttl, _ = tm.Section(1).TTL(2)
+	assert.InDelta(t, 2*time.Hour, ttl, float64(time.Second))
+}
+
+func TestSetExpiresPrev(t *testing.T) {
+	tm := New(0)
+
+	_, err := tm.SetExpiresPrev(1, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = tm.RefreshPrev(1, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	tm.Set(1, 1, time.Minute)
+	exp, _ := tm.GetExpires(1)
+
+	prev, err := tm.SetExpiresPrev(1, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, exp.Equal(prev))
+
+	exp, _ = tm.GetExpires(1)
+	prev, err = tm.RefreshPrev(1, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, exp.Equal(prev))
+	nexp, _ := tm.GetExpires(1)
+	assert.Equal(t, time.Hour, nexp.Sub(prev))
+
+	tm.Section(1).Set(1, 1, time.Minute)
+	exp, _ = tm.Section(1).GetExpires(1)
+	prev, err = tm.Section(1).RefreshPrev(1, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, exp.Equal(prev))
+	prev, err = tm.Section(1).SetExpiresPrev(1, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, exp.Add(time.Hour).Equal(prev))
+}
+
+func TestSize(t *testing.T) {
+	tm := New(dCleanupTick)
+
+	for i := 0; i < 25; i++ {
+		tm.Set(i, 1, 50*time.Millisecond)
+	}
+	assert.EqualValues(t, 25, tm.Size())
+}
+
+func TestSizeLive(t *testing.T) {
+	tm := New(0)
+
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, 0)
+	tm.Section(1).Set(3, 3, time.Hour)
+	tm.Section(1).Set(4, 4, 0)
+	time.Sleep(time.Millisecond)
+
+	assert.Equal(t, 4, tm.Size())
+	assert.Equal(t, 2, tm.SizeLive())
+	assert.Equal(t, 1, tm.Section(1).SizeLive())
+	assert.Equal(t, 0, tm.Section(2).SizeLive())
+
+	tm.Close()
+	assert.Equal(t, 0, tm.SizeLive())
+}
+
+func TestCallback(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
+
+	tm := New(dCleanupTick)
+
+	tm.Set(1, 3, 25*time.Millisecond, cb.Cb)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, tm.get(1, 0))
+	cb.AssertCalled(t, "Cb")
+	assert.EqualValues(t, 3, cb.TestData().Get("v").Int())
+}
+
+func TestAddCallback(t *testing.T) {
+	tm := NewWithOptions(0, WithMaxCallbacks(3))
+
+	var calls []int
+	cbs := make([]callback, 1, 2)
+	cbs[0] = func(interface{}) { calls = append(calls, 1) }
+	tm.Set(1, 1, time.Hour, cbs...)
+
+	assert.ErrorIs(t, tm.AddCallback(2), ErrKeyNotFound)
+	assert.Nil(t, tm.AddCallback(1, func(interface{}) { calls = append(calls, 2) }))
+	assert.Nil(t, cbs[:2][1])
+
+	n, err := tm.CallbackCount(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, n)
+
+	noop := func(interface{}) {}
+	assert.ErrorIs(t, tm.AddCallback(1, noop, noop), ErrTooManyCallbacks)
+	assert.Nil(t, tm.AddCallback(1, noop))
+	assert.ErrorIs(t, tm.Section(0).AddCallback(1, noop), ErrTooManyCallbacks)
+
+	assert.Nil(t, tm.SetExpires(1, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, []int{1, 2}, calls)
+
+	tm.Section(1).Set(1, 1, time.Hour)
+	assert.Nil(t, tm.Section(1).AddCallback(1, noop))
+	n, err = tm.Section(1).CallbackCount(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, n)
+}
+
+func TestClearCallbacks(t *testing.T) {
+	tm := New(0)
+
+	var called bool
+	cb := func(interface{}) { called = true }
+	tm.Set(1, 1, time.Hour, cb)
+	assert.Nil(t, tm.AddCallback(1, cb))
+
+	assert.ErrorIs(t, tm.ClearCallbacks(2), ErrKeyNotFound)
+	assert.Nil(t, tm.ClearCallbacks(1))
+	n, err := tm.CallbackCount(1)
+	assert.Nil(t, err)
+	assert.Zero(t, n)
+
+	assert.Nil(t, tm.AddCallback(1, cb))
+	assert.Nil(t, tm.Section(0).ClearCallbacks(1))
+	assert.Nil(t, tm.Expire(1))
+	assert.False(t, called)
+
+	tm.Section(1).Set(1, 1, time.Hour, cb)
+	assert.Nil(t, tm.Section(1).ClearCallbacks(1))
+	n, _ = tm.Section(1).CallbackCount(1)
+	assert.Zero(t, n)
+}
+
+func TestAddCallbackOverwrite(t *testing.T) {
+	tm := New(0)
+
+	var calls []int
+	tm.Set(1, 1, time.Hour, func(interface{}) { calls = append(calls, 1) })
+	assert.Nil(t, tm.AddCallback(1, func(interface{}) { calls = append(calls, 2) }))
+
+	tm.Set(1, 2, time.Hour, func(interface{}) { calls = append(calls, 3) })
+	n, _ := tm.CallbackCount(1)
+	assert.EqualValues(t, 2, n)
+
+	assert.Nil(t, tm.SetExpires(1, 0))
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, []int{3, 2}, calls)
+
+	tm.Set(1, 3, time.Hour)
+	n, _ = tm.CallbackCount(1)
+	assert.EqualValues(t, 0, n)
+
+	assert.Nil(t, tm.AddCallback(1, func(interface{}) { calls = append(calls, 4) }))
+	tm.Remove(1)
+	tm.Set(1, 4, 0)
+	time.Sleep(time.Millisecond)
+	tm.cleanUp()
+	assert.Equal(t, []int{3, 2}, calls)
+}
+
+func TestSetWarning(t *testing.T) {
+	tm := New(0)
 
-	tm := New(dCleanupTick)
+	assert.ErrorIs(t, tm.SetWarning("keyNotExists", time.Second), ErrKeyNotFound)
 
-	tm.Set(key, val, 20*time.Millisecond)
-	if v := tm.get(key, 0); v == nil {
-		t.Fatal("key was not set")
-	} else if v.value.(string) != val {
-		t.Fatal("value was not like set")
+	var warned int32
+	cb := func(v interface{}) {
+		atomic.AddInt32(&warned, 1)
+		assert.EqualValues(t, 3, v)
 	}
-	assert.Equal(t, val, tm.get(key, 0).value)
 
-	time.Sleep(40 * time.Millisecond)
-	assert.Nil(t, tm.get(key, 0))
+	tm.Set(1, 3, time.Hour)
+	assert.Nil(t, tm.SetWarning(1, time.Minute, cb))
+
+	tm.cleanUp()
+	assert.EqualValues(t, 0, atomic.LoadInt32(&warned))
+
+	assert.Nil(t, tm.SetWarning(1, 2*time.Hour, cb))
+	tm.cleanUp()
+	tm.cleanUp()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&warned))
+	assert.True(t, tm.Contains(1))
+
+	// Refreshing re-arms the warning
+	assert.Nil(t, tm.SetExpires(1, time.Hour))
+	tm.cleanUp()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&warned))
+
+	// Overwriting the value removes the warning
+	tm.Set(1, 4, time.Hour)
+	tm.cleanUp()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&warned))
 }
 
-func TestGetValue(t *testing.T) {
-	const key = "tKeyGetVal"
-	const val = "tValGetVal"
+func TestSetSoftExpires(t *testing.T) {
+	cb := new(CB)
+	cb.On("Cb").Return()
 
-	tm := New(dCleanupTick)
+	tm := New(0)
 
-	tm.Set(key, val, 50*time.Millisecond)
-	assert.Nil(t, tm.GetValue("keyNotExists"))
+	assert.ErrorIs(t, tm.SetSoftExpires("keyNotExists", time.Second), ErrKeyNotFound)
+	_, err := tm.IsStale("keyNotExists")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
 
-	assert.Equal(t, val, tm.GetValue(key))
+	tm.Set(1, 3, time.Hour)
+	stale, err := tm.IsStale(1)
+	assert.Nil(t, err)
+	assert.False(t, stale)
+
+	assert.Nil(t, tm.SetSoftExpires(1, time.Hour, cb.Cb))
+	tm.cleanUp()
+	stale, _ = tm.IsStale(1)
+	assert.False(t, stale)
+	cb.AssertNotCalled(t, "Cb")
+
+	assert.Nil(t, tm.SetSoftExpires(1, 0, cb.Cb))
+	time.Sleep(time.Millisecond)
+	stale, _ = tm.IsStale(1)
+	assert.True(t, stale)
+
+	tm.cleanUp()
+	tm.cleanUp()
+	cb.AssertNumberOfCalls(t, "Cb", 1)
+	assert.EqualValues(t, 3, cb.TestData().Get("v").Int())
+	assert.True(t, tm.Contains(1))
 
-	time.Sleep(60 * time.Millisecond)
+	// Setting a new value removes the soft expiration
+	tm.Set(1, 4, time.Hour)
+	stale, _ = tm.IsStale(1)
+	assert.False(t, stale)
+}
 
-	assert.Nil(t, tm.GetValue(key))
+func TestStopCleaner(t *testing.T) {
+	tm := New(dCleanupTick)
 
-	tm.Set(key, val, 1*time.Microsecond)
-	time.Sleep(2 * time.Millisecond)
-	assert.Nil(t, tm.GetValue(key))
+	time.Sleep(10 * time.Millisecond)
+	tm.StopCleaner()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+
+	assert.NotPanics(t, func() {
+		tm.StopCleaner()
+	})
 }
 
-func TestGetExpire(t *testing.T) {
-	const key = "tKeyGetExp"
-	const val = "tValGetExp"
+func TestReady(t *testing.T) {
+	tm := New(0)
+	assert.False(t, tm.IsReady())
 
-	tm := New(dCleanupTick)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, tm.WaitReady(ctx), context.Canceled)
 
-	tm.Set(key, val, 50*time.Millisecond)
-	ct := time.Now().Add(50 * time.Millisecond)
+	errC := make(chan error)
+	go func() {
+		errC <- tm.WaitReady(context.Background())
+	}()
 
-	_, err := tm.GetExpires("keyNotExists")
-	assert.ErrorIs(t, err, ErrKeyNotFound)
+	time.Sleep(10 * time.Millisecond)
+	tm.SetReady()
+	assert.NotPanics(t, tm.SetReady)
 
-	exp, err := tm.GetExpires(key)
-	assert.Nil(t, err)
-	assert.Less(t, ct.Sub(exp), 1*time.Millisecond)
+	assert.Nil(t, <-errC)
+	assert.True(t, tm.IsReady())
+	assert.Nil(t, tm.WaitReady(ctx))
 }
 
-func TestSetExpires(t *testing.T) {
-	const key = "tKeyRef"
-
+func TestClose(t *testing.T) {
 	tm := New(dCleanupTick)
+	tm.Set(1, 1, time.Hour)
 
-	err := tm.Refresh("keyNotExists", time.Hour)
-	assert.ErrorIs(t, err, ErrKeyNotFound)
+	time.Sleep(10 * time.Millisecond)
+	tm.Close()
+	time.Sleep(10 * time.Millisecond)
 
-	err = tm.SetExpires("notExistentKey", 1*time.Second)
-	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.EqualValues(t, 0, tm.Size())
+	assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+	assert.NotPanics(t, tm.Close)
+}
 
-	tm.Set(key, 1, 12*time.Millisecond)
-	err = tm.SetExpires(key, 50*time.Millisecond)
-	assert.Nil(t, err)
+func TestReconfigure(t *testing.T) {
+	tm := New(0)
+	defer tm.Close()
+
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, time.Hour)
+
+	var expired []interface{}
+	tm.Reconfigure(
+		WithCleanupInterval(time.Millisecond),
+		WithExpireHandler(func(e Entry) { expired = append(expired, e.Key) }),
+		WithKeyNormalizer(func(key interface{}) interface{} { return 0 }),
+	)
+	assert.Equal(t, 2, tm.Size())
+	assert.Nil(t, tm.normalizeKey)
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Tickers == 1
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, tm.SetExpires(1, 0))
+	assert.Eventually(t, func() bool {
+		return tm.SizeLive() == 1 && tm.Size() == 1
+	}, time.Second, time.Millisecond)
+
+	tm.Reconfigure(WithCleanupInterval(0))
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Tickers == 0
+	}, time.Second, time.Millisecond)
+
+	tm.mtx.RLock()
+	assert.Equal(t, []interface{}{1}, expired)
+	tm.mtx.RUnlock()
+	assert.EqualValues(t, 2, tm.GetValue(2))
+}
 
-	time.Sleep(30 * time.Millisecond)
-	assert.NotNil(t, tm.get(key, 0))
+func TestReconfigureSizer(t *testing.T) {
+	tm := NewWithOptions(0, WithSizer(func(key, value interface{}) int {
+		return value.(int)
+	}))
 
-	time.Sleep(52 * time.Millisecond)
-	assert.Nil(t, tm.get(key, 0))
+	tm.Set(1, 10, time.Hour)
+	tm.Set(2, 20, time.Hour)
+	assert.Equal(t, []KeyCost{{2, 20, 0}, {1, 10, 0}}, tm.LargestEntries(2))
+
+	tm.Reconfigure(WithSizer(func(key, value interface{}) int {
+		return 100 - value.(int)
+	}))
+	assert.Equal(t, []KeyCost{{1, 90, 0}, {2, 80, 0}}, tm.LargestEntries(2))
+
+	tm.Reconfigure(WithSizer(nil))
+	assert.Nil(t, tm.LargestEntries(2))
+	assert.Zero(t, tm.container[keyWrap{0, 1}].cost)
 }
 
-func TestContains(t *testing.T) {
-	const key = "tKeyCont"
+func TestWithCleanupInterval(t *testing.T) {
+	tm := NewWithOptions(time.Hour, WithCleanupInterval(0))
+	defer tm.Close()
 
-	tm := New(dCleanupTick)
+	assert.Zero(t, tm.cleanupTickTime)
+	assert.Never(t, func() bool {
+		return tm.Resources().Tickers != 0
+	}, 10*time.Millisecond, time.Millisecond)
+}
 
-	tm.Set(key, 1, 30*time.Millisecond)
+func TestCleanUpNow(t *testing.T) {
+	tm := New(0)
 
-	assert.False(t, tm.Contains("keyNotExists"))
-	assert.True(t, tm.Contains(key))
+	var expired int
+	tm.Set(1, 1, 0, func(interface{}) { expired++ })
+	tm.Set(2, 2, 0)
+	tm.Set(3, 3, time.Hour)
+	time.Sleep(time.Millisecond)
 
-	time.Sleep(50 * time.Millisecond)
-	assert.False(t, tm.Contains(key))
+	assert.EqualValues(t, 2, tm.CleanUpNow())
+	assert.EqualValues(t, 1, expired)
+	assert.EqualValues(t, 1, tm.Size())
+	assert.EqualValues(t, 0, tm.CleanUpNow())
+
+	tm.Close()
+	assert.EqualValues(t, 0, tm.CleanUpNow())
 }
 
-func TestRemove(t *testing.T) {
-	const key = "tKeyRem"
+func TestExpiredKeys(t *testing.T) {
+	tm := New(0)
 
-	tm := New(dCleanupTick)
+	var expired int
+	tm.Set(1, 1, 0, func(interface{}) { expired++ })
+	tm.Set(2, 2, time.Hour)
+	tm.Section(1).Set(3, 3, 0)
+	time.Sleep(time.Millisecond)
 
-	tm.Set(key, 1, time.Hour)
-	tm.Remove(key)
+	assert.Equal(t, []interface{}{1}, tm.ExpiredKeys())
+	assert.Equal(t, []interface{}{3}, tm.Section(1).ExpiredKeys())
+	assert.EqualValues(t, 0, expired)
+	assert.NotNil(t, tm.getRaw(1, 0))
 
-	assert.Nil(t, tm.get(key, 0))
+	tm.cleanUp()
+	assert.Empty(t, tm.ExpiredKeys())
 }
 
-func TestRefresh(t *testing.T) {
-	const key = "tKeyRef"
+func TestKeysExpiringBefore(t *testing.T) {
+	tm := New(0)
 
-	tm := New(dCleanupTick)
+	tm.Set(1, 1, 10*time.Second)
+	tm.Set(2, 2, time.Hour)
+	tm.Set(3, 3, 0)
+	tm.Section(1).Set(4, 4, 10*time.Second)
+	time.Sleep(time.Millisecond)
 
-	err := tm.Refresh("keyNotExists", time.Hour)
-	assert.ErrorIs(t, err, ErrKeyNotFound)
+	before := time.Now().Add(30 * time.Second)
+	assert.Equal(t, []interface{}{1}, tm.KeysExpiringBefore(before))
+	assert.Equal(t, []interface{}{4}, tm.Section(1).KeysExpiringBefore(before))
+	assert.Empty(t, tm.KeysExpiringBefore(time.Now()))
+}
 
-	tm.Set(key, 1, 12*time.Millisecond)
-	assert.Nil(t, tm.Refresh(key, 50*time.Millisecond))
+func TestKeysByExpiry(t *testing.T) {
+	tm := New(0)
 
-	time.Sleep(30 * time.Millisecond)
-	assert.NotNil(t, tm.get(key, 0))
+	tm.Set(1, 1, time.Hour)
+	tm.Set(2, 2, time.Minute)
+	tm.Set(3, 3, 0)
+	tm.Set(4, 4, 10*time.Minute)
+	tm.Section(1).Set(5, 5, time.Second)
+	tm.Section(1).Set(6, 6, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
 
-	time.Sleep(100 * time.Millisecond)
-	assert.Nil(t, tm.get(key, 0))
+	assert.Equal(t, []interface{}{2, 4, 1}, tm.KeysByExpiry())
+	assert.Equal(t, []interface{}{5}, tm.Section(1).KeysByExpiry())
+	assert.Empty(t, tm.Section(2).KeysByExpiry())
 }
 
-func TestSize(t *testing.T) {
-	tm := New(dCleanupTick)
+func TestSoonestExpiring(t *testing.T) {
+	tm := New(0)
 
-	for i := 0; i < 25; i++ {
-		tm.Set(i, 1, 50*time.Millisecond)
+	for i := 1; i <= 10; i++ {
+		tm.Set(i, i, time.Duration(11-i)*time.Minute)
 	}
-	assert.EqualValues(t, 25, tm.Size())
+	tm.Set(11, 11, 0)
+	tm.Section(1).Set(12, 12, time.Second)
+	time.Sleep(time.Millisecond)
+
+	keys := func(entries []Entry) (res []interface{}) {
+		for _, e := range entries {
+			res = append(res, e.Key)
+		}
+		return
+	}
+
+	assert.Equal(t, []interface{}{10, 9, 8}, keys(tm.SoonestExpiring(3)))
+	assert.Len(t, tm.SoonestExpiring(20), 10)
+	assert.Empty(t, tm.SoonestExpiring(0))
+
+	entries := tm.Section(1).SoonestExpiring(5)
+	assert.Equal(t, []interface{}{12}, keys(entries))
+	assert.Equal(t, 1, entries[0].Section)
+	assert.Equal(t, 12, entries[0].Value)
 }
 
-func TestCallback(t *testing.T) {
-	cb := new(CB)
-	cb.On("Cb").Return()
+func TestNextExpiry(t *testing.T) {
+	tm := New(0)
 
-	tm := New(dCleanupTick)
+	_, ok := tm.NextExpiry()
+	assert.False(t, ok)
 
-	tm.Set(1, 3, 25*time.Millisecond, cb.Cb)
+	tm.Set(1, 1, 0)
+	tm.Set(2, 2, time.Hour)
+	at := time.Now().Add(time.Minute)
+	tm.Section(1).SetExpireAt(3, 3, at)
+	time.Sleep(time.Millisecond)
 
-	time.Sleep(50 * time.Millisecond)
-	assert.Nil(t, tm.get(1, 0))
-	cb.AssertCalled(t, "Cb")
-	assert.EqualValues(t, 3, cb.TestData().Get("v").Int())
+	next, ok := tm.NextExpiry()
+	assert.True(t, ok)
+	assert.True(t, at.Equal(next))
+
+	next, ok = tm.Section(1).NextExpiry()
+	assert.True(t, ok)
+	assert.True(t, at.Equal(next))
+
+	_, ok = tm.Section(2).NextExpiry()
+	assert.False(t, ok)
 }
 
-func TestStopCleaner(t *testing.T) {
+func TestClone(t *testing.T) {
 	tm := New(dCleanupTick)
+	defer tm.Close()
 
-	time.Sleep(10 * time.Millisecond)
-	tm.StopCleaner()
-	time.Sleep(10 * time.Millisecond)
-	assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+	var expired int32
+	cb := func(interface{}) { atomic.AddInt32(&expired, 1) }
 
-	assert.NotPanics(t, func() {
-		tm.StopCleaner()
-	})
+	tm.Set(1, 1, time.Hour, cb)
+	tm.Section(1).Set(1, 2, time.Hour)
+	tm.Set(2, 3, 0)
+	time.Sleep(time.Millisecond)
+
+	c := tm.Clone()
+	defer c.Close()
+
+	assert.Equal(t, dCleanupTick, c.cleanupTickTime)
+	assert.Equal(t, map[interface{}]interface{}{1: 1}, c.Snapshot())
+	assert.EqualValues(t, 2, c.Section(1).GetValue(1))
+	assert.Len(t, c.keys, 2)
+
+	exp, _ := tm.GetExpires(1)
+	cexp, _ := c.GetExpires(1)
+	assert.True(t, exp.Equal(cexp))
+
+	c.Set(3, 4, time.Hour)
+	assert.False(t, tm.Contains(3))
+
+	assert.Nil(t, c.SetExpires(1, 0))
+	time.Sleep(time.Millisecond)
+	c.cleanUp()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&expired))
+	assert.EqualValues(t, 1, tm.GetValue(1))
+}
+
+func TestMerge(t *testing.T) {
+	newMaps := func() (tm, other *TimedMap) {
+		tm, other = New(0), New(0)
+		tm.Set(1, "a", time.Hour)
+		tm.Set(2, "a", time.Minute)
+		other.Set(2, "b", time.Hour)
+		other.Set(3, "b", time.Hour)
+		other.Section(1).Set(1, "b", time.Hour)
+		other.Set(4, "b", 0)
+		time.Sleep(time.Millisecond)
+		return
+	}
+
+	// Test keep existing
+	{
+		tm, other := newMaps()
+		tm.Merge(other, MergeKeepExisting)
+		assert.Equal(t, map[interface{}]interface{}{1: "a", 2: "a", 3: "b"}, tm.Snapshot())
+		assert.EqualValues(t, "b", tm.Section(1).GetValue(1))
+		assert.Len(t, tm.keys, 4)
+	}
+
+	// Test overwrite
+	{
+		tm, other := newMaps()
+		tm.Merge(other, MergeOverwrite)
+		assert.Equal(t, map[interface{}]interface{}{1: "a", 2: "b", 3: "b"}, tm.Snapshot())
+		exp, _ := tm.GetExpires(2)
+		oexp, _ := other.GetExpires(2)
+		assert.True(t, exp.Equal(oexp))
+	}
+
+	// Test keep longer TTL
+	{
+		tm, other := newMaps()
+		other.Set(1, "b", time.Minute)
+		tm.Merge(other, MergeKeepLongerTTL)
+		assert.Equal(t, map[interface{}]interface{}{1: "a", 2: "b", 3: "b"}, tm.Snapshot())
+	}
+
+	// Test independence
+	{
+		tm, other := newMaps()
+		tm.Merge(other, MergeOverwrite)
+		other.Remove(3)
+		assert.EqualValues(t, "b", tm.GetValue(3))
+		tm.Merge(tm, MergeOverwrite)
+		assert.Len(t, tm.keys, 4)
+	}
+}
+
+func TestClosedPolicy(t *testing.T) {
+	// Test error policy
+	{
+		tm := New(0)
+		tm.Set(1, 1, time.Hour)
+		sec := tm.Section(1)
+		tm.Close()
+
+		tm.Set(2, 2, time.Hour)
+		sec.Set(2, 2, time.Hour)
+		assert.Nil(t, tm.GetValue(2))
+		assert.Nil(t, sec.GetValue(2))
+		assert.EqualValues(t, 0, tm.Size())
+		assert.False(t, tm.SetIfNotExists(3, 3, time.Hour))
+
+		_, err := tm.GetExpires(1)
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.ErrorIs(t, tm.Refresh(1, time.Hour), ErrClosed)
+		assert.ErrorIs(t, sec.Refresh(1, time.Hour), ErrClosed)
+		_, err = tm.Increment(1, 1, time.Hour)
+		assert.ErrorIs(t, err, ErrClosed)
+	}
+
+	// Test panic policy
+	{
+		tm := NewWithOptions(0, WithClosedPolicy(ClosedPanic))
+		sec := tm.Section(1)
+		tm.Close()
+
+		assert.PanicsWithValue(t, ErrClosed, func() { tm.Set(1, 1, time.Hour) })
+		assert.PanicsWithValue(t, ErrClosed, func() { sec.GetValue(1) })
+		assert.PanicsWithValue(t, ErrClosed, func() { tm.Flush() })
+		assert.NotPanics(t, tm.Close)
+	}
 }
 
 func TestStartCleanerInternal(t *testing.T) {
@@ -337,6 +1840,71 @@ func TestStartCleanerExternal(t *testing.T) {
 	}
 }
 
+func TestCleanupYield(t *testing.T) {
+	tm := NewWithOptions(0, WithCleanupYield(10))
+
+	for i := 0; i < 100; i++ {
+		d := time.Hour
+		if i%2 == 0 {
+			d = 0
+		}
+		tm.Set(i, i, d)
+	}
+	time.Sleep(time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 100; i < 200; i++ {
+			tm.Set(i, i, time.Hour)
+			tm.Remove(i - 99)
+		}
+	}()
+
+	expired := tm.cleanUp()
+	<-done
+
+	assert.LessOrEqual(t, expired, 50)
+	assert.NotZero(t, tm.Stats().CleanupYields)
+	for i := 0; i < 100; i += 2 {
+		assert.False(t, tm.Contains(i), i)
+	}
+	assert.Equal(t, 99, tm.SizeLive())
+
+	tm = NewWithOptions(0, WithCleanupYield(10))
+	for i := 0; i < 95; i++ {
+		tm.Set(i, i, 0)
+	}
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, 95, tm.cleanUp())
+	assert.Equal(t, 0, tm.Size())
+	assert.EqualValues(t, 9, tm.Stats().CleanupYields)
+}
+
+func TestCleanupN(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, i%2, i, 0)
+	}
+	tm.Set("alive", 1, time.Hour)
+	time.Sleep(time.Millisecond)
+
+	expired, remaining := tm.CleanupN(4)
+	assert.EqualValues(t, 4, expired)
+	assert.True(t, remaining)
+	assert.EqualValues(t, 7, tm.Size())
+
+	expired, remaining = tm.CleanupN(6)
+	assert.EqualValues(t, 6, expired)
+	assert.False(t, remaining)
+	assert.EqualValues(t, 1, tm.Size())
+
+	expired, remaining = tm.CleanupN(6)
+	assert.EqualValues(t, 0, expired)
+	assert.False(t, remaining)
+}
+
 func TestSnapshot(t *testing.T) {
 	tm := New(1 * time.Minute)
 
@@ -352,6 +1920,121 @@ func TestSnapshot(t *testing.T) {
 	}
 }
 
+func TestBorrowSnapshot(t *testing.T) {
+	tm := New(1 * time.Minute)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, 0, i, 1*time.Minute)
+	}
+	tm.set(1, 1, 1, 1*time.Minute)
+
+	m, release := tm.BorrowSnapshot()
+
+	assert.Len(t, m, 10)
+	for i := 0; i < 10; i++ {
+		assert.EqualValues(t, i, m[i])
+	}
+
+	release()
+	assert.Len(t, m, 0)
+	assert.NotPanics(t, release)
+
+	tm.Remove(0)
+	m, release = tm.BorrowSnapshot()
+	defer release()
+	assert.Len(t, m, 9)
+}
+
+func TestValues(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, 0, i, time.Hour)
+	}
+	tm.set(10, 0, 10, 0)
+	tm.set(11, 1, 11, time.Hour)
+	time.Sleep(time.Millisecond)
+
+	vals := tm.Values()
+	assert.Len(t, vals, 10)
+	for i := 0; i < 10; i++ {
+		assert.Contains(t, vals, i)
+	}
+}
+
+func TestRange(t *testing.T) {
+	tm := New(0)
+
+	for i := 0; i < 10; i++ {
+		tm.set(i, 0, i, time.Hour)
+	}
+	tm.set(10, 0, 10, 0)
+	tm.set(11, 1, 11, time.Hour)
+	time.Sleep(time.Millisecond)
+
+	m := make(map[interface{}]interface{})
+	tm.Range(func(key, value interface{}) bool {
+		m[key] = value
+		return true
+	})
+	assert.Len(t, m, 10)
+	for i := 0; i < 10; i++ {
+		assert.EqualValues(t, i, m[i])
+	}
+
+	n := 0
+	tm.Range(func(key, value interface{}) bool {
+		n++
+		return n < 3
+	})
+	assert.EqualValues(t, 3, n)
+}
+
+func TestKeysIndex(t *testing.T) {
+	tm, err := FromMap(map[int]int{1: 1, 2: 2}, time.Hour, 0)
+	assert.Nil(t, err)
+
+	for i := 3; i < 20; i++ {
+		tm.Set(i, i, time.Hour)
+	}
+	for i := 0; i < 20; i += 3 {
+		tm.Remove(i)
+	}
+	tm.Pop(1)
+
+	assert.Len(t, tm.keys, len(tm.container))
+	for k, v := range tm.container {
+		assert.Equal(t, k, tm.keys[v.idx])
+	}
+
+	tm.Flush()
+	assert.Len(t, tm.keys, 0)
+}
+
+func TestSampleKeys(t *testing.T) {
+	tm := New(0)
+
+	assert.Len(t, tm.SampleKeys(5), 0)
+
+	for i := 0; i < 100; i++ {
+		tm.set(i, i%2, i, time.Hour)
+	}
+	tm.set(100, 0, 100, 0)
+	time.Sleep(time.Millisecond)
+
+	keys := tm.SampleKeys(10)
+	assert.Len(t, keys, 10)
+	seen := make(map[interface{}]bool)
+	for _, k := range keys {
+		assert.False(t, seen[k])
+		seen[k] = true
+		assert.EqualValues(t, 0, k.(int)%2)
+		assert.NotEqual(t, 100, k)
+	}
+
+	assert.Len(t, tm.SampleKeys(1000), 50)
+}
+
 func TestConcurrentReadWrite(t *testing.T) {
 	tm := New(dCleanupTick)
 
@@ -400,6 +2083,45 @@ func TestGetExpiredConcurrent(t *testing.T) {
 	wg.Wait()
 }
 
+func TestExpireHandlerExactlyOnce(t *testing.T) {
+	const n = 500
+
+	counts := make(map[keyWrap]int)
+	tm := NewWithOptions(time.Millisecond, WithExpireHandler(func(e Entry) {
+		counts[keyWrap{sec: e.Section, key: e.Key}]++
+	}))
+	defer tm.Close()
+
+	for i := 0; i < n; i++ {
+		tm.Set(i, i, 0)
+	}
+	tm.Section(1).Set(0, 0, 0)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				tm.GetValue(i)
+				tm.Contains(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		return tm.Resources().Elements == 0
+	}, time.Second, time.Millisecond)
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	assert.Len(t, counts, n+1)
+	for k, c := range counts {
+		assert.EqualValues(t, 1, c, k)
+	}
+}
+
 func TestExternalTicker(t *testing.T) {
 	const key = "tKeySet"
 	const val = "tValSet"
@@ -0,0 +1,71 @@
+package timedmap
+
+import "time"
+
+// schedule moves the element v stored by k into the
+// forecast bucket of its expiration time and sets its
+// timer to its next deadline, if entry timers are
+// enabled.
+//
+// The caller must hold the write lock of the map.
+func (tm *TimedMap) schedule(k keyWrap, v *element) {
+	tm.trackExpiry(v)
+	if !tm.entryTimers {
+		return
+	}
+
+	next := v.nextDeadline()
+	if tm.grace > 0 && !time.Now().Before(v.expires) {
+		next = v.effectiveExpires().Add(tm.grace)
+	}
+
+	d := time.Until(next)
+	if v.timer == nil {
+		v.timer = time.AfterFunc(d, func() {
+			tm.fireTimer(k, v)
+		})
+		tm.timers++
+	} else {
+		v.timer.Reset(d)
+	}
+}
+
+// fireTimer checks the element v stored by k when its
+// timer has fired and schedules it for its next
+// deadline if it has not been expired.
+func (tm *TimedMap) fireTimer(k keyWrap, v *element) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	// The element may have been removed or re-used
+	// in the meantime.
+	if tm.container[k] != v {
+		return
+	}
+
+	if !tm.checkElement(k, v, time.Now()) {
+		tm.schedule(k, v)
+	}
+}
+
+// nextDeadline returns the next point of time at
+// which the element expires or any of its pending
+// callbacks are due.
+//
+// Expiration caused by a DecayFunc is not taken
+// into account and is only applied on read.
+func (v *element) nextDeadline() time.Time {
+	next := v.expires
+	if v.holds > 0 && v.heldUntil.After(next) {
+		next = v.heldUntil
+	}
+	if !v.warned && len(v.warnCbs) > 0 {
+		if t := v.expires.Add(-v.warnBefore); t.Before(next) {
+			next = t
+		}
+	}
+	if !v.softFired && !v.softExpires.IsZero() && v.softExpires.Before(next) {
+		next = v.softExpires
+	}
+	return next
+}
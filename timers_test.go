@@ -0,0 +1,72 @@
+package timedmap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryTimers(t *testing.T) {
+	tm := NewWithOptions(dCleanupTick, WithEntryTimers())
+	defer tm.Close()
+
+	assert.False(t, atomic.LoadUint32(tm.cleanerRunning) != 0)
+
+	expired := make(chan interface{}, 1)
+	tm.Set(1, 1, 20*time.Millisecond, func(v interface{}) {
+		expired <- v
+	})
+	tm.Set(2, 2, time.Hour)
+
+	select {
+	case v := <-expired:
+		assert.EqualValues(t, 1, v)
+	case <-time.After(time.Second):
+		assert.Fail(t, "element has not been expired")
+	}
+
+	tm.mtx.RLock()
+	assert.Nil(t, tm.container[keyWrap{key: 1}])
+	assert.NotNil(t, tm.container[keyWrap{key: 2}].timer)
+	tm.mtx.RUnlock()
+
+	tm.Remove(2)
+	assert.EqualValues(t, 0, tm.Size())
+}
+
+func TestEntryTimersRefresh(t *testing.T) {
+	tm := NewWithOptions(0, WithEntryTimers())
+	defer tm.Close()
+
+	tm.Set(1, 1, 20*time.Millisecond)
+	assert.Nil(t, tm.SetExpires(1, time.Hour))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, tm.getRaw(1, 0).value)
+
+	assert.Nil(t, tm.SetExpires(1, 10*time.Millisecond))
+	assert.Eventually(t, func() bool {
+		return tm.getRaw(1, 0) == nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestEntryTimersWarning(t *testing.T) {
+	tm := NewWithOptions(0, WithEntryTimers())
+	defer tm.Close()
+
+	warned := make(chan interface{}, 1)
+	tm.Set(1, 1, time.Hour)
+	assert.Nil(t, tm.SetWarning(1, time.Hour, func(v interface{}) {
+		warned <- v
+	}))
+
+	select {
+	case v := <-warned:
+		assert.EqualValues(t, 1, v)
+	case <-time.After(time.Second):
+		assert.Fail(t, "warning has not been executed")
+	}
+	assert.True(t, tm.Contains(1))
+}
@@ -0,0 +1,49 @@
+package timedmap
+
+import "reflect"
+
+// TypedSection returns the section with the given
+// identifier like Section and restricts the values of
+// the section to the type of sample, so that sections
+// of one map can hold values of different types. Values
+// of the section can then be type asserted to the type
+// of sample without checking.
+//
+// Values of another type, including nil, are not stored.
+// Operations which report errors return ErrValueType for
+// them. Values already stored in the section are kept.
+// Passing a nil sample removes the restriction.
+func (tm *TimedMap) TypedSection(i int, sample interface{}) Section {
+	tm.mtx.Lock()
+	if sample == nil {
+		delete(tm.valueTypes, i)
+	} else {
+		if tm.valueTypes == nil {
+			tm.valueTypes = make(map[int]reflect.Type)
+		}
+		tm.valueTypes[i] = reflect.TypeOf(sample)
+	}
+	tm.mtx.Unlock()
+
+	return tm.Section(i)
+}
+
+// checkValueType returns ErrValueType if val is not
+// of the value type set for the section sec using
+// TypedSection. Promises are accepted, as they are
+// replaced by their value once resolved.
+//
+// The caller must hold the lock of the map.
+func (tm *TimedMap) checkValueType(sec int, val interface{}) error {
+	typ, ok := tm.valueTypes[sec]
+	if !ok {
+		return nil
+	}
+	if _, ok = val.(*Promise); ok {
+		return nil
+	}
+	if reflect.TypeOf(val) != typ {
+		return ErrValueType
+	}
+	return nil
+}
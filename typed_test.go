@@ -0,0 +1,38 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedSection(t *testing.T) {
+	tm := New(0)
+	names := tm.TypedSection(1, "")
+	counts := tm.TypedSection(2, 0)
+
+	names.Set(1, "a", time.Hour)
+	names.Set(2, 2, time.Hour)
+	counts.Set(1, 1, time.Hour)
+	assert.EqualValues(t, 1, names.Size())
+	assert.Equal(t, "a", names.GetValue(1).(string))
+	assert.Equal(t, 1, counts.GetValue(1).(int))
+
+	assert.ErrorIs(t, names.Upsert(3, func() (interface{}, time.Duration) {
+		return nil, time.Hour
+	}, nil), ErrValueType)
+	_, err := names.Increment(4, 1, time.Hour)
+	assert.ErrorIs(t, err, ErrValueType)
+	assert.ErrorIs(t, counts.Update(1, func(interface{}, bool) (interface{}, time.Duration) {
+		return "x", KeepTTL
+	}), ErrValueType)
+	assert.Equal(t, 1, counts.GetValue(1).(int))
+
+	tm.Set(1, 1, time.Hour)
+	assert.EqualValues(t, 1, tm.GetValue(1))
+
+	tm.TypedSection(1, nil)
+	names.Set(2, 2, time.Hour)
+	assert.EqualValues(t, 2, names.GetValue(2))
+}
@@ -0,0 +1,123 @@
+package timedmap
+
+import "time"
+
+// TransformFunc maps a value stored in a map to
+// the value exposed by a View.
+type TransformFunc func(value interface{}) interface{}
+
+// ReadOnlyMap provides read access to the key-value
+// pairs of a map.
+type ReadOnlyMap interface {
+
+	// GetValue returns the value of a key in the map.
+	// The returned value is nil if there is no value to
+	// the passed key or if the value was expired.
+	GetValue(key interface{}) interface{}
+
+	// TryGetValue returns the value of a key in the map
+	// like GetValue. ok is false, if there is no value
+	// to the passed key or if the value was expired.
+	TryGetValue(key interface{}) (val interface{}, ok bool)
+
+	// GetExpires returns the expire time of a key-value
+	// pair. If the key-value pair does not exist in the
+	// map or was expired, this will return an error object.
+	GetExpires(key interface{}) (time.Time, error)
+
+	// TTL returns the remaining lifetime of a key-value
+	// pair. If the key-value pair does not exist in the
+	// map or was expired, this will return an error object.
+	TTL(key interface{}) (time.Duration, error)
+
+	// Contains returns true, if the key exists in the map.
+	// false will be returned, if there is no value to the
+	// key or if the key-value pair was expired.
+	Contains(key interface{}) bool
+
+	// Size returns the current number of key-value pairs
+	// existent in the map.
+	Size() int
+
+	// Snapshot returns a new map which represents the
+	// current key-value state of the map.
+	Snapshot() map[interface{}]interface{}
+
+	// Values returns the values of all key-value
+	// pairs in the map which have not expired.
+	Values() []interface{}
+
+	// Range calls fn sequentially for each key-value pair
+	// in the map which has not expired. If fn returns false,
+	// the iteration is stopped.
+	//
+	// The read lock of the map is held during the iteration,
+	// so fn must not write to the map.
+	Range(fn func(key, value interface{}) bool)
+}
+
+// view is a ReadOnlyMap passing all values of
+// the wrapped Section through transform on read.
+type view struct {
+	s         Section
+	transform TransformFunc
+}
+
+// newView creates a new view on s
+// using the given transform function.
+func newView(s Section, transform TransformFunc) *view {
+	return &view{
+		s:         s,
+		transform: transform,
+	}
+}
+
+func (v *view) GetValue(key interface{}) interface{} {
+	val, _ := v.TryGetValue(key)
+	return val
+}
+
+func (v *view) TryGetValue(key interface{}) (val interface{}, ok bool) {
+	if val, ok = v.s.TryGetValue(key); ok {
+		val = v.transform(val)
+	}
+	return
+}
+
+func (v *view) GetExpires(key interface{}) (time.Time, error) {
+	return v.s.GetExpires(key)
+}
+
+func (v *view) TTL(key interface{}) (time.Duration, error) {
+	return v.s.TTL(key)
+}
+
+func (v *view) Contains(key interface{}) bool {
+	return v.s.Contains(key)
+}
+
+func (v *view) Size() int {
+	return v.s.Size()
+}
+
+func (v *view) Snapshot() map[interface{}]interface{} {
+	m := v.s.Snapshot()
+	for key, val := range m {
+		m[key] = v.transform(val)
+	}
+	return m
+}
+
+func (v *view) Values() []interface{} {
+	vals := v.s.Values()
+	for i, val := range vals {
+		vals[i] = v.transform(val)
+	}
+	return vals
+}
+
+func (v *view) Range(fn func(key, value interface{}) bool) {
+	v.s.Range(func(key, value interface{}) bool {
+		return fn(key, v.transform(value))
+	})
+}
@@ -0,0 +1,49 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func TestView(t *testing.T) {
+	tm := New(0)
+	v := tm.View(func(value interface{}) interface{} {
+		return value.(testUser).Name
+	})
+
+	tm.Set(1, testUser{"alice", 30}, time.Hour)
+	tm.Set(2, testUser{"bob", 40}, time.Hour)
+	tm.Section(1).Set(3, testUser{"carol", 50}, time.Hour)
+
+	assert.EqualValues(t, "alice", v.GetValue(1))
+	assert.Nil(t, v.GetValue(3))
+	_, ok := v.TryGetValue(3)
+	assert.False(t, ok)
+	assert.True(t, v.Contains(2))
+	assert.EqualValues(t, 2, len(v.Snapshot()))
+	assert.Equal(t, map[interface{}]interface{}{1: "alice", 2: "bob"}, v.Snapshot())
+	assert.ElementsMatch(t, []interface{}{"alice", "bob"}, v.Values())
+
+	names := map[interface{}]interface{}{}
+	v.Range(func(key, value interface{}) bool {
+		names[key] = value
+		return true
+	})
+	assert.Equal(t, v.Snapshot(), names)
+
+	tm.Set(1, testUser{"dave", 60}, time.Hour)
+	assert.EqualValues(t, "dave", v.GetValue(1))
+
+	sv := tm.Section(1).View(func(value interface{}) interface{} {
+		return value.(testUser).Age
+	})
+	assert.EqualValues(t, 50, sv.GetValue(3))
+	assert.EqualValues(t, 1, sv.Size())
+}
@@ -0,0 +1,189 @@
+package timedmap
+
+import (
+	"math"
+	"time"
+)
+
+// windowBuckets is the number of buckets a sliding
+// window is divided into. Observations age out in
+// steps of the window size divided by windowBuckets.
+const windowBuckets = 16
+
+// WindowStats contains the aggregates of all
+// observations of a sliding window.
+type WindowStats struct {
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// Avg returns the average of all observations
+// or 0 if there are none.
+func (w WindowStats) Avg() float64 {
+	if w.Count == 0 {
+		return 0
+	}
+	return w.Sum / float64(w.Count)
+}
+
+// windowBucket aggregates all observations
+// starting at the slot of the given index.
+type windowBucket struct {
+	slot  int64
+	stats WindowStats
+}
+
+// slidingWindow aggregates observations over the
+// last size duration in a ring of buckets.
+type slidingWindow struct {
+	size    time.Duration
+	buckets [windowBuckets]windowBucket
+}
+
+// newSlidingWindow creates a new, empty
+// sliding window of the given size.
+func newSlidingWindow(size time.Duration) *slidingWindow {
+	w := &slidingWindow{size: size}
+	for i := range w.buckets {
+		w.buckets[i].slot = -1
+	}
+	return w
+}
+
+// slot returns the index of the slot the
+// given point of time belongs to.
+func (w *slidingWindow) slot(now time.Time) int64 {
+	res := int64(w.size) / windowBuckets
+	if res < 1 {
+		res = 1
+	}
+	return now.UnixNano() / res
+}
+
+// observe adds value to the bucket of the given
+// point of time.
+func (w *slidingWindow) observe(value float64, now time.Time) {
+	slot := w.slot(now)
+	b := &w.buckets[slot%windowBuckets]
+	if b.slot != slot {
+		b.slot = slot
+		b.stats = WindowStats{}
+	}
+	b.stats.add(value)
+}
+
+// stats returns the aggregates of all buckets
+// within the window at the given point of time.
+func (w *slidingWindow) stats(now time.Time) (s WindowStats) {
+	slot := w.slot(now)
+	for _, b := range w.buckets {
+		if b.slot < 0 || slot-b.slot >= windowBuckets {
+			continue
+		}
+		s.merge(b.stats)
+	}
+	return
+}
+
+// add adds a single observation to s.
+func (s *WindowStats) add(value float64) {
+	s.merge(WindowStats{Count: 1, Sum: value, Min: value, Max: value})
+}
+
+// merge adds all observations of o to s.
+func (s *WindowStats) merge(o WindowStats) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = o
+		return
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	s.Min = math.Min(s.Min, o.Min)
+	s.Max = math.Max(s.Max, o.Max)
+}
+
+// Observe adds value to the sliding window of the given
+// size stored for key and returns the aggregates of all
+// observations within the window. If the key does not
+// exist, a new window is created, otherwise the size of
+// the existing window is kept. The key-value pair
+// expires when no value has been observed for the
+// duration of the window.
+//
+// If the stored value is not a window, ErrValueNoWindow
+// is returned.
+func (tm *TimedMap) Observe(key interface{}, value float64, window time.Duration) (WindowStats, error) {
+	return tm.observe(tm.key(key), 0, value, window)
+}
+
+// WindowStats returns the aggregates of all observations
+// within the sliding window stored for key. If there is
+// no value to the key passed, ErrKeyNotFound is returned.
+// If the stored value is not a window, ErrValueNoWindow
+// is returned.
+func (tm *TimedMap) WindowStats(key interface{}) (WindowStats, error) {
+	return tm.windowStats(tm.key(key), 0)
+}
+
+// observe adds value to the sliding window of the
+// given key in the given section.
+func (tm *TimedMap) observe(
+	key interface{},
+	sec int,
+	value float64,
+	window time.Duration,
+) (WindowStats, error) {
+	if err := tm.checkClosed(); err != nil {
+		return WindowStats{}, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	now := time.Now()
+
+	var (
+		w   *slidingWindow
+		cbs []callback
+	)
+	if v := tm.getLocked(key, sec); v != nil {
+		var ok bool
+		if w, ok = v.value.(*slidingWindow); !ok {
+			return WindowStats{}, ErrValueNoWindow
+		}
+		cbs = v.cbs
+	} else {
+		w = newSlidingWindow(window)
+	}
+
+	w.observe(value, now)
+	tm.setLockedAt(key, sec, w, now, now.Add(w.size), cbs...)
+
+	return w.stats(now), nil
+}
+
+// windowStats returns the aggregates of the sliding
+// window of the given key in the given section.
+func (tm *TimedMap) windowStats(key interface{}, sec int) (WindowStats, error) {
+	if err := tm.checkClosed(); err != nil {
+		return WindowStats{}, err
+	}
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+
+	v := tm.getLocked(key, sec)
+	if v == nil {
+		return WindowStats{}, ErrKeyNotFound
+	}
+	w, ok := v.value.(*slidingWindow)
+	if !ok {
+		return WindowStats{}, ErrValueNoWindow
+	}
+	return w.stats(time.Now()), nil
+}
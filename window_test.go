@@ -0,0 +1,66 @@
+package timedmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	w := newSlidingWindow(16 * time.Second)
+	now := time.Unix(1000, 0)
+
+	assert.Equal(t, WindowStats{}, w.stats(now))
+
+	w.observe(1, now)
+	w.observe(5, now.Add(time.Second))
+	w.observe(3, now.Add(10*time.Second))
+
+	s := w.stats(now.Add(10 * time.Second))
+	assert.EqualValues(t, 3, s.Count)
+	assert.EqualValues(t, 9, s.Sum)
+	assert.EqualValues(t, 1, s.Min)
+	assert.EqualValues(t, 5, s.Max)
+	assert.EqualValues(t, 3, s.Avg())
+
+	s = w.stats(now.Add(16 * time.Second))
+	assert.EqualValues(t, 2, s.Count)
+	assert.EqualValues(t, 3, s.Min)
+
+	w.observe(7, now.Add(32*time.Second))
+	s = w.stats(now.Add(32 * time.Second))
+	assert.EqualValues(t, 1, s.Count)
+	assert.EqualValues(t, 7, s.Sum)
+}
+
+func TestObserve(t *testing.T) {
+	tm := New(0)
+
+	s, err := tm.Observe(1, 2, time.Hour)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, s.Count)
+
+	_, err = tm.Observe(1, 4, time.Minute)
+	assert.Nil(t, err)
+
+	s, err = tm.WindowStats(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, s.Count)
+	assert.EqualValues(t, 3, s.Avg())
+	ttl, _ := tm.TTL(1)
+	assert.Greater(t, ttl, time.Minute)
+
+	tm.Set(2, 1, time.Hour)
+	_, err = tm.Observe(2, 1, time.Hour)
+	assert.ErrorIs(t, err, ErrValueNoWindow)
+	_, err = tm.WindowStats(2)
+	assert.ErrorIs(t, err, ErrValueNoWindow)
+	_, err = tm.WindowStats(3)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = tm.Section(1).Observe(1, 1, 0)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond)
+	assert.False(t, tm.Section(1).Contains(1))
+}